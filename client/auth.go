@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TokenResponse 服务器签发的令牌
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	User         struct {
+		Name               string `json:"name"`
+		IsAdmin            bool   `json:"isAdmin"`
+		MustChangePassword bool   `json:"must_change_password"`
+	} `json:"user"`
+}
+
+// DeployTokenInfo 部署令牌信息
+type DeployTokenInfo struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Owner     string     `json:"owner"`
+	Sites     []string   `json:"sites"`
+	Actions   []string   `json:"actions"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired"`
+}
+
+// tokenRefreshMargin 访问令牌到期前多久开始刷新
+const tokenRefreshMargin = time.Minute
+
+// Login 使用用户名和密码登录，并将令牌保存到配置（不保存密码）
+func Login(config *ClientConfig, username, password string) (*TokenResponse, error) {
+	payload, _ := json.Marshal(map[string]string{
+		"username": username,
+		"password": password,
+	})
+
+	tokens, err := requestTokens(config.ServerURL+"/auth/login", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Username = username
+	config.storeTokens(tokens)
+	if err := SaveConfig(config); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Logout 注销服务器会话并清除本地令牌
+func Logout(config *ClientConfig) error {
+	var logoutErr error
+	if config.AccessToken != "" {
+		req, err := http.NewRequest("POST", config.ServerURL+"/auth/logout", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+config.AccessToken)
+
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if err != nil {
+			logoutErr = err
+		} else {
+			resp.Body.Close()
+		}
+	}
+
+	config.clearTokens()
+	if err := SaveConfig(config); err != nil {
+		return err
+	}
+	return logoutErr
+}
+
+// ChangePassword 修改当前登录用户的密码
+func ChangePassword(config *ClientConfig, oldPassword, newPassword string) error {
+	payload, _ := json.Marshal(map[string]string{
+		"old_password": oldPassword,
+		"new_password": newPassword,
+	})
+
+	req, err := http.NewRequest("POST", config.ServerURL+"/auth/change-password", strings.NewReader(string(payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := config.AddAuthHeader(req); err != nil {
+		return err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s", string(body))
+	}
+	return nil
+}
+
+// deployTokenEnv 部署令牌环境变量，设置后优先使用（用于CI）
+const deployTokenEnv = "AIDEPLOY_TOKEN"
+
+// AccessTokenForRequest 返回可用的访问令牌，即将过期时自动使用刷新令牌续期
+// 设置了 AIDEPLOY_TOKEN 环境变量时直接使用该部署令牌
+func (c *ClientConfig) AccessTokenForRequest() (string, error) {
+	if token := os.Getenv(deployTokenEnv); token != "" {
+		return token, nil
+	}
+
+	if c.AccessToken == "" {
+		return "", nil
+	}
+
+	if time.Now().Add(tokenRefreshMargin).Before(c.TokenExpiresAt) {
+		return c.AccessToken, nil
+	}
+
+	if c.RefreshToken == "" {
+		return "", fmt.Errorf("登录已过期，请重新登录")
+	}
+
+	payload, _ := json.Marshal(map[string]string{
+		"refresh_token": c.RefreshToken,
+	})
+	tokens, err := requestTokens(c.ServerURL+"/auth/refresh", payload)
+	if err != nil {
+		return "", fmt.Errorf("刷新登录状态失败，请重新登录: %v", err)
+	}
+
+	c.storeTokens(tokens)
+	if err := SaveConfig(c); err != nil {
+		return "", err
+	}
+	return c.AccessToken, nil
+}
+
+// AddAuthHeader 为请求添加 Authorization 头
+func (c *ClientConfig) AddAuthHeader(req *http.Request) error {
+	token, err := c.AccessTokenForRequest()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// storeTokens 保存令牌到配置
+func (c *ClientConfig) storeTokens(tokens *TokenResponse) {
+	c.AccessToken = tokens.AccessToken
+	c.RefreshToken = tokens.RefreshToken
+	c.TokenExpiresAt = time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second)
+}
+
+// clearTokens 清除配置中的令牌
+func (c *ClientConfig) clearTokens() {
+	c.AccessToken = ""
+	c.RefreshToken = ""
+	c.TokenExpiresAt = time.Time{}
+}
+
+// requestTokens 请求令牌接口
+func requestTokens(url string, payload []byte) (*TokenResponse, error) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(payload)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", string(body))
+	}
+
+	var tokens TokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	return &tokens, nil
+}
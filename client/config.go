@@ -5,14 +5,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // ClientConfig 客户端配置
 type ClientConfig struct {
-	ServerURL  string            `json:"server_url"`
-	Username   string            `json:"username"`
-	Password   string            `json:"password"`
-	SitePaths  map[string]string `json:"site_paths"` // 网站名称 -> 本地发布目录映射
+	ServerURL      string            `json:"server_url"`
+	Username       string            `json:"username"`
+	AccessToken    string            `json:"access_token,omitempty"`  // 访问令牌（登录后获得，不保存密码）
+	RefreshToken   string            `json:"refresh_token,omitempty"` // 刷新令牌
+	TokenExpiresAt time.Time         `json:"token_expires_at,omitempty"`
+	SitePaths      map[string]string `json:"site_paths"` // 网站名称 -> 本地发布目录映射
 }
 
 // LoadConfig 加载客户端配置
@@ -19,10 +19,10 @@ import (
 // Deployer 部署器
 type Deployer struct {
 	serverURL   string
-	username    string
-	password    string
+	config      *ClientConfig // 客户端配置（提供访问令牌）
 	siteName    string
 	trackingDir string // 跟踪文件目录
+	tag         string // 部署后为新版本设置的标签
 }
 
 // FileStatus 文件状态
@@ -34,6 +34,28 @@ type FileStatus struct {
 	LastDeployed time.Time `json:"last_deployed"`
 }
 
+// manifestFileName 部署包中保留的清单条目名称（与服务端一致）
+const manifestFileName = ".aideploy-manifest.json"
+
+// PackageManifest 部署包清单
+type PackageManifest struct {
+	Deleted []string `json:"deleted"` // 需要删除的文件（相对路径，使用"/"分隔）
+}
+
+// DeployResult 服务器返回的部署结果
+type DeployResult struct {
+	Message   string   `json:"message"`
+	Mode      string   `json:"mode"`
+	Added     int      `json:"added"`
+	Replaced  int      `json:"replaced"`
+	Removed   int      `json:"removed"`
+	Unchanged int      `json:"unchanged"`
+	Deleted   []string `json:"deleted"`
+	Label     string   `json:"label"`      // 预览标签
+	URL       string   `json:"url"`        // 预览地址
+	ExpiresAt string   `json:"expires_at"` // 预览过期时间
+}
+
 // TrackingData 跟踪数据
 type TrackingData struct {
 	SiteName   string       `json:"site_name"`
@@ -46,19 +68,15 @@ func NewDeployer(serverURL, siteName string) *Deployer {
 	homeDir, _ := os.UserHomeDir()
 	trackingDir := filepath.Join(homeDir, ".aideploy", "tracking")
 
-	// 加载配置以获取用户名和密码
+	// 加载配置以获取访问令牌
 	config, err := LoadConfig()
-	username := ""
-	password := ""
-	if err == nil {
-		username = config.Username
-		password = config.Password
+	if err != nil {
+		config = &ClientConfig{ServerURL: serverURL}
 	}
 
 	return &Deployer{
 		serverURL:   serverURL,
-		username:    username,
-		password:    password,
+		config:      config,
 		siteName:    siteName,
 		trackingDir: trackingDir,
 	}
@@ -85,7 +103,7 @@ func (d *Deployer) DeployFull(sitePath, message string) error {
 
 	// 打包整个目录
 	fmt.Printf("正在打包目录: %s\n", sitePath)
-	if err := d.createPackage(sitePath, tempPath, nil); err != nil {
+	if err := d.createPackage(sitePath, tempPath, nil, nil); err != nil {
 		return fmt.Errorf("打包失败: %v", err)
 	}
 
@@ -96,7 +114,8 @@ func (d *Deployer) DeployFull(sitePath, message string) error {
 
 	// 上传到服务器
 	url := fmt.Sprintf("%s/sites/deploy-full", d.serverURL)
-	if err := d.uploadPackage(url, tempPath, message); err != nil {
+	result, err := d.uploadPackage(url, tempPath, message, nil)
+	if err != nil {
 		return fmt.Errorf("上传失败: %v", err)
 	}
 
@@ -105,7 +124,7 @@ func (d *Deployer) DeployFull(sitePath, message string) error {
 		fmt.Printf("警告: 更新跟踪信息失败: %v\n", err)
 	}
 
-	fmt.Println("✓ 全量部署成功!")
+	fmt.Printf("✓ 全量部署成功! (新增: %d, 替换: %d, 移除: %d, 未变: %d)\n", result.Added, result.Replaced, result.Removed, result.Unchanged)
 	return nil
 }
 
@@ -133,6 +152,9 @@ func (d *Deployer) DeployIncremental(sitePath, message string) error {
 
 	if len(changedFiles) == 0 && len(deletedFiles) == 0 {
 		fmt.Println("没有文件变更，无需部署")
+		if d.tag != "" {
+			fmt.Printf("为当前版本设置标签: deploy-cli tag add %s %s\n", d.siteName, d.tag)
+		}
 		return nil
 	}
 
@@ -147,14 +169,18 @@ func (d *Deployer) DeployIncremental(sitePath, message string) error {
 	defer os.Remove(tempPath)
 	tempFile.Close()
 
-	// 打包变更的文件
-	if err := d.createPackage(sitePath, tempPath, changedFiles); err != nil {
+	// 打包变更的文件，并在清单中记录删除的文件
+	manifest := &PackageManifest{Deleted: make([]string, 0, len(deletedFiles))}
+	for _, f := range deletedFiles {
+		manifest.Deleted = append(manifest.Deleted, filepath.ToSlash(f))
+	}
+	if err := d.createPackage(sitePath, tempPath, changedFiles, manifest); err != nil {
 		return fmt.Errorf("打包失败: %v", err)
 	}
 
 	// 上传到服务器
 	url := fmt.Sprintf("%s/sites/deploy-incremental", d.serverURL)
-	if err := d.uploadPackage(url, tempPath, message); err != nil {
+	if _, err := d.uploadPackage(url, tempPath, message, nil); err != nil {
 		return fmt.Errorf("上传失败: %v", err)
 	}
 
@@ -163,10 +189,48 @@ func (d *Deployer) DeployIncremental(sitePath, message string) error {
 		fmt.Printf("警告: 更新跟踪信息失败: %v\n", err)
 	}
 
-	fmt.Printf("✓ 增量部署成功! (变更: %d 文件)\n", len(changedFiles))
+	fmt.Printf("✓ 增量部署成功! (变更: %d 文件, 删除: %d 文件)\n", len(changedFiles), len(deletedFiles))
 	return nil
 }
 
+// DeployPreview 预览部署：打包整个目录发布到独立的预览地址，不影响线上版本和增量跟踪信息
+// ttlHours 为 0 时使用服务器默认有效期
+func (d *Deployer) DeployPreview(sitePath, label, message string, ttlHours int) (*DeployResult, error) {
+	fmt.Printf("开始预览部署 (%s)...\n", label)
+
+	tempFile, err := os.CreateTemp("", "deploy-preview-*.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+	tempFile.Close()
+
+	fmt.Printf("正在打包目录: %s\n", sitePath)
+	if err := d.createPackage(sitePath, tempPath, nil, nil); err != nil {
+		return nil, fmt.Errorf("打包失败: %v", err)
+	}
+
+	fields := map[string]string{"preview": label}
+	if ttlHours > 0 {
+		fields["preview_ttl_hours"] = fmt.Sprintf("%d", ttlHours)
+	}
+
+	url := fmt.Sprintf("%s/sites/deploy-full", d.serverURL)
+	result, err := d.uploadPackage(url, tempPath, message, fields)
+	if err != nil {
+		return nil, fmt.Errorf("上传失败: %v", err)
+	}
+
+	fmt.Printf("✓ 预览部署成功! 访问地址: %s\n", result.URL)
+	if result.ExpiresAt != "" {
+		if expiresAt, err := time.Parse(time.RFC3339, result.ExpiresAt); err == nil {
+			fmt.Printf("  过期时间: %s\n", expiresAt.Local().Format("2006-01-02 15:04"))
+		}
+	}
+	return result, nil
+}
+
 // Deploy 智能部署(自动选择增量或全量)
 func (d *Deployer) Deploy(sitePath, message string) error {
 	// 检查是否有跟踪信息
@@ -279,7 +343,8 @@ func (d *Deployer) FindDeletedFiles(current []FileStatus, previous []FileStatus)
 }
 
 // createPackage 创建部署包
-func (d *Deployer) createPackage(sitePath, packagePath string, files []FileStatus) error {
+// manifest 为 nil 时打包整个目录，否则只打包 files 并写入清单
+func (d *Deployer) createPackage(sitePath, packagePath string, files []FileStatus, manifest *PackageManifest) error {
 	file, err := os.Create(packagePath)
 	if err != nil {
 		return err
@@ -295,8 +360,8 @@ func (d *Deployer) createPackage(sitePath, packagePath string, files []FileStatu
 	fileCount := 0
 	dirCount := 0
 
-	// 如果没有指定文件列表，打包所有文件
-	if len(files) == 0 {
+	// 没有清单时为全量包，打包所有文件
+	if manifest == nil {
 		err := filepath.Walk(sitePath, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
@@ -333,6 +398,11 @@ func (d *Deployer) createPackage(sitePath, packagePath string, files []FileStatu
 		return nil
 	}
 
+	// 写入清单
+	if err := d.addManifestToTar(tarWriter, manifest); err != nil {
+		return err
+	}
+
 	// 打包指定的文件
 	for _, f := range files {
 		fullPath := filepath.Join(sitePath, f.Path)
@@ -346,10 +416,32 @@ func (d *Deployer) createPackage(sitePath, packagePath string, files []FileStatu
 		fileCount++
 	}
 
-	fmt.Printf("已打包: %d 个文件, %d 个目录\n", fileCount, dirCount)
+	fmt.Printf("已打包: %d 个文件, %d 个目录, %d 个删除\n", fileCount, dirCount, len(manifest.Deleted))
 	return nil
 }
 
+// addManifestToTar 将清单写入tar包
+func (d *Deployer) addManifestToTar(tarWriter *tar.Writer, manifest *PackageManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:     manifestFileName,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = tarWriter.Write(data)
+	return err
+}
+
 // addToTar 添加文件到tar包
 func (d *Deployer) addToTar(tarWriter *tar.Writer, filePath, baseDir string, info os.FileInfo) error {
 	// 获取相对路径
@@ -389,11 +481,11 @@ func (d *Deployer) addToTar(tarWriter *tar.Writer, filePath, baseDir string, inf
 }
 
 // uploadPackage 上传部署包
-func (d *Deployer) uploadPackage(url, packagePath, message string) error {
+func (d *Deployer) uploadPackage(url, packagePath, message string, fields map[string]string) (*DeployResult, error) {
 	// 打开包文件
 	file, err := os.Open(packagePath)
 	if err != nil {
-		return fmt.Errorf("打开包文件失败: %v", err)
+		return nil, fmt.Errorf("打开包文件失败: %v", err)
 	}
 	defer file.Close()
 
@@ -403,49 +495,62 @@ func (d *Deployer) uploadPackage(url, packagePath, message string) error {
 
 	// 添加name字段
 	if err := writer.WriteField("name", d.siteName); err != nil {
-		return fmt.Errorf("写入name字段失败: %v", err)
+		return nil, fmt.Errorf("写入name字段失败: %v", err)
 	}
 
 	// 添加message字段
 	if err := writer.WriteField("message", message); err != nil {
-		return fmt.Errorf("写入message字段失败: %v", err)
+		return nil, fmt.Errorf("写入message字段失败: %v", err)
+	}
+
+	// 添加版本标签
+	if d.tag != "" {
+		if err := writer.WriteField("tag", d.tag); err != nil {
+			return nil, fmt.Errorf("写入tag字段失败: %v", err)
+		}
+	}
+
+	// 添加其他字段（如预览标签）
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, fmt.Errorf("写入%s字段失败: %v", key, err)
+		}
 	}
 
 	// 添加package文件
 	part, err := writer.CreateFormFile("package", filepath.Base(packagePath))
 	if err != nil {
-		return fmt.Errorf("创建文件字段失败: %v", err)
+		return nil, fmt.Errorf("创建文件字段失败: %v", err)
 	}
 
 	if _, err := io.Copy(part, file); err != nil {
-		return fmt.Errorf("复制文件内容失败: %v", err)
+		return nil, fmt.Errorf("复制文件内容失败: %v", err)
 	}
 
 	// 关闭writer以完成multipart写入
 	if err := writer.Close(); err != nil {
-		return fmt.Errorf("关闭writer失败: %v", err)
+		return nil, fmt.Errorf("关闭writer失败: %v", err)
 	}
 
 	// 创建HTTP请求
 	req, err := http.NewRequest("POST", url, &requestBody)
 	if err != nil {
-		return fmt.Errorf("创建请求失败: %v", err)
+		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
 
 	// 设置Content-Type头
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	// 添加认证信息
-	if d.username != "" && d.password != "" {
-		req.Header.Set("X-Username", d.username)
-		req.Header.Set("X-Password", d.password)
+	if err := d.config.AddAuthHeader(req); err != nil {
+		return nil, err
 	}
 
 	// 发送请求
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("发送请求失败: %v", err)
+		return nil, fmt.Errorf("发送请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
@@ -454,10 +559,15 @@ func (d *Deployer) uploadPackage(url, packagePath, message string) error {
 
 	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("服务器返回错误: %s", string(body))
+		return nil, fmt.Errorf("服务器返回错误: %s", string(body))
 	}
 
-	return nil
+	var result DeployResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	return &result, nil
 }
 
 // LoadTracking 加载跟踪信息
@@ -525,9 +635,8 @@ func (d *Deployer) PullFromServer(sitePath string) error {
 	}
 
 	// 添加认证信息
-	if d.username != "" && d.password != "" {
-		req.Header.Set("X-Username", d.username)
-		req.Header.Set("X-Password", d.password)
+	if err := d.config.AddAuthHeader(req); err != nil {
+		return err
 	}
 
 	// 发送请求
@@ -10,9 +10,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
@@ -26,8 +30,6 @@ func main() {
 	}
 
 	apiBaseURL := config.ServerURL
-	username := config.Username
-	password := config.Password
 
 	args := flag.Args()
 	if len(args) < 1 {
@@ -40,24 +42,52 @@ func main() {
 	switch command {
 	case "config":
 		handleConfig(args[1:])
+	case "login":
+		handleLogin(config, args[1:])
+	case "logout":
+		handleLogout(config)
+	case "passwd":
+		handlePasswd(config)
+	case "token":
+		handleToken(apiBaseURL, config, args[1:])
 	case "create":
-		handleCreate(apiBaseURL, username, password, args[1:])
+		handleCreate(apiBaseURL, config, args[1:])
 	case "delete":
-		handleDelete(apiBaseURL, username, password, args[1:])
+		handleDelete(apiBaseURL, config, args[1:])
 	case "deploy":
-		handleDeploy(apiBaseURL, username, password, config, args[1:])
+		handleDeploy(apiBaseURL, config, args[1:])
 	case "deploy-full":
-		handleDeployFull(apiBaseURL, username, password, config, args[1:])
+		handleDeployFull(apiBaseURL, config, args[1:])
 	case "deploy-inc":
-		handleDeployIncremental(apiBaseURL, username, password, config, args[1:])
+		handleDeployIncremental(apiBaseURL, config, args[1:])
 	case "list":
-		handleList(apiBaseURL, username, password, args[1:])
+		handleList(apiBaseURL, config, args[1:])
 	case "versions":
-		handleVersions(apiBaseURL, username, password, args[1:])
+		handleVersions(apiBaseURL, config, args[1:])
 	case "rollback":
-		handleRollback(apiBaseURL, username, password, args[1:])
+		handleRollback(apiBaseURL, config, args[1:])
+	case "tag":
+		handleTag(apiBaseURL, config, args[1:])
+	case "diff":
+		handleDiff(apiBaseURL, config, args[1:])
 	case "pull":
-		handlePull(apiBaseURL, username, password, config, args[1:])
+		handlePull(apiBaseURL, config, args[1:])
+	case "preview":
+		handlePreview(apiBaseURL, config, args[1:])
+	case "access":
+		handleAccess(apiBaseURL, config, args[1:])
+	case "retention":
+		handleRetention(apiBaseURL, config, args[1:])
+	case "prune":
+		handlePrune(apiBaseURL, config, args[1:])
+	case "headers":
+		handleHeaders(apiBaseURL, config, args[1:])
+	case "notfound":
+		handleNotFound(apiBaseURL, config, args[1:])
+	case "basepath":
+		handleBasePath(apiBaseURL, config, args[1:])
+	case "routing":
+		handleRouting(apiBaseURL, config, args[1:])
 	case "help":
 		printUsage()
 	default:
@@ -67,36 +97,32 @@ func main() {
 	}
 }
 
-// addAuthToRequest 如果配置了用户名/密码，则添加到请求头
-func addAuthToRequest(req *http.Request, username, password string) {
-	if username != "" && password != "" {
-		req.Header.Set("X-Username", username)
-		req.Header.Set("X-Password", password)
-	}
-}
-
 // postJSON 发送POST请求（带JSON body和可选的认证信息）
-func postJSON(url string, body []byte, username, password string) (*http.Response, error) {
+func postJSON(url string, body []byte, config *ClientConfig) (*http.Response, error) {
 	req, err := http.NewRequest("POST", url, strings.NewReader(string(body)))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	addAuthToRequest(req, username, password)
+	if err := config.AddAuthHeader(req); err != nil {
+		return nil, err
+	}
 
 	client := &http.Client{}
 	return client.Do(req)
 }
 
 // getJSON 发送GET请求（带可选的认证信息）
-func getJSON(url string, username, password string) (*http.Response, error) {
+func getJSON(url string, config *ClientConfig) (*http.Response, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	addAuthToRequest(req, username, password)
+	if err := config.AddAuthHeader(req); err != nil {
+		return nil, err
+	}
 
 	client := &http.Client{}
 	return client.Do(req)
@@ -107,43 +133,71 @@ func printUsage() {
 	fmt.Println("\n用法:")
 	fmt.Println("  deploy-cli <command> [arguments]")
 	fmt.Println("\n命令:")
-	fmt.Println("  config                管理配置（服务器地址、API密钥、网站目录）")
-	fmt.Println("  create <name>          创建新网站")
+	fmt.Println("  config                管理配置（服务器地址、用户名、网站目录）")
+	fmt.Println("  login [username]       登录服务器（保存访问令牌，不保存密码）")
+	fmt.Println("  logout                 退出登录")
+	fmt.Println("  passwd                 修改当前用户密码")
+	fmt.Println("  token <subcommand>     管理部署令牌（CI 使用，create/list/revoke）")
+	fmt.Println("  create <name> [--domains a.com,b.com]  创建新网站（可绑定自定义域名）")
 	fmt.Println("  delete <name>          删除网站")
 	fmt.Println("  deploy [name] [dir]    部署网站（智能选择增量或全量，自动匹配网站）")
+	fmt.Println("  deploy ... --preview <label> [--ttl 72]  预览部署到独立地址（不影响线上，ttl 单位小时）")
+	fmt.Println("  deploy ... --tag <tag>  部署后为新版本设置标签（deploy-full、deploy-inc 同样支持）")
+	fmt.Println("  preview <subcommand>   管理预览部署（list/promote/delete）")
+	fmt.Println("  access <name> <mode>   设置网站访问策略（public/password/link/users）")
+	fmt.Println("  retention <name> [--keep-last N] [--keep-days N] [--inherit]  设置网站版本保留策略")
+	fmt.Println("  prune [name]           立即按保留策略清理旧版本（管理员）")
+	fmt.Println("  headers <name> [--file rules.json] [--clear]  查看或设置网站响应头规则")
+	fmt.Println("  notfound <name> <auto|spa|strict|custom>  设置请求路径不存在时的处理方式")
+	fmt.Println("  basepath <name> <off|base|rewrite>  设置路径模式下网站访问前缀的处理方式")
+	fmt.Println("  routing <name> <both|subdomain|path>  设置混合模式下网站的访问方式")
 	fmt.Println("  deploy-full [name]     全量部署网站")
 	fmt.Println("  deploy-inc [name]      增量部署网站")
 	fmt.Println("  list                   列出所有网站")
-	fmt.Println("  versions <name>        查看网站版本历史")
-	fmt.Println("  rollback <name> <hash> 回滚到指定版本")
+	fmt.Println("  versions <name> [--limit N] [--offset N] [--author a] [--grep q] [--since d] [--until d]  查看网站版本历史（分页、筛选）")
+	fmt.Println("  rollback <name> <hash|tag>  回滚到指定版本或标签")
+	fmt.Println("  tag <subcommand>       管理版本标签（list/add/delete）")
+	fmt.Println("  diff <name> <from> [to] [--stat]  比较两个版本（to 默认为当前版本）")
 	fmt.Println("  pull [name]            从服务器覆盖本地（自动匹配网站）")
 	fmt.Println("  help                   显示帮助信息")
 	fmt.Println("\n示例:")
 	fmt.Println("  deploy-cli config set server http://192.168.1.100:8080/api")
-	fmt.Println("  deploy-cli config set username admin")
-	fmt.Println("  deploy-cli config set password admin123")
+	fmt.Println("  deploy-cli login admin")
 	fmt.Println("  deploy-cli config set site my-prototype ./dist")
 	fmt.Println("  deploy-cli config get")
 	fmt.Println("  deploy-cli create my-prototype")
+	fmt.Println("  deploy-cli create my-demo --domains demo.customer.com")
 	fmt.Println("  deploy-cli deploy                    # 自动匹配并部署")
 	fmt.Println("  deploy-cli deploy my-prototype        # 指定网站部署")
 	fmt.Println("  deploy-cli deploy my-prototype ./dist # 指定目录部署")
+	fmt.Println("  deploy-cli deploy my-prototype --preview feature-x  # 预览部署")
+	fmt.Println("  deploy-cli preview promote my-prototype feature-x   # 预览上线")
 	fmt.Println("  deploy-cli versions my-prototype")
+	fmt.Println("  deploy-cli diff my-prototype abc123   # 查看回滚会带来的变化")
 	fmt.Println("  deploy-cli rollback my-prototype abc123")
+	fmt.Println("  deploy-cli deploy my-prototype --tag v1-client-review  # 部署并打标签")
+	fmt.Println("  deploy-cli rollback my-prototype v1-client-review      # 回滚到标签")
 	fmt.Println("  deploy-cli pull my-prototype             # 从服务器覆盖本地")
+	fmt.Println("  deploy-cli token create ci --sites my-prototype --actions deploy --expires 90d")
+	fmt.Println("\nCI 中使用部署令牌:")
+	fmt.Println("  AIDEPLOY_TOKEN=adt_xxx deploy-cli deploy my-prototype ./dist")
 }
 
-func handleCreate(apiBaseURL, username, password string, args []string) {
+func handleCreate(apiBaseURL string, config *ClientConfig, args []string) {
 	if len(args) < 1 {
 		fmt.Println("错误: 请提供网站名称")
-		fmt.Println("用法: deploy-cli create <name>")
+		fmt.Println("用法: deploy-cli create <name> [--domains a.com,b.com]")
 		os.Exit(1)
 	}
 
 	name := args[0]
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	domains := fs.String("domains", "", "自定义域名，逗号分隔")
+	fs.Parse(args[1:])
 
-	payload := map[string]string{
-		"name": name,
+	payload := map[string]interface{}{
+		"name":    name,
+		"domains": splitList(*domains),
 	}
 
 	data, err := json.Marshal(payload)
@@ -152,7 +206,7 @@ func handleCreate(apiBaseURL, username, password string, args []string) {
 		os.Exit(1)
 	}
 
-	resp, err := postJSON(apiBaseURL+"/sites/create", data, username, password)
+	resp, err := postJSON(apiBaseURL+"/sites/create", data, config)
 	if err != nil {
 		fmt.Printf("错误: %v\n", err)
 		os.Exit(1)
@@ -179,9 +233,12 @@ func handleCreate(apiBaseURL, username, password string, args []string) {
 	if path, ok := result["path"].(string); ok {
 		fmt.Printf("  路径: %s\n", path)
 	}
+	if domains, ok := result["domains"].([]interface{}); ok && len(domains) > 0 {
+		fmt.Printf("  自定义域名: %s\n", joinList(domains))
+	}
 }
 
-func handleDelete(apiBaseURL, username, password string, args []string) {
+func handleDelete(apiBaseURL string, config *ClientConfig, args []string) {
 	if len(args) < 1 {
 		fmt.Println("错误: 请提供网站名称")
 		fmt.Println("用法: deploy-cli delete <name>")
@@ -210,7 +267,7 @@ func handleDelete(apiBaseURL, username, password string, args []string) {
 		return
 	}
 
-	resp, err := postJSON(apiBaseURL+"/sites/delete", data, username, password)
+	resp, err := postJSON(apiBaseURL+"/sites/delete", data, config)
 	if err != nil {
 		fmt.Printf("错误: %v\n", err)
 		os.Exit(1)
@@ -227,8 +284,8 @@ func handleDelete(apiBaseURL, username, password string, args []string) {
 	fmt.Println("✓ 网站删除成功!")
 }
 
-func handleList(apiBaseURL, username, password string, args []string) {
-	resp, err := getJSON(apiBaseURL+"/sites/list", username, password)
+func handleList(apiBaseURL string, config *ClientConfig, args []string) {
+	resp, err := getJSON(apiBaseURL+"/sites/list", config)
 	if err != nil {
 		fmt.Printf("错误: %v\n", err)
 		os.Exit(1)
@@ -257,24 +314,89 @@ func handleList(apiBaseURL, username, password string, args []string) {
 	fmt.Println("\n网站列表:")
 	fmt.Println(strings.Repeat("-", 50))
 	for i, site := range sites {
-		if siteName, ok := site.(string); ok {
-			fmt.Printf("%d. %s\n", i+1, siteName)
+		siteMap, ok := site.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := siteMap["name"].(string)
+		url, _ := siteMap["url"].(string)
+		fmt.Printf("%d. %s  %s\n", i+1, name, url)
+		if desc, _ := siteMap["desc"].(string); desc != "" {
+			fmt.Printf("   描述: %s\n", desc)
+		}
+		if urls, ok := siteMap["urls"].([]interface{}); ok && len(urls) > 1 {
+			fmt.Printf("   访问地址: %s\n", joinList(urls))
+		}
+		if routing, _ := siteMap["routing"].(string); routing != "" {
+			fmt.Printf("   访问方式: %s\n", routingLabel(routing))
+		}
+		if domains, ok := siteMap["domains"].([]interface{}); ok && len(domains) > 0 {
+			fmt.Printf("   自定义域名: %s\n", joinList(domains))
+		}
+		if access, ok := siteMap["access"].(map[string]interface{}); ok {
+			if mode, _ := access["mode"].(string); mode != "" && mode != "public" {
+				fmt.Printf("   访问策略: %s\n", mode)
+			}
+		}
+		if retention, ok := siteMap["retention"].(map[string]interface{}); ok {
+			keepLast, _ := retention["keep_last"].(float64)
+			keepDays, _ := retention["keep_days"].(float64)
+			if keepLast > 0 || keepDays > 0 {
+				fmt.Printf("   版本保留: %s\n", formatRetention(int(keepLast), int(keepDays)))
+			}
+		}
+		if mode, _ := siteMap["not_found"].(string); mode != "" {
+			fmt.Printf("   404 处理: %s\n", notFoundModeLabel(mode))
+		}
+		if mode, _ := siteMap["path_rewrite"].(string); mode != "" {
+			fmt.Printf("   访问前缀: %s\n", pathRewriteLabel(mode))
+		}
+		if headers, ok := siteMap["headers"].([]interface{}); ok && len(headers) > 0 {
+			fmt.Printf("   响应头规则: %d 条\n", len(headers))
 		}
 	}
 	fmt.Println(strings.Repeat("-", 50))
 }
 
-func handleVersions(apiBaseURL, username, password string, args []string) {
+// joinList 拼接 JSON 数组中的字符串
+func joinList(items []interface{}) string {
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		if value, ok := item.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+func handleVersions(apiBaseURL string, config *ClientConfig, args []string) {
 	if len(args) < 1 {
 		fmt.Println("错误: 请提供网站名称")
-		fmt.Println("用法: deploy-cli versions <name>")
+		fmt.Println("用法: deploy-cli versions <name> [--limit 20] [--offset 0] [--author alice] [--grep 关键字] [--since 2025-01-01] [--until 2025-12-31]")
 		os.Exit(1)
 	}
 
 	name := args[0]
+	fs := flag.NewFlagSet("versions", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "每页数量（最多 100）")
+	offset := fs.Int("offset", 0, "跳过的版本数")
+	author := fs.String("author", "", "按作者筛选")
+	grep := fs.String("grep", "", "按提交说明筛选")
+	since := fs.String("since", "", "起始日期：2025-01-01 或 RFC3339")
+	until := fs.String("until", "", "截止日期：2025-12-31 或 RFC3339")
+	fs.Parse(args[1:])
+
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("limit", strconv.Itoa(*limit))
+	query.Set("offset", strconv.Itoa(*offset))
+	for key, value := range map[string]string{"author": *author, "q": *grep, "since": *since, "until": *until} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
 
-	url := fmt.Sprintf("%s/sites/versions?name=%s", apiBaseURL, name)
-	resp, err := getJSON(url, username, password)
+	resp, err := getJSON(apiBaseURL+"/sites/versions?"+query.Encode(), config)
 	if err != nil {
 		fmt.Printf("错误: %v\n", err)
 		os.Exit(1)
@@ -300,22 +422,51 @@ func handleVersions(apiBaseURL, username, password string, args []string) {
 		fmt.Println("暂无版本记录")
 	} else {
 		for i, v := range versions {
-			fmt.Printf("%d. %s\n", i+1, v["hash"])
+			fmt.Printf("%d. %s", *offset+i+1, v["hash"])
+			if tags, ok := v["tags"].([]interface{}); ok && len(tags) > 0 {
+				fmt.Printf("  [%s]", joinList(tags))
+			}
+			fmt.Println()
 			fmt.Printf("   提交: %s\n", v["message"])
 			fmt.Printf("   作者: %s\n", v["author"])
 			if date, ok := v["date"].(string); ok {
 				fmt.Printf("   日期: %s\n", date)
 			}
+			filesChanged, _ := v["files_changed"].(float64)
+			size, _ := v["size"].(float64)
+			fmt.Printf("   变更: %d 个文件，版本大小 %s\n", int(filesChanged), formatBytes(int64(size)))
+			if versionURL, ok := v["url"].(string); ok && versionURL != "" {
+				fmt.Printf("   访问: %s\n", versionURL)
+			}
 			fmt.Println()
 		}
 	}
 	fmt.Println(strings.Repeat("-", 80))
+	if total := resp.Header.Get("X-Total-Count"); total != "" {
+		fmt.Printf("共 %s 个版本", total)
+		if next := resp.Header.Get("X-Next-Offset"); next != "" {
+			fmt.Printf("，查看更多: deploy-cli versions %s --offset %s", name, next)
+		}
+		fmt.Println()
+	}
+}
+
+// formatBytes 格式化字节数
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
 }
 
-func handleRollback(apiBaseURL, username, password string, args []string) {
+func handleRollback(apiBaseURL string, config *ClientConfig, args []string) {
 	if len(args) < 2 {
-		fmt.Println("错误: 请提供网站名称和版本哈希")
-		fmt.Println("用法: deploy-cli rollback <name> <hash> [message]")
+		fmt.Println("错误: 请提供网站名称和版本哈希或标签")
+		fmt.Println("用法: deploy-cli rollback <name> <hash|tag> [message]")
 		os.Exit(1)
 	}
 
@@ -349,7 +500,7 @@ func handleRollback(apiBaseURL, username, password string, args []string) {
 		return
 	}
 
-	resp, err := postJSON(apiBaseURL+"/sites/rollback", data, username, password)
+	resp, err := postJSON(apiBaseURL+"/sites/rollback", data, config)
 	if err != nil {
 		fmt.Printf("错误: %v\n", err)
 		os.Exit(1)
@@ -366,11 +517,119 @@ func handleRollback(apiBaseURL, username, password string, args []string) {
 	fmt.Println("✓ 回滚成功!")
 }
 
+func handleDiff(apiBaseURL string, config *ClientConfig, args []string) {
+	statOnly := false
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "--stat" {
+			statOnly = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	if len(rest) < 2 {
+		fmt.Println("错误: 请提供网站名称和起始版本")
+		fmt.Println("用法: deploy-cli diff <name> <from> [to] [--stat]")
+		os.Exit(1)
+	}
+
+	name := rest[0]
+	url := fmt.Sprintf("%s/sites/diff?name=%s&from=%s", apiBaseURL, name, rest[1])
+	if len(rest) > 2 {
+		url += "&to=" + rest[2]
+	}
+
+	resp, err := getJSON(url, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("比较版本失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var diff struct {
+		From     string `json:"from"`
+		To       string `json:"to"`
+		Added    int    `json:"added"`
+		Modified int    `json:"modified"`
+		Deleted  int    `json:"deleted"`
+		Files    []struct {
+			Path     string `json:"path"`
+			Status   string `json:"status"`
+			Diff     string `json:"diff"`
+			TooLarge bool   `json:"too_large"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(body, &diff); err != nil {
+		fmt.Printf("解析响应失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\n网站 '%s' 版本差异: %s..%s\n", name, shortHash(diff.From), shortHash(diff.To))
+	fmt.Println(strings.Repeat("-", 80))
+	if len(diff.Files) == 0 {
+		fmt.Println("两个版本内容相同")
+	}
+	for _, f := range diff.Files {
+		marker := map[string]string{"added": "A", "modified": "M", "deleted": "D"}[f.Status]
+		note := ""
+		if f.TooLarge {
+			note = "（文件过大，未显示差异）"
+		}
+		fmt.Printf("%s  %s%s\n", marker, f.Path, note)
+	}
+	fmt.Println(strings.Repeat("-", 80))
+	fmt.Printf("新增 %d，修改 %d，删除 %d\n", diff.Added, diff.Modified, diff.Deleted)
+
+	if statOnly {
+		return
+	}
+	for _, f := range diff.Files {
+		if f.Diff != "" {
+			fmt.Println()
+			fmt.Print(f.Diff)
+		}
+	}
+}
+
+// shortHash 截取版本哈希前7位用于显示
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
 // handleDeploy 智能部署（自动选择增量或全量）
-func handleDeploy(apiBaseURL, username, password string, config *ClientConfig, args []string) {
+func handleDeploy(apiBaseURL string, config *ClientConfig, args []string) {
 	var name, dirPath string
 	message := "更新部署"
 
+	// 预览部署和标签选项可以出现在任意位置
+	previewLabel, args := extractOption(args, "--preview")
+	ttl, args := extractOption(args, "--ttl")
+	tag, args := extractOption(args, "--tag")
+	if tag != "" && previewLabel != "" {
+		fmt.Println("错误: 预览部署不能设置版本标签，请在提升为线上版本后使用 deploy-cli tag add")
+		os.Exit(1)
+	}
+	ttlHours := 0
+	if ttl != "" {
+		hours, err := strconv.Atoi(ttl)
+		if err != nil || hours <= 0 {
+			fmt.Printf("错误: 无效的预览有效期: %s（单位为小时）\n", ttl)
+			os.Exit(1)
+		}
+		ttlHours = hours
+	}
+
 	// 如果没有提供网站名称，尝试根据当前目录自动匹配
 	if len(args) < 1 {
 		matchedSites := findMatchingSites(config)
@@ -426,6 +685,15 @@ func handleDeploy(apiBaseURL, username, password string, config *ClientConfig, a
 
 	// 创建部署器
 	deployer := NewDeployer(apiBaseURL, name)
+	deployer.tag = tag
+
+	if previewLabel != "" {
+		if _, err := deployer.DeployPreview(dirPath, previewLabel, message, ttlHours); err != nil {
+			fmt.Printf("预览部署失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// 执行智能部署
 	if err := deployer.Deploy(dirPath, message); err != nil {
@@ -434,6 +702,24 @@ func handleDeploy(apiBaseURL, username, password string, config *ClientConfig, a
 	}
 }
 
+// extractOption 从参数中取出 "--name value" 或 "--name=value" 形式的选项，返回选项值和剩余参数
+func extractOption(args []string, name string) (string, []string) {
+	var value string
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == name && i+1 < len(args):
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], name+"="):
+			value = strings.TrimPrefix(args[i], name+"=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return value, rest
+}
+
 // findMatchingSites 根据当前目录查找匹配的网站
 // 匹配规则：
 // 1. 优先匹配：当前目录是网站路径的子路径
@@ -478,9 +764,10 @@ func findMatchingSites(config *ClientConfig) []string {
 }
 
 // handleDeployFull 全量部署
-func handleDeployFull(apiBaseURL, username, password string, config *ClientConfig, args []string) {
+func handleDeployFull(apiBaseURL string, config *ClientConfig, args []string) {
 	var name, dirPath string
 	message := "全量部署"
+	tag, args := extractOption(args, "--tag")
 
 	// 如果没有提供网站名称，尝试根据当前目录自动匹配
 	if len(args) < 1 {
@@ -535,6 +822,7 @@ func handleDeployFull(apiBaseURL, username, password string, config *ClientConfi
 
 	// 创建部署器
 	deployer := NewDeployer(apiBaseURL, name)
+	deployer.tag = tag
 
 	// 执行全量部署
 	if err := deployer.DeployFull(dirPath, message); err != nil {
@@ -544,9 +832,10 @@ func handleDeployFull(apiBaseURL, username, password string, config *ClientConfi
 }
 
 // handleDeployIncremental 增量部署
-func handleDeployIncremental(apiBaseURL, username, password string, config *ClientConfig, args []string) {
+func handleDeployIncremental(apiBaseURL string, config *ClientConfig, args []string) {
 	var name, dirPath string
 	message := "增量部署"
+	tag, args := extractOption(args, "--tag")
 
 	// 如果没有提供网站名称，尝试根据当前目录自动匹配
 	if len(args) < 1 {
@@ -601,6 +890,7 @@ func handleDeployIncremental(apiBaseURL, username, password string, config *Clie
 
 	// 创建部署器
 	deployer := NewDeployer(apiBaseURL, name)
+	deployer.tag = tag
 
 	// 执行增量部署
 	if err := deployer.DeployIncremental(dirPath, message); err != nil {
@@ -639,15 +929,13 @@ func printConfigHelp() {
 	fmt.Println("  deploy-cli config <sub-command> [arguments]")
 	fmt.Println("\n子命令:")
 	fmt.Println("  set server <url>      设置服务器地址")
-	fmt.Println("  set username <name>   设置用户名")
-	fmt.Println("  set password <pwd>    设置密码")
+	fmt.Println("  set username <name>   设置用户名（登录请使用 deploy-cli login）")
 	fmt.Println("  set site <name> <dir> 设置网站发布目录")
 	fmt.Println("  get                   查看当前配置")
 	fmt.Println("  remove site <name>    移除网站发布目录")
 	fmt.Println("\n示例:")
 	fmt.Println("  deploy-cli config set server http://192.168.1.100:8080/api")
 	fmt.Println("  deploy-cli config set username admin")
-	fmt.Println("  deploy-cli config set password admin123")
 	fmt.Println("  deploy-cli config set site my-prototype ./dist")
 	fmt.Println("  deploy-cli config set site my-project /path/to/dist")
 	fmt.Println("  deploy-cli config get")
@@ -658,7 +946,7 @@ func printConfigHelp() {
 func handleConfigSet(args []string) {
 	if len(args) < 1 {
 		fmt.Println("错误: 缺少参数")
-		fmt.Println("用法: deploy-cli config set <server|username|password|site> <value>")
+		fmt.Println("用法: deploy-cli config set <server|username|site> <value>")
 		os.Exit(1)
 	}
 
@@ -699,13 +987,9 @@ func handleConfigSet(args []string) {
 		fmt.Printf("✓ 用户名已设置为: %s\n", args[1])
 
 	case "password":
-		if len(args) < 2 {
-			fmt.Println("错误: 请提供密码")
-			fmt.Println("用法: deploy-cli config set password <pwd>")
-			os.Exit(1)
-		}
-		config.Password = args[1]
-		fmt.Println("✓ 密码已设置")
+		fmt.Println("错误: 客户端不再保存密码")
+		fmt.Println("请使用: deploy-cli login [username]")
+		os.Exit(1)
 
 	case "site":
 		if len(args) < 3 {
@@ -741,7 +1025,7 @@ func handleConfigSet(args []string) {
 
 	default:
 		fmt.Printf("错误: 未知的配置项 '%s'\n", key)
-		fmt.Println("支持的配置项: server, username, password, site")
+		fmt.Println("支持的配置项: server, username, site")
 		os.Exit(1)
 	}
 
@@ -818,10 +1102,10 @@ func handleConfigGet() {
 		fmt.Printf("用户名:     %s\n", config.Username)
 	}
 
-	if config.Password == "" {
-		fmt.Println("密码:       （未设置）")
+	if config.AccessToken == "" {
+		fmt.Println("登录状态:   未登录（使用 deploy-cli login 登录）")
 	} else {
-		fmt.Println("密码:       ******")
+		fmt.Printf("登录状态:   已登录（令牌有效期至 %s，到期自动续期）\n", config.TokenExpiresAt.Local().Format("2006-01-02 15:04:05"))
 	}
 
 	// 显示网站目录配置
@@ -844,7 +1128,7 @@ func handleConfigGet() {
 }
 
 // handlePull 从服务器覆盖本地
-func handlePull(apiBaseURL, username, password string, config *ClientConfig, args []string) {
+func handlePull(apiBaseURL string, config *ClientConfig, args []string) {
 	var name, dirPath string
 
 	// 如果没有提供网站名称，尝试根据当前目录自动匹配
@@ -910,3 +1194,1107 @@ func handlePull(apiBaseURL, username, password string, config *ClientConfig, arg
 		os.Exit(1)
 	}
 }
+
+// handleLogin 登录服务器
+func handleLogin(config *ClientConfig, args []string) {
+	reader := bufio.NewReader(os.Stdin)
+
+	username := config.Username
+	if len(args) >= 1 {
+		username = args[0]
+	}
+	if username == "" {
+		fmt.Print("用户名: ")
+		input, _ := reader.ReadString('\n')
+		username = strings.TrimSpace(input)
+	}
+
+	// 支持通过环境变量传入密码，便于脚本使用
+	password := os.Getenv("AIDEPLOY_PASSWORD")
+	if password == "" {
+		fmt.Print("密码: ")
+		input, _ := reader.ReadString('\n')
+		password = strings.TrimSpace(input)
+	}
+
+	if username == "" || password == "" {
+		fmt.Println("错误: 用户名和密码不能为空")
+		os.Exit(1)
+	}
+
+	tokens, err := Login(config, username, password)
+	if err != nil {
+		fmt.Printf("登录失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ 登录成功: %s\n", tokens.User.Name)
+	if tokens.User.MustChangePassword {
+		fmt.Println("提示: 当前账号使用默认密码，必须先修改密码才能继续操作")
+		fmt.Println("请执行: deploy-cli passwd")
+	}
+}
+
+// handleLogout 退出登录
+func handleLogout(config *ClientConfig) {
+	if err := Logout(config); err != nil {
+		fmt.Printf("警告: 注销服务器会话失败: %v\n", err)
+	}
+	fmt.Println("✓ 已退出登录")
+}
+
+// handlePasswd 修改当前用户密码
+func handlePasswd(config *ClientConfig) {
+	if config.AccessToken == "" {
+		fmt.Println("错误: 尚未登录，请先执行 deploy-cli login")
+		os.Exit(1)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Print("原密码: ")
+	oldPassword, _ := reader.ReadString('\n')
+	oldPassword = strings.TrimSpace(oldPassword)
+
+	fmt.Print("新密码: ")
+	newPassword, _ := reader.ReadString('\n')
+	newPassword = strings.TrimSpace(newPassword)
+
+	fmt.Print("确认新密码: ")
+	confirmPassword, _ := reader.ReadString('\n')
+	confirmPassword = strings.TrimSpace(confirmPassword)
+
+	if newPassword != confirmPassword {
+		fmt.Println("错误: 两次输入的新密码不一致")
+		os.Exit(1)
+	}
+
+	if err := ChangePassword(config, oldPassword, newPassword); err != nil {
+		fmt.Printf("修改密码失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("✓ 密码修改成功")
+}
+
+// handleToken 管理部署令牌
+func handleToken(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 1 {
+		printTokenUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "create":
+		handleTokenCreate(apiBaseURL, config, args[1:])
+	case "list":
+		handleTokenList(apiBaseURL, config)
+	case "revoke":
+		handleTokenRevoke(apiBaseURL, config, args[1:])
+	default:
+		fmt.Printf("未知子命令: %s\n", args[0])
+		printTokenUsage()
+		os.Exit(1)
+	}
+}
+
+func printTokenUsage() {
+	fmt.Println("用法: deploy-cli token <subcommand> [arguments]")
+	fmt.Println("\n子命令:")
+	fmt.Println("  create <name> [--sites a,b] [--actions deploy,rollback,read] [--expires 30d]")
+	fmt.Println("                        创建部署令牌（不指定网站表示自己有权限的全部网站）")
+	fmt.Println("  list                  列出部署令牌")
+	fmt.Println("  revoke <id>           吊销部署令牌")
+	fmt.Println("\n过期时间支持: 30d、12h 或日期 2025-12-31，不指定表示永不过期")
+}
+
+func handleTokenCreate(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("错误: 请提供令牌名称")
+		printTokenUsage()
+		os.Exit(1)
+	}
+
+	name := args[0]
+	fs := flag.NewFlagSet("token create", flag.ExitOnError)
+	sites := fs.String("sites", "", "允许的网站，逗号分隔")
+	actions := fs.String("actions", "deploy", "允许的操作，逗号分隔：deploy、rollback、read")
+	expires := fs.String("expires", "", "过期时间：30d、12h 或 2025-12-31")
+	fs.Parse(args[1:])
+
+	payload := map[string]interface{}{
+		"name":    name,
+		"sites":   splitList(*sites),
+		"actions": splitList(*actions),
+	}
+
+	if *expires != "" {
+		expiresAt, err := parseExpiry(*expires)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+		payload["expires_at"] = expiresAt
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/tokens/create", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("创建令牌失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var result struct {
+		Token string          `json:"token"`
+		Info  DeployTokenInfo `json:"info"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		fmt.Printf("解析响应失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("✓ 部署令牌创建成功（令牌只显示这一次，请妥善保存）:")
+	fmt.Printf("\n  %s\n\n", result.Token)
+	printTokenInfo(result.Info)
+	fmt.Println("\n在 CI 中设置环境变量 AIDEPLOY_TOKEN 即可使用")
+}
+
+func handleTokenList(apiBaseURL string, config *ClientConfig) {
+	resp, err := getJSON(apiBaseURL+"/tokens/list", config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("获取令牌失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var result struct {
+		Tokens []DeployTokenInfo `json:"tokens"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		fmt.Printf("解析响应失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("\n部署令牌:")
+	fmt.Println(strings.Repeat("-", 60))
+	if len(result.Tokens) == 0 {
+		fmt.Println("暂无部署令牌")
+	}
+	for i, token := range result.Tokens {
+		if i > 0 {
+			fmt.Println()
+		}
+		printTokenInfo(token)
+	}
+	fmt.Println(strings.Repeat("-", 60))
+}
+
+func handleTokenRevoke(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 1 {
+		fmt.Println("错误: 请提供令牌ID")
+		fmt.Println("用法: deploy-cli token revoke <id>")
+		os.Exit(1)
+	}
+
+	data, err := json.Marshal(map[string]string{"id": args[0]})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/tokens/revoke", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("吊销令牌失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	fmt.Println("✓ 令牌已吊销")
+}
+
+// printTokenInfo 打印令牌信息
+func printTokenInfo(token DeployTokenInfo) {
+	sites := "全部网站"
+	if len(token.Sites) > 0 {
+		sites = strings.Join(token.Sites, ", ")
+	}
+	expires := "永不过期"
+	if token.ExpiresAt != nil {
+		expires = token.ExpiresAt.Local().Format("2006-01-02 15:04:05")
+	}
+	if token.Expired {
+		expires += "（已过期）"
+	}
+
+	fmt.Printf("ID: %s  名称: %s  所属用户: %s\n", token.ID, token.Name, token.Owner)
+	fmt.Printf("   网站: %s\n", sites)
+	fmt.Printf("   操作: %s\n", strings.Join(token.Actions, ", "))
+	fmt.Printf("   过期: %s\n", expires)
+}
+
+// splitList 拆分逗号分隔的列表
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseExpiry 解析过期时间：30d、12h 或日期
+func parseExpiry(value string) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err == nil && days > 0 {
+			return time.Now().AddDate(0, 0, days), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return time.Now().Add(d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("无法解析过期时间: %s", value)
+}
+
+func handlePreview(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 1 {
+		printPreviewUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		handlePreviewList(apiBaseURL, config, args[1:])
+	case "promote":
+		handlePreviewPromote(apiBaseURL, config, args[1:])
+	case "delete":
+		handlePreviewDelete(apiBaseURL, config, args[1:])
+	default:
+		fmt.Printf("未知子命令: %s\n", args[0])
+		printPreviewUsage()
+		os.Exit(1)
+	}
+}
+
+func printPreviewUsage() {
+	fmt.Println("用法: deploy-cli preview <subcommand> [arguments]")
+	fmt.Println("\n子命令:")
+	fmt.Println("  list <name>              列出网站的预览部署")
+	fmt.Println("  promote <name> <label>   将预览提升为线上版本")
+	fmt.Println("  delete <name> <label>    删除预览部署")
+	fmt.Println("\n创建预览: deploy-cli deploy <name> [dir] --preview <label> [--ttl 小时]")
+}
+
+func handlePreviewList(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 1 {
+		fmt.Println("错误: 请提供网站名称")
+		fmt.Println("用法: deploy-cli preview list <name>")
+		os.Exit(1)
+	}
+
+	resp, err := getJSON(fmt.Sprintf("%s/sites/previews?name=%s", apiBaseURL, args[0]), config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("获取预览列表失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var result struct {
+		Previews []struct {
+			Label     string    `json:"label"`
+			Message   string    `json:"message"`
+			CreatedBy string    `json:"created_by"`
+			CreatedAt time.Time `json:"created_at"`
+			ExpiresAt time.Time `json:"expires_at"`
+			URL       string    `json:"url"`
+			Expired   bool      `json:"expired"`
+		} `json:"previews"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		fmt.Printf("解析响应失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(result.Previews) == 0 {
+		fmt.Println("没有预览部署")
+		return
+	}
+
+	fmt.Printf("\n%s 的预览部署:\n", args[0])
+	fmt.Println(strings.Repeat("-", 50))
+	for _, preview := range result.Previews {
+		status := ""
+		if preview.Expired {
+			status = " (已过期)"
+		}
+		fmt.Printf("%s%s  %s\n", preview.Label, status, preview.URL)
+		fmt.Printf("   说明: %s  部署人: %s\n", preview.Message, preview.CreatedBy)
+		fmt.Printf("   部署时间: %s  过期时间: %s\n",
+			preview.CreatedAt.Local().Format("2006-01-02 15:04"),
+			preview.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+	fmt.Println(strings.Repeat("-", 50))
+}
+
+func handlePreviewPromote(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 2 {
+		fmt.Println("错误: 请提供网站名称和预览标签")
+		fmt.Println("用法: deploy-cli preview promote <name> <label> [message]")
+		os.Exit(1)
+	}
+
+	payload := map[string]string{
+		"name":  args[0],
+		"label": args[1],
+	}
+	if len(args) > 2 {
+		payload["message"] = strings.Join(args[2:], " ")
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/promote", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("提升预览失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var result DeployResult
+	json.Unmarshal(body, &result)
+	fmt.Printf("✓ 预览 %s 已上线! (新增: %d, 替换: %d, 移除: %d, 未变: %d)\n", args[1], result.Added, result.Replaced, result.Removed, result.Unchanged)
+}
+
+func handlePreviewDelete(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 2 {
+		fmt.Println("错误: 请提供网站名称和预览标签")
+		fmt.Println("用法: deploy-cli preview delete <name> <label>")
+		os.Exit(1)
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"name":  args[0],
+		"label": args[1],
+	})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/previews/delete", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("删除预览失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	fmt.Println("✓ 预览已删除")
+}
+
+func printAccessUsage() {
+	fmt.Println("用法: deploy-cli access <name> <mode> [options]")
+	fmt.Println("\n访问策略:")
+	fmt.Println("  public                          公开访问")
+	fmt.Println("  password [--password xxx]       访问时需要输入密码（HTTP Basic，不指定时沿用原密码）")
+	fmt.Println("  link [--expires 7d] [--regenerate]")
+	fmt.Println("                                  持有分享链接才能访问，--regenerate 使旧链接失效")
+	fmt.Println("  users                           仅网站授权用户登录后访问")
+}
+
+func handleAccess(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 2 {
+		printAccessUsage()
+		os.Exit(1)
+	}
+
+	name, mode := args[0], args[1]
+	fs := flag.NewFlagSet("access", flag.ExitOnError)
+	password := fs.String("password", "", "访问密码（password 策略）")
+	expires := fs.String("expires", "", "分享链接过期时间：7d、12h 或 2025-12-31（link 策略）")
+	regenerate := fs.Bool("regenerate", false, "重新生成分享链接（link 策略）")
+	fs.Parse(args[2:])
+
+	access := map[string]interface{}{
+		"mode":            mode,
+		"password":        *password,
+		"regenerate_link": *regenerate,
+	}
+	if *expires != "" {
+		expiresAt, err := parseExpiry(*expires)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+		access["link_expires_at"] = expiresAt
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"name":   name,
+		"access": access,
+	})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/update", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("设置访问策略失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var result struct {
+		Access struct {
+			Mode          string     `json:"mode"`
+			ShareURL      string     `json:"share_url"`
+			LinkExpiresAt *time.Time `json:"link_expires_at"`
+		} `json:"access"`
+	}
+	json.Unmarshal(body, &result)
+
+	fmt.Printf("✓ 网站 %s 的访问策略已设置为: %s\n", name, result.Access.Mode)
+	if result.Access.ShareURL != "" {
+		fmt.Printf("  分享链接: %s\n", result.Access.ShareURL)
+		if result.Access.LinkExpiresAt != nil {
+			fmt.Printf("  过期时间: %s\n", result.Access.LinkExpiresAt.Local().Format("2006-01-02 15:04"))
+		}
+	}
+}
+
+// formatRetention 格式化版本保留策略
+func formatRetention(keepLast, keepDays int) string {
+	var rules []string
+	if keepLast > 0 {
+		rules = append(rules, fmt.Sprintf("最近 %d 个版本", keepLast))
+	}
+	if keepDays > 0 {
+		rules = append(rules, fmt.Sprintf("最近 %d 天", keepDays))
+	}
+	if len(rules) == 0 {
+		return "全部版本"
+	}
+	return strings.Join(rules, " + ")
+}
+
+func handleRetention(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 1 {
+		fmt.Println("错误: 请提供网站名称")
+		fmt.Println("用法: deploy-cli retention <name> [--keep-last 10] [--keep-days 30] [--inherit]")
+		fmt.Println("  满足任一条件的版本都会保留，当前版本始终保留；两项都为 0 表示保留全部版本")
+		fmt.Println("  --inherit 删除网站单独的策略，改用服务器全局策略")
+		os.Exit(1)
+	}
+
+	name := args[0]
+	fs := flag.NewFlagSet("retention", flag.ExitOnError)
+	keepLast := fs.Int("keep-last", 0, "保留最近 N 个版本")
+	keepDays := fs.Int("keep-days", 0, "保留最近 N 天内的全部版本")
+	inherit := fs.Bool("inherit", false, "使用服务器全局策略")
+	fs.Parse(args[1:])
+
+	data, err := json.Marshal(map[string]interface{}{
+		"name": name,
+		"retention": map[string]interface{}{
+			"keep_last": *keepLast,
+			"keep_days": *keepDays,
+			"inherit":   *inherit,
+		},
+	})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/update", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("设置版本保留策略失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	if *inherit {
+		fmt.Printf("✓ 网站 %s 已改用全局版本保留策略\n", name)
+		return
+	}
+	fmt.Printf("✓ 网站 %s 的版本保留策略已设置为: %s\n", name, formatRetention(*keepLast, *keepDays))
+}
+
+func handlePrune(apiBaseURL string, config *ClientConfig, args []string) {
+	payload := map[string]interface{}{}
+	if len(args) > 0 {
+		payload["name"] = args[0]
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/admin/prune", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("清理失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var report struct {
+		Sites []struct {
+			Name   string `json:"name"`
+			Pruned int    `json:"pruned"`
+			Kept   int    `json:"kept"`
+			Error  string `json:"error"`
+		} `json:"sites"`
+		Pruned int `json:"pruned"`
+		GC     struct {
+			RemovedObjects int   `json:"removed_objects"`
+			FreedBytes     int64 `json:"freed_bytes"`
+			Objects        int   `json:"objects"`
+			Bytes          int64 `json:"bytes"`
+		} `json:"gc"`
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		fmt.Printf("解析响应失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, site := range report.Sites {
+		if site.Error != "" {
+			fmt.Printf("  %s: 失败 %s\n", site.Name, site.Error)
+			continue
+		}
+		fmt.Printf("  %s: 删除 %d 个版本，保留 %d 个\n", site.Name, site.Pruned, site.Kept)
+	}
+	fmt.Printf("✓ 清理完成: 删除 %d 个版本，回收 %d 个文件，释放 %s（剩余 %d 个文件，%s）\n",
+		report.Pruned, report.GC.RemovedObjects, formatBytes(report.GC.FreedBytes),
+		report.GC.Objects, formatBytes(report.GC.Bytes))
+}
+
+func handleHeaders(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 1 {
+		fmt.Println("错误: 请提供网站名称")
+		fmt.Println("用法: deploy-cli headers <name> [--file headers.json] [--clear]")
+		fmt.Println("  不带参数时显示网站设置中的响应头规则")
+		fmt.Println("  --file 从 JSON 文件设置规则，格式: [{\"path\": \"/assets/*\", \"headers\": {\"Cache-Control\": \"public, max-age=31536000, immutable\"}}]")
+		fmt.Println("  --clear 清除网站设置中的规则（部署内容中的 _headers 文件不受影响）")
+		os.Exit(1)
+	}
+
+	name := args[0]
+	fs := flag.NewFlagSet("headers", flag.ExitOnError)
+	file := fs.String("file", "", "响应头规则 JSON 文件")
+	clear := fs.Bool("clear", false, "清除响应头规则")
+	fs.Parse(args[1:])
+
+	if *file == "" && !*clear {
+		showHeaders(apiBaseURL, config, name)
+		return
+	}
+
+	rules := []interface{}{}
+	if *file != "" {
+		content, err := os.ReadFile(*file)
+		if err != nil {
+			fmt.Printf("读取规则文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		if err := json.Unmarshal(content, &rules); err != nil {
+			fmt.Printf("解析规则文件失败: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"name":    name,
+		"headers": rules,
+	})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/update", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("设置响应头规则失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	if len(rules) == 0 {
+		fmt.Printf("✓ 网站 %s 的响应头规则已清除\n", name)
+		return
+	}
+	fmt.Printf("✓ 网站 %s 已设置 %d 条响应头规则\n", name, len(rules))
+}
+
+// showHeaders 显示网站设置中的响应头规则
+func showHeaders(apiBaseURL string, config *ClientConfig, name string) {
+	resp, err := getJSON(apiBaseURL+"/sites/list", config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("获取网站信息失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var result struct {
+		Sites []struct {
+			Name    string `json:"name"`
+			Headers []struct {
+				Path    string            `json:"path"`
+				Headers map[string]string `json:"headers"`
+			} `json:"headers"`
+		} `json:"sites"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		fmt.Printf("解析响应失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, site := range result.Sites {
+		if site.Name != name {
+			continue
+		}
+		if len(site.Headers) == 0 {
+			fmt.Printf("网站 %s 没有设置响应头规则（部署内容中的 _headers 文件仍然生效）\n", name)
+			return
+		}
+		fmt.Printf("\n网站 %s 的响应头规则:\n", name)
+		for _, rule := range site.Headers {
+			fmt.Println(rule.Path)
+			keys := make([]string, 0, len(rule.Headers))
+			for key := range rule.Headers {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("  %s: %s\n", key, rule.Headers[key])
+			}
+		}
+		return
+	}
+	fmt.Printf("网站 %s 不存在\n", name)
+	os.Exit(1)
+}
+
+func handleTag(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 1 {
+		printTagUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		handleTagList(apiBaseURL, config, args[1:])
+	case "add":
+		handleTagAdd(apiBaseURL, config, args[1:])
+	case "delete":
+		handleTagDelete(apiBaseURL, config, args[1:])
+	default:
+		fmt.Printf("未知子命令: %s\n", args[0])
+		printTagUsage()
+		os.Exit(1)
+	}
+}
+
+func printTagUsage() {
+	fmt.Println("用法: deploy-cli tag <subcommand> [arguments]")
+	fmt.Println("\n子命令:")
+	fmt.Println("  list <name>                          列出网站的版本标签")
+	fmt.Println("  add <name> <tag> [version] [--force] 为版本设置标签（version 默认为当前版本，--force 移动已有标签）")
+	fmt.Println("  delete <name> <tag>                  删除版本标签")
+	fmt.Println("\n部署时设置标签: deploy-cli deploy <name> [dir] --tag <tag>")
+	fmt.Println("带标签的版本不会被保留策略清理，回滚时可以直接使用标签: deploy-cli rollback <name> <tag>")
+}
+
+func handleTagList(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 1 {
+		fmt.Println("错误: 请提供网站名称")
+		fmt.Println("用法: deploy-cli tag list <name>")
+		os.Exit(1)
+	}
+
+	resp, err := getJSON(fmt.Sprintf("%s/sites/tags?name=%s", apiBaseURL, url.QueryEscape(args[0])), config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("获取标签失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var tags []struct {
+		Tag     string `json:"tag"`
+		Hash    string `json:"hash"`
+		Version *struct {
+			Message string    `json:"message"`
+			Author  string    `json:"author"`
+			Date    time.Time `json:"date"`
+			URL     string    `json:"url"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(body, &tags); err != nil {
+		fmt.Printf("解析响应失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(tags) == 0 {
+		fmt.Println("暂无版本标签")
+		return
+	}
+	for _, tag := range tags {
+		fmt.Printf("%s  %s\n", tag.Tag, shortHash(tag.Hash))
+		if tag.Version != nil {
+			fmt.Printf("   提交: %s  作者: %s  日期: %s\n", tag.Version.Message, tag.Version.Author,
+				tag.Version.Date.Local().Format("2006-01-02 15:04"))
+			fmt.Printf("   访问: %s\n", tag.Version.URL)
+		}
+	}
+}
+
+func handleTagAdd(apiBaseURL string, config *ClientConfig, args []string) {
+	force := false
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "--force" {
+			force = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	if len(rest) < 2 {
+		fmt.Println("错误: 请提供网站名称和标签")
+		fmt.Println("用法: deploy-cli tag add <name> <tag> [version] [--force]")
+		os.Exit(1)
+	}
+
+	payload := map[string]interface{}{
+		"name":  rest[0],
+		"tag":   rest[1],
+		"force": force,
+	}
+	if len(rest) > 2 {
+		payload["version"] = rest[2]
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/tags/create", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("设置标签失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var result struct {
+		Hash string `json:"hash"`
+		URL  string `json:"url"`
+	}
+	json.Unmarshal(body, &result)
+	fmt.Printf("✓ 已为版本 %s 设置标签 %s\n", shortHash(result.Hash), rest[1])
+	if result.URL != "" {
+		fmt.Printf("  访问: %s\n", result.URL)
+	}
+}
+
+func handleTagDelete(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 2 {
+		fmt.Println("错误: 请提供网站名称和标签")
+		fmt.Println("用法: deploy-cli tag delete <name> <tag>")
+		os.Exit(1)
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"name": args[0],
+		"tag":  args[1],
+	})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/tags/delete", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("删除标签失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ 标签 %s 已删除\n", args[1])
+}
+
+// notFoundModeLabel 404 处理方式的说明
+func notFoundModeLabel(mode string) string {
+	switch mode {
+	case "spa":
+		return "返回 index.html（单页应用）"
+	case "strict":
+		return "直接返回 404"
+	case "custom":
+		return "返回 404.html"
+	}
+	return "自动（有 404.html 时返回 404.html，否则返回 index.html）"
+}
+
+func handleNotFound(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 2 {
+		fmt.Println("错误: 请提供网站名称和处理方式")
+		fmt.Println("用法: deploy-cli notfound <name> <auto|spa|strict|custom>")
+		fmt.Println("  auto    有 404.html 时返回 404.html（状态码 404），否则返回 index.html（默认）")
+		fmt.Println("  spa     返回 index.html，用于单页应用的前端路由")
+		fmt.Println("  strict  直接返回 404")
+		fmt.Println("  custom  返回网站的 404.html，状态码 404")
+		os.Exit(1)
+	}
+
+	name, mode := args[0], args[1]
+	if mode == "auto" {
+		mode = ""
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"name":      name,
+		"not_found": mode,
+	})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/update", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("设置 404 处理方式失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ 网站 %s 的 404 处理方式已设置为: %s\n", name, notFoundModeLabel(mode))
+}
+
+// pathRewriteLabel 路径模式下访问前缀处理方式的说明
+func pathRewriteLabel(mode string) string {
+	switch mode {
+	case "base":
+		return "在 HTML 中注入 <base href>"
+	case "rewrite":
+		return "改写 HTML/CSS 中以 / 开头的地址"
+	}
+	return "不处理"
+}
+
+func handleBasePath(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 2 {
+		fmt.Println("错误: 请提供网站名称和处理方式")
+		fmt.Println("用法: deploy-cli basepath <name> <off|base|rewrite>")
+		fmt.Println("  off      不处理（默认）")
+		fmt.Println("  base     在 HTML 中注入 <base href=\"/<name>/\">，已有的 <base> 加上访问前缀")
+		fmt.Println("  rewrite  将 HTML/CSS 中以 / 开头的地址改写为 /<name>/...")
+		fmt.Println("只在路径模式（/<name>/ 访问）下生效；开启后，缺少前缀的资源请求会根据 Referer 重定向到网站")
+		os.Exit(1)
+	}
+
+	name, mode := args[0], args[1]
+	if mode == "off" {
+		mode = ""
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"name":         name,
+		"path_rewrite": mode,
+	})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/update", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("设置访问前缀处理方式失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ 网站 %s 的访问前缀处理方式已设置为: %s\n", name, pathRewriteLabel(mode))
+}
+
+// routingLabel 混合模式下网站访问方式的说明
+func routingLabel(routing string) string {
+	switch routing {
+	case "subdomain":
+		return "仅子域名"
+	case "path":
+		return "仅路径"
+	}
+	return "子域名和路径"
+}
+
+func handleRouting(apiBaseURL string, config *ClientConfig, args []string) {
+	if len(args) < 2 {
+		fmt.Println("错误: 请提供网站名称和访问方式")
+		fmt.Println("用法: deploy-cli routing <name> <both|subdomain|path>")
+		fmt.Println("  both       <name>.base_domain 和 single_domain/<name> 都可以访问（默认）")
+		fmt.Println("  subdomain  只能通过 <name>.base_domain 访问")
+		fmt.Println("  path       只能通过 single_domain/<name> 访问")
+		fmt.Println("只在服务端配置为混合模式（mode: hybrid）时生效")
+		os.Exit(1)
+	}
+
+	name, routing := args[0], args[1]
+	if routing == "both" {
+		routing = ""
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"name":    name,
+		"routing": routing,
+	})
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := postJSON(apiBaseURL+"/sites/update", data, config)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("设置访问方式失败: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ 网站 %s 的访问方式已设置为: %s\n", name, routingLabel(routing))
+}
@@ -10,9 +10,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -51,31 +54,28 @@ func main() {
 type App struct {
 	ctx        context.Context
 	apiBaseURL string
-	username   string
-	password   string
 	config     *ClientConfig
 }
 
 // NewApp 创建应用实例
 func NewApp() *App {
-	// 从配置文件加载服务端地址和用户名/密码
+	// 从配置文件加载服务端地址和登录令牌
 	config, err := LoadConfig()
 	apiBaseURL := "http://localhost:8080/api"
-	username := ""
-	password := ""
 
 	if err == nil {
 		if config.ServerURL != "" {
 			apiBaseURL = config.ServerURL
 		}
-		username = config.Username
-		password = config.Password
+	} else {
+		config = &ClientConfig{
+			ServerURL: apiBaseURL,
+			SitePaths: make(map[string]string),
+		}
 	}
 
 	return &App{
 		apiBaseURL: apiBaseURL,
-		username:   username,
-		password:   password,
 		config:     config,
 	}
 }
@@ -136,19 +136,84 @@ type Website struct {
 
 // Version 版本信息
 type Version struct {
-	Hash    string `json:"hash"`
-	Message string `json:"message"`
-	Author  string `json:"author"`
-	Date    string `json:"date"`
+	Hash         string `json:"hash"`
+	Message      string `json:"message"`
+	Author       string `json:"author"`
+	Date         string `json:"date"`
+	FilesChanged int    `json:"files_changed"`
+	Size         int64  `json:"size"`
+	URL          string   `json:"url"`
+	Tags         []string `json:"tags"`
+}
+
+// VersionPage 一页版本列表
+type VersionPage struct {
+	Versions   []Version `json:"versions"`
+	Total      int       `json:"total"`
+	NextOffset int       `json:"next_offset"` // 没有更多版本时为 -1
+}
+
+// FileDiff 单个文件的差异
+type FileDiff struct {
+	Path     string `json:"path"`
+	Status   string `json:"status"`
+	Diff     string `json:"diff"`
+	TooLarge bool   `json:"too_large"`
+}
+
+// VersionDiff 两个版本之间的差异
+type VersionDiff struct {
+	From     string     `json:"from"`
+	To       string     `json:"to"`
+	Added    int        `json:"added"`
+	Modified int        `json:"modified"`
+	Deleted  int        `json:"deleted"`
+	Files    []FileDiff `json:"files"`
+}
+
+// addAuthToRequest 添加访问令牌到请求头（即将过期时自动刷新）
+func (a *App) addAuthToRequest(req *http.Request) error {
+	return a.config.AddAuthHeader(req)
+}
+
+// LoginResult 登录结果
+type LoginResult struct {
+	Username           string `json:"username"`
+	IsAdmin            bool   `json:"isAdmin"`
+	MustChangePassword bool   `json:"mustChangePassword"`
 }
 
-// addAuthToRequest 添加认证信息到请求头
-func (a *App) addAuthToRequest(req *http.Request) {
-	// 优先使用用户名/密码认证
-	if a.username != "" && a.password != "" {
-		req.Header.Set("X-Username", a.username)
-		req.Header.Set("X-Password", a.password)
+// Login 登录服务器，保存令牌（不保存密码）
+func (a *App) Login(username, password string) (*LoginResult, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("用户名和密码不能为空")
+	}
+
+	tokens, err := Login(a.config, username, password)
+	if err != nil {
+		return nil, err
 	}
+
+	return &LoginResult{
+		Username:           tokens.User.Name,
+		IsAdmin:            tokens.User.IsAdmin,
+		MustChangePassword: tokens.User.MustChangePassword,
+	}, nil
+}
+
+// ChangePassword 修改当前登录用户的密码
+func (a *App) ChangePassword(oldPassword, newPassword string) error {
+	return ChangePassword(a.config, oldPassword, newPassword)
+}
+
+// Logout 退出登录
+func (a *App) Logout() error {
+	return Logout(a.config)
+}
+
+// IsLoggedIn 是否已登录
+func (a *App) IsLoggedIn() bool {
+	return a.config.AccessToken != ""
 }
 
 // CreateSite 创建网站
@@ -165,7 +230,9 @@ func (a *App) CreateSite(name, desc string) (*Website, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return nil, err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -201,7 +268,9 @@ func (a *App) DeleteSite(name string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -219,11 +288,18 @@ func (a *App) DeleteSite(name string) error {
 }
 
 // UpdateSite 更新网站信息
-func (a *App) UpdateSite(name, desc string, users []string) error {
+func (a *App) UpdateSite(name, desc string, users []string, domains []string, notFound, pathRewrite, routing string) error {
+	if domains == nil {
+		domains = []string{}
+	}
 	payload := map[string]interface{}{
-		"name":   name,
-		"desc":   desc,
-		"users":  users,
+		"name":         name,
+		"desc":         desc,
+		"users":        users,
+		"domains":      domains,
+		"not_found":    notFound,
+		"path_rewrite": pathRewrite,
+		"routing":      routing,
 	}
 
 	data, _ := json.Marshal(payload)
@@ -233,7 +309,9 @@ func (a *App) UpdateSite(name, desc string, users []string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -276,6 +354,20 @@ type SiteInfo struct {
 	Desc   string   `json:"desc"`
 	URL    string   `json:"url"`
 	Users  []string `json:"users"`
+	Domains []string `json:"domains"`
+	Access SiteAccessInfo `json:"access"`
+	NotFound string `json:"not_found"` // 404 处理方式，为空表示自动
+	PathRewrite string `json:"path_rewrite"` // 路径模式下访问前缀的处理方式，为空表示不处理
+	Routing string `json:"routing"` // 混合模式下的访问方式，为空表示两种方式都可以
+	URLs []string `json:"urls"` // 所有访问地址
+}
+
+// SiteAccessInfo 网站访问策略
+type SiteAccessInfo struct {
+	Mode          string `json:"mode"`            // public、password、link、users
+	HasPassword   bool   `json:"has_password"`    // 是否已设置访问密码
+	ShareURL      string `json:"share_url"`       // 分享链接
+	LinkExpiresAt string `json:"link_expires_at"` // 分享链接过期时间
 }
 
 // ListSites 列出所有网站
@@ -285,7 +377,9 @@ func (a *App) ListSites() ([]SiteInfo, error) {
 		return nil, err
 	}
 
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return nil, err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -328,12 +422,33 @@ func (a *App) ListSites() ([]SiteInfo, error) {
 				}
 			}
 
+			// 解析自定义域名
+			var domains []string
+			if domainsInterface, ok := siteMap["domains"].([]interface{}); ok {
+				for _, d := range domainsInterface {
+					if domainStr, ok := d.(string); ok {
+						domains = append(domains, domainStr)
+					}
+				}
+			}
+
+			// 解析访问策略
+			var access SiteAccessInfo
+			if accessData, err := json.Marshal(siteMap["access"]); err == nil {
+				json.Unmarshal(accessData, &access)
+			}
+			if access.Mode == "" {
+				access.Mode = "public"
+			}
+
 			siteList = append(siteList, SiteInfo{
 				Name:   name,
 				Domain: domain,
 				Desc:   desc,
 				URL:    url,
 				Users:  users,
+				Domains: domains,
+				Access: access,
 			})
 		}
 	}
@@ -341,15 +456,28 @@ func (a *App) ListSites() ([]SiteInfo, error) {
 	return siteList, nil
 }
 
-// GetVersions 获取版本列表
-func (a *App) GetVersions(name string) ([]Version, error) {
-	url := fmt.Sprintf("%s/sites/versions?name=%s", a.apiBaseURL, name)
-	req, err := http.NewRequest("GET", url, nil)
+// GetVersions 分页获取版本列表，author、keyword、since、until 为空表示不筛选
+func (a *App) GetVersions(name string, offset, limit int, author, keyword, since, until string) (*VersionPage, error) {
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("offset", strconv.Itoa(offset))
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	for key, value := range map[string]string{"author": author, "q": keyword, "since": since, "until": until} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	req, err := http.NewRequest("GET", a.apiBaseURL+"/sites/versions?"+query.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return nil, err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -364,12 +492,16 @@ func (a *App) GetVersions(name string) ([]Version, error) {
 		return nil, fmt.Errorf(string(body))
 	}
 
-	var versions []Version
-	if err := json.Unmarshal(body, &versions); err != nil {
+	page := &VersionPage{NextOffset: -1}
+	if err := json.Unmarshal(body, &page.Versions); err != nil {
 		return nil, err
 	}
+	page.Total, _ = strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	if next := resp.Header.Get("X-Next-Offset"); next != "" {
+		page.NextOffset, _ = strconv.Atoi(next)
+	}
 
-	return versions, nil
+	return page, nil
 }
 
 // Rollback 回滚版本
@@ -391,7 +523,9 @@ func (a *App) Rollback(name, hash, message string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -408,6 +542,90 @@ func (a *App) Rollback(name, hash, message string) error {
 	return nil
 }
 
+// TagVersion 为版本设置标签（version 为空表示当前版本，force 为 true 时移动已有标签）
+func (a *App) TagVersion(name, tag, version string, force bool) error {
+	payload := map[string]interface{}{
+		"name":    name,
+		"tag":     tag,
+		"version": version,
+		"force":   force,
+	}
+	return a.postVersionTag("/sites/tags/create", payload)
+}
+
+// DeleteTag 删除版本标签
+func (a *App) DeleteTag(name, tag string) error {
+	payload := map[string]interface{}{
+		"name": name,
+		"tag":  tag,
+	}
+	return a.postVersionTag("/sites/tags/delete", payload)
+}
+
+// postVersionTag 发送版本标签请求
+func (a *App) postVersionTag(path string, payload map[string]interface{}) error {
+	data, _ := json.Marshal(payload)
+	req, err := http.NewRequest("POST", a.apiBaseURL+path, strings.NewReader(string(data)))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := a.addAuthToRequest(req); err != nil {
+		return err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf(string(body))
+	}
+
+	return nil
+}
+
+// GetDiff 比较两个版本（to 为空表示当前版本）
+func (a *App) GetDiff(name, from, to string) (*VersionDiff, error) {
+	url := fmt.Sprintf("%s/sites/diff?name=%s&from=%s", a.apiBaseURL, name, from)
+	if to != "" {
+		url += "&to=" + to
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addAuthToRequest(req); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(string(body))
+	}
+
+	var diff VersionDiff
+	if err := json.Unmarshal(body, &diff); err != nil {
+		return nil, err
+	}
+
+	return &diff, nil
+}
+
 // GetConfig 获取当前配置
 func (a *App) GetConfig() (*ClientConfig, error) {
 	config, err := LoadConfig()
@@ -419,11 +637,18 @@ func (a *App) GetConfig() (*ClientConfig, error) {
 
 // SaveConfig 保存配置
 func (a *App) SaveConfig(config *ClientConfig) error {
+	// 令牌不由前端维护：沿用当前登录状态，服务器或用户名变化时需要重新登录
+	if a.config != nil && a.config.ServerURL == config.ServerURL && a.config.Username == config.Username {
+		config.AccessToken = a.config.AccessToken
+		config.RefreshToken = a.config.RefreshToken
+		config.TokenExpiresAt = a.config.TokenExpiresAt
+	} else {
+		config.clearTokens()
+	}
+
 	// 更新内存中的配置
 	a.config = config
 	a.apiBaseURL = config.ServerURL
-	a.username = config.Username
-	a.password = config.Password
 
 	// 保存到文件
 	if err := SaveConfig(config); err != nil {
@@ -629,7 +854,9 @@ func (a *App) CheckIsAdmin() (bool, error) {
 		return false, err
 	}
 
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return false, err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -661,7 +888,9 @@ func (a *App) ListUsers() ([]UserInfo, error) {
 		return nil, err
 	}
 
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return nil, err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -721,7 +950,9 @@ func (a *App) CreateUser(name, password string, isAdmin bool) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -761,7 +992,9 @@ func (a *App) UpdateUser(name string, password string, isAdmin *bool) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -793,7 +1026,9 @@ func (a *App) DeleteUser(name string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	a.addAuthToRequest(req)
+	if err := a.addAuthToRequest(req); err != nil {
+		return err
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -811,3 +1046,170 @@ func (a *App) DeleteUser(name string) error {
 	return nil
 }
 
+
+// CreateTokenResult 创建部署令牌结果
+type CreateTokenResult struct {
+	Token string          `json:"token"` // 令牌明文，只返回这一次
+	Info  DeployTokenInfo `json:"info"`
+}
+
+// ListTokens 列出部署令牌
+func (a *App) ListTokens() ([]DeployTokenInfo, error) {
+	url := fmt.Sprintf("%s/tokens/list", a.apiBaseURL)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.addAuthToRequest(req); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", string(body))
+	}
+
+	var result struct {
+		Tokens []DeployTokenInfo `json:"tokens"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Tokens, nil
+}
+
+// CreateToken 创建部署令牌，expiresDays 为 0 表示永不过期
+func (a *App) CreateToken(name string, sites []string, actions []string, expiresDays int) (*CreateTokenResult, error) {
+	payload := map[string]interface{}{
+		"name":    name,
+		"sites":   sites,
+		"actions": actions,
+	}
+	if expiresDays > 0 {
+		payload["expires_at"] = time.Now().AddDate(0, 0, expiresDays)
+	}
+
+	data, _ := json.Marshal(payload)
+	url := fmt.Sprintf("%s/tokens/create", a.apiBaseURL)
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := a.addAuthToRequest(req); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", string(body))
+	}
+
+	var result CreateTokenResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// RevokeToken 吊销部署令牌
+func (a *App) RevokeToken(id string) error {
+	payload := map[string]string{
+		"id": id,
+	}
+
+	data, _ := json.Marshal(payload)
+	url := fmt.Sprintf("%s/tokens/revoke", a.apiBaseURL)
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(data)))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := a.addAuthToRequest(req); err != nil {
+		return err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", string(body))
+	}
+
+	return nil
+}
+
+// SetSiteAccess 设置网站访问策略
+// password 为空时沿用原密码；linkExpiresDays 为 0 表示分享链接永不过期
+func (a *App) SetSiteAccess(name, mode, password string, linkExpiresDays int, regenerateLink bool) (*SiteAccessInfo, error) {
+	access := map[string]interface{}{
+		"mode":            mode,
+		"password":        password,
+		"regenerate_link": regenerateLink,
+	}
+	if linkExpiresDays > 0 {
+		access["link_expires_at"] = time.Now().AddDate(0, 0, linkExpiresDays)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"name":   name,
+		"access": access,
+	})
+	req, err := http.NewRequest("POST", a.apiBaseURL+"/sites/update", strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if err := a.addAuthToRequest(req); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", string(body))
+	}
+
+	var result struct {
+		Access SiteAccessInfo `json:"access"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return &result.Access, nil
+}
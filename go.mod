@@ -1,3 +1,5 @@
 module aideploy
 
 go 1.21
+
+require golang.org/x/crypto v0.33.0
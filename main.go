@@ -24,7 +24,7 @@ func main() {
 			os.Exit(1)
 		}
 		fmt.Printf("已创建默认配置文件: %s\n", *configPath)
-		fmt.Println("默认管理员: admin / admin123")
+		fmt.Println("默认管理员: admin / admin123（首次登录后必须修改密码）")
 		fmt.Println("服务器将使用默认配置启动...")
 	}
 
@@ -49,6 +49,8 @@ func main() {
 
 	// 创建并启动服务器
 	srv := server.NewDeployServer(config, *configPath)
+	// 配置文件修改或收到 SIGHUP 信号时热加载配置，无需重启
+	srv.WatchConfig(loadConfig)
 	if err := srv.Start(); err != nil {
 		fmt.Printf("服务器启动失败: %v\n", err)
 		os.Exit(1)
@@ -64,6 +66,13 @@ type Config struct {
 	Port             int                    `json:"port"`
 	EnableVersioning bool                   `json:"enable_versioning"`
 	APIKey           string                 `json:"api_key,omitempty"`
+	TokenSecret      string                 `json:"token_secret,omitempty"`
+	DeployTokens     map[string]server.DeployToken `json:"deploy_tokens,omitempty"`
+	TLS              *server.TLSConfig             `json:"tls,omitempty"`
+	PreviewTTLHours  int                           `json:"preview_ttl_hours,omitempty"`
+	Retention        *server.RetentionPolicy       `json:"retention,omitempty"`
+	Precompress      bool                   `json:"precompress,omitempty"`
+	ProxyHosts       []string               `json:"proxy_hosts,omitempty"`
 	Sites            map[string]server.Site `json:"sites"`
 	Users            map[string]server.User `json:"users"`
 }
@@ -96,6 +105,13 @@ func loadConfig(path string) (server.Config, error) {
 		Port:             cfg.Port,
 		EnableVersioning: cfg.EnableVersioning,
 		APIKey:           cfg.APIKey,
+		TokenSecret:      cfg.TokenSecret,
+		DeployTokens:     cfg.DeployTokens,
+		TLS:              cfg.TLS,
+		PreviewTTLHours:  cfg.PreviewTTLHours,
+		Retention:        cfg.Retention,
+		Precompress:      cfg.Precompress,
+		ProxyHosts:       cfg.ProxyHosts,
 		Sites:            cfg.Sites,
 		Users:            cfg.Users,
 	}, nil
@@ -111,12 +127,17 @@ func createDefaultConfig(path string) error {
 
 	webRoot := filepath.Join(wd, "websites")
 
-	// 创建默认管理员用户
+	// 创建默认管理员用户（只保存密码哈希，首次登录后必须修改密码）
+	passwordHash, err := server.HashPassword("admin123")
+	if err != nil {
+		return err
+	}
 	defaultUsers := map[string]server.User{
 		"admin": {
-			Name:     "admin",
-			Password: "admin123",
-			IsAdmin:  true,
+			Name:               "admin",
+			Password:           passwordHash,
+			IsAdmin:            true,
+			MustChangePassword: true,
 		},
 	}
 
@@ -0,0 +1,387 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 网站访问策略
+const (
+	accessPublic   = "public"   // 公开访问
+	accessPassword = "password" // HTTP Basic 密码
+	accessLink     = "link"     // 分享链接令牌
+	accessUsers    = "users"    // 仅网站授权用户（登录页 + 会话 Cookie）
+)
+
+const (
+	siteLoginPath     = "/_aideploy/login"  // 网站访问登录页
+	siteLogoutPath    = "/_aideploy/logout" // 网站访问退出
+	siteSessionCookie = "aideploy_site_session"
+	shareCookiePrefix = "aideploy_share_"
+	passCookiePrefix  = "aideploy_pass_"
+	shareQueryParam   = "share"
+
+	tokenTypeSite     = "site"          // 网站访问会话令牌
+	tokenTypeSitePass = "site_password" // 网站访问密码通过后的会话令牌
+	siteSessionTTL    = 12 * time.Hour  // 网站访问会话有效期
+)
+
+// SiteAccess 网站访问策略
+type SiteAccess struct {
+	Mode          string    `json:"mode"`                      // public、password、link、users
+	Password      string    `json:"password,omitempty"`        // password 模式的密码哈希（bcrypt）
+	LinkToken     string    `json:"link_token,omitempty"`      // link 模式的分享令牌
+	LinkExpiresAt time.Time `json:"link_expires_at,omitempty"` // 分享链接过期时间，零值表示永不过期
+}
+
+// SiteAccessInfo 返回给客户端的访问策略（不含密码哈希）
+type SiteAccessInfo struct {
+	Mode          string     `json:"mode"`
+	HasPassword   bool       `json:"has_password,omitempty"`
+	ShareURL      string     `json:"share_url,omitempty"`
+	LinkExpiresAt *time.Time `json:"link_expires_at,omitempty"`
+}
+
+// siteAccessRequest 更新网站时提交的访问策略
+type siteAccessRequest struct {
+	Mode           string     `json:"mode"`
+	Password       string     `json:"password"`        // 为空时沿用原密码
+	LinkExpiresAt  *time.Time `json:"link_expires_at"` // 为空表示永不过期
+	RegenerateLink bool       `json:"regenerate_link"` // 重新生成分享令牌，旧链接立即失效
+}
+
+// accessMode 返回网站的访问策略，未配置时为公开
+func (site *Site) accessMode() string {
+	if site.Access == nil || site.Access.Mode == "" {
+		return accessPublic
+	}
+	return site.Access.Mode
+}
+
+// buildSiteAccess 根据请求生成新的访问策略，current 为当前策略（可能为 nil）
+func buildSiteAccess(req *siteAccessRequest, current *SiteAccess) (*SiteAccess, error) {
+	mode := strings.ToLower(strings.TrimSpace(req.Mode))
+	switch mode {
+	case "", accessPublic:
+		return nil, nil
+	case accessUsers:
+		return &SiteAccess{Mode: accessUsers}, nil
+	case accessPassword:
+		access := &SiteAccess{Mode: accessPassword}
+		if req.Password != "" {
+			if len(req.Password) < minPasswordLength {
+				return nil, fmt.Errorf("访问密码长度不能少于 %d 位", minPasswordLength)
+			}
+			hash, err := HashPassword(req.Password)
+			if err != nil {
+				return nil, err
+			}
+			access.Password = hash
+		} else if current != nil && current.Password != "" {
+			access.Password = current.Password
+		} else {
+			return nil, fmt.Errorf("请设置访问密码")
+		}
+		return access, nil
+	case accessLink:
+		access := &SiteAccess{Mode: accessLink}
+		if current != nil && current.LinkToken != "" && !req.RegenerateLink {
+			access.LinkToken = current.LinkToken
+		} else {
+			access.LinkToken = randomHex(16)
+		}
+		if req.LinkExpiresAt != nil {
+			if !req.LinkExpiresAt.After(time.Now()) {
+				return nil, fmt.Errorf("分享链接过期时间必须晚于当前时间")
+			}
+			access.LinkExpiresAt = *req.LinkExpiresAt
+		}
+		return access, nil
+	default:
+		return nil, fmt.Errorf("不支持的访问策略: %s（可选 public、password、link、users）", req.Mode)
+	}
+}
+
+// siteURL 生成网站访问地址，混合模式下优先使用子域名地址
+func (s *DeployServer) siteURL(r *http.Request, name string, site *Site) string {
+	scheme := s.publicScheme()
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if subdomain, _ := s.siteRoutings(site); subdomain {
+		return fmt.Sprintf("%s://%s", scheme, s.publicHost(fmt.Sprintf("%s.%s", name, s.config().BaseDomain)))
+	}
+	return fmt.Sprintf("%s://%s/%s/", scheme, s.pathHost(r), name)
+}
+
+// siteAccessInfo 生成返回给客户端的访问策略
+func (s *DeployServer) siteAccessInfo(r *http.Request, name string, site *Site) SiteAccessInfo {
+	info := SiteAccessInfo{Mode: site.accessMode()}
+	if site.Access == nil {
+		return info
+	}
+
+	switch info.Mode {
+	case accessPassword:
+		info.HasPassword = site.Access.Password != ""
+	case accessLink:
+		shareURL := s.siteURL(r, name, site)
+		if !strings.HasSuffix(shareURL, "/") {
+			shareURL += "/"
+		}
+		info.ShareURL = shareURL + "?" + shareQueryParam + "=" + site.Access.LinkToken
+		if !site.Access.LinkExpiresAt.IsZero() {
+			expiresAt := site.Access.LinkExpiresAt
+			info.LinkExpiresAt = &expiresAt
+		}
+	}
+	return info
+}
+
+// authorizeSiteRequest 按网站访问策略检查静态文件请求，未通过时写入响应并返回 false
+func (s *DeployServer) authorizeSiteRequest(w http.ResponseWriter, r *http.Request, siteName string) bool {
+	s.mu.RLock()
+	site, exists := s.config().Sites[siteName]
+	s.mu.RUnlock()
+
+	if !exists || site.accessMode() == accessPublic {
+		return true
+	}
+	access := site.Access
+
+	// 受保护网站的响应只允许浏览器私有缓存（serveFile 据此调整缓存头）
+	w.Header().Set("Cache-Control", "private")
+
+	switch access.Mode {
+	case accessPassword:
+		// 密码校验通过后写入签名 Cookie，后续请求无需每次计算 bcrypt
+		subject := sitePasswordSubject(siteName, access.Password)
+		if cookie, err := r.Cookie(passCookiePrefix + siteName); err == nil {
+			if claims, err := s.parseToken(cookie.Value, tokenTypeSitePass); err == nil && claims.Subject == subject {
+				return true
+			}
+		}
+		if _, password, ok := r.BasicAuth(); ok && checkPassword(access.Password, password) {
+			token, err := s.signToken(tokenClaims{
+				Subject:   subject,
+				Type:      tokenTypeSitePass,
+				ExpiresAt: time.Now().Add(siteSessionTTL).Unix(),
+			})
+			if err == nil {
+				http.SetCookie(w, &http.Cookie{
+					Name:     passCookiePrefix + siteName,
+					Value:    token,
+					Path:     "/",
+					MaxAge:   int(siteSessionTTL.Seconds()),
+					HttpOnly: true,
+					Secure:   r.TLS != nil,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			return true
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, siteName))
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return false
+
+	case accessLink:
+		token := r.URL.Query().Get(shareQueryParam)
+		fromQuery := token != ""
+		if !fromQuery {
+			if cookie, err := r.Cookie(shareCookiePrefix + siteName); err == nil {
+				token = cookie.Value
+			}
+		}
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(access.LinkToken)) != 1 {
+			http.Error(w, "Invalid or missing share link", http.StatusForbidden)
+			return false
+		}
+		if !access.LinkExpiresAt.IsZero() && time.Now().After(access.LinkExpiresAt) {
+			http.Error(w, "Share link has expired", http.StatusForbidden)
+			return false
+		}
+
+		// 通过链接访问后记住令牌，页面中的相对资源无需携带参数
+		if fromQuery {
+			cookie := &http.Cookie{
+				Name:     shareCookiePrefix + siteName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			}
+			if !access.LinkExpiresAt.IsZero() {
+				cookie.Expires = access.LinkExpiresAt
+			}
+			http.SetCookie(w, cookie)
+		}
+		return true
+
+	case accessUsers:
+		user, err := s.siteSessionUser(r)
+		if err != nil {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				http.Redirect(w, r, siteLoginPath+"?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			} else {
+				http.Error(w, "Login required", http.StatusUnauthorized)
+			}
+			return false
+		}
+
+		s.mu.RLock()
+		allowed := s.canAccessSite(siteName, user.Name, user)
+		s.mu.RUnlock()
+		if !allowed {
+			http.Error(w, "You are not authorized to view this site", http.StatusForbidden)
+			return false
+		}
+		return true
+
+	default:
+		// 未知策略按拒绝处理，避免配置错误导致泄露
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return false
+	}
+}
+
+// sitePasswordSubject 生成密码访问会话令牌的主体，包含密码哈希的摘要，修改密码后旧 Cookie 随之失效
+func sitePasswordSubject(siteName, passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return siteName + ":" + hex.EncodeToString(sum[:8])
+}
+
+// siteSessionUser 从网站访问会话 Cookie 中获取用户
+func (s *DeployServer) siteSessionUser(r *http.Request) (*User, error) {
+	cookie, err := r.Cookie(siteSessionCookie)
+	if err != nil {
+		return nil, fmt.Errorf("未登录")
+	}
+
+	claims, err := s.parseToken(cookie.Value, tokenTypeSite)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	user, exists := s.config().Users[claims.Subject]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("用户不存在")
+	}
+	return &user, nil
+}
+
+// siteLoginPage 网站访问登录页
+var siteLoginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>登录后访问</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; background: #0f172a; color: #e2e8f0; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; }
+form { background: #1e293b; padding: 32px; border-radius: 12px; width: 300px; }
+h1 { font-size: 20px; margin: 0 0 20px; }
+input { width: 100%; box-sizing: border-box; padding: 10px; margin-bottom: 12px; border-radius: 6px; border: 1px solid #334155; background: #0f172a; color: #e2e8f0; }
+button { width: 100%; padding: 10px; border: none; border-radius: 6px; background: #3b82f6; color: #fff; font-size: 15px; cursor: pointer; }
+.error { color: #f87171; font-size: 14px; margin-bottom: 12px; }
+</style>
+</head>
+<body>
+<form method="post" action="{{.Action}}">
+<h1>此网站需要登录</h1>
+{{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+<input type="hidden" name="next" value="{{.Next}}">
+<input name="username" placeholder="用户名" autocomplete="username" required autofocus>
+<input name="password" type="password" placeholder="密码" autocomplete="current-password" required>
+<button type="submit">登录</button>
+</form>
+</body>
+</html>
+`))
+
+// safeRedirectPath 只允许跳转到本站的相对路径
+func safeRedirectPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// handleSiteLogin 网站访问登录页（users 访问策略），登录成功后写入会话 Cookie
+func (s *DeployServer) handleSiteLogin(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Action string
+		Next   string
+		Error  string
+	}{
+		Action: siteLoginPath,
+		Next:   safeRedirectPath(r.FormValue("next")),
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		user, err := s.authenticate(r.FormValue("username"), r.FormValue("password"))
+		if err != nil {
+			data.Error = "用户名或密码错误"
+			w.WriteHeader(http.StatusUnauthorized)
+			break
+		}
+		if user.MustChangePassword {
+			data.Error = "请先在客户端修改默认密码"
+			w.WriteHeader(http.StatusForbidden)
+			break
+		}
+
+		token, err := s.signToken(tokenClaims{
+			Subject:   user.Name,
+			Type:      tokenTypeSite,
+			ExpiresAt: time.Now().Add(siteSessionTTL).Unix(),
+		})
+		if err != nil {
+			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     siteSessionCookie,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(siteSessionTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, data.Next, http.StatusSeeOther)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	siteLoginPage.Execute(w, data)
+}
+
+// handleSiteLogout 退出网站访问会话
+func (s *DeployServer) handleSiteLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     siteSessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	http.Redirect(w, r, safeRedirectPath(r.FormValue("next")), http.StatusSeeOther)
+}
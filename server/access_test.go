@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// authorizeSite 调用访问策略检查，返回是否通过和响应
+func authorizeSite(s *DeployServer, r *http.Request, siteName string) (bool, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	return s.authorizeSiteRequest(w, r, siteName), w
+}
+
+func TestPasswordAccessIssuesSiteCookie(t *testing.T) {
+	hash, err := HashPassword("site-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, Config{Sites: map[string]Site{
+		"demo":  {Name: "demo", Access: &SiteAccess{Mode: accessPassword, Password: hash}},
+		"other": {Name: "other", Access: &SiteAccess{Mode: accessPassword, Password: hash}},
+	}})
+
+	r := httptest.NewRequest(http.MethodGet, "/demo/", nil)
+	if ok, w := authorizeSite(s, r, "demo"); ok || w.Code != http.StatusUnauthorized {
+		t.Fatalf("no credentials: ok=%v code=%d, want 401", ok, w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/demo/", nil)
+	r.SetBasicAuth("", "wrong-password")
+	if ok, _ := authorizeSite(s, r, "demo"); ok {
+		t.Fatal("wrong password was accepted")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/demo/", nil)
+	r.SetBasicAuth("", "site-secret")
+	ok, w := authorizeSite(s, r, "demo")
+	if !ok {
+		t.Fatal("correct password was rejected")
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != passCookiePrefix+"demo" || !cookies[0].HttpOnly {
+		t.Fatalf("got cookies %v, want one HttpOnly %s cookie", cookies, passCookiePrefix+"demo")
+	}
+	cookie := cookies[0]
+
+	// 后续请求只凭 Cookie 即可访问
+	r = httptest.NewRequest(http.MethodGet, "/demo/app.js", nil)
+	r.AddCookie(cookie)
+	if ok, w := authorizeSite(s, r, "demo"); !ok || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("cookie request: ok=%v cookies=%v, want accepted without a new cookie", ok, w.Result().Cookies())
+	}
+
+	// Cookie 不能用于其他网站
+	forged := &http.Cookie{Name: passCookiePrefix + "other", Value: cookie.Value}
+	r = httptest.NewRequest(http.MethodGet, "/other/", nil)
+	r.AddCookie(forged)
+	if ok, _ := authorizeSite(s, r, "other"); ok {
+		t.Fatal("cookie issued for demo was accepted by other")
+	}
+
+	// 修改密码后旧 Cookie 失效
+	newHash, err := HashPassword("changed-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	site := s.config().Sites["demo"]
+	site.Access = &SiteAccess{Mode: accessPassword, Password: newHash}
+	s.config().Sites["demo"] = site
+	s.mu.Unlock()
+
+	r = httptest.NewRequest(http.MethodGet, "/demo/", nil)
+	r.AddCookie(cookie)
+	if ok, _ := authorizeSite(s, r, "demo"); ok {
+		t.Fatal("cookie was still accepted after the password changed")
+	}
+}
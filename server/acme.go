@@ -0,0 +1,427 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	acmeRenewBefore   = 30 * 24 * time.Hour // 证书到期前多久续期
+	acmeCheckInterval = 12 * time.Hour      // 续期检查间隔
+	acmeRetryInterval = 10 * time.Minute    // 申请失败后的重试间隔
+)
+
+// ACMEConfig 自动证书配置（DNS-01 验证，支持通配符证书）
+type ACMEConfig struct {
+	DirectoryURL string            `json:"directory_url"`          // ACME 目录地址，默认 Let's Encrypt
+	Email        string            `json:"email"`                  // 账号联系邮箱
+	Domains      []string          `json:"domains,omitempty"`      // 证书域名，默认 base_domain 和 *.base_domain
+	CacheDir     string            `json:"cache_dir,omitempty"`    // 账号密钥和证书缓存目录，默认配置文件同目录下的 acme
+	CACertFile   string            `json:"ca_cert_file,omitempty"` // 额外信任的 ACME 服务器 CA（如 Pebble 测试服务器）
+	DNS          DNSProviderConfig `json:"dns"`                    // DNS-01 验证记录的设置方式
+}
+
+// DNSProviderConfig DNS 验证记录提供方配置
+type DNSProviderConfig struct {
+	Provider           string `json:"provider"`                      // exec 或 challtestsrv
+	Command            string `json:"command,omitempty"`             // exec：执行 <command> present|cleanup <fqdn> <value>
+	APIURL             string `json:"api_url,omitempty"`             // challtestsrv：管理接口地址，如 http://localhost:8055
+	PropagationSeconds int    `json:"propagation_seconds,omitempty"` // 设置记录后等待生效的秒数
+}
+
+// dnsProvider 设置/清理 DNS-01 验证用的 TXT 记录
+type dnsProvider interface {
+	Present(fqdn, value string) error
+	CleanUp(fqdn, value string) error
+}
+
+// execDNSProvider 通过外部命令设置 TXT 记录，便于对接任意 DNS 服务商
+type execDNSProvider struct {
+	command string
+}
+
+func (p *execDNSProvider) run(action, fqdn, value string) error {
+	cmd := exec.Command(p.command, action, fqdn, value)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (p *execDNSProvider) Present(fqdn, value string) error {
+	return p.run("present", fqdn, value)
+}
+
+func (p *execDNSProvider) CleanUp(fqdn, value string) error {
+	return p.run("cleanup", fqdn, value)
+}
+
+// challtestsrvProvider 使用 Pebble 配套的 pebble-challtestsrv 设置 TXT 记录，用于本地测试
+type challtestsrvProvider struct {
+	apiURL string
+}
+
+func (p *challtestsrvProvider) post(path string, payload map[string]string) error {
+	data, _ := json.Marshal(payload)
+	resp, err := http.Post(strings.TrimSuffix(p.apiURL, "/")+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("challtestsrv 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *challtestsrvProvider) Present(fqdn, value string) error {
+	return p.post("/set-txt", map[string]string{"host": fqdn + ".", "value": value})
+}
+
+func (p *challtestsrvProvider) CleanUp(fqdn, value string) error {
+	return p.post("/clear-txt", map[string]string{"host": fqdn + "."})
+}
+
+// newDNSProvider 根据配置创建 DNS 提供方
+func newDNSProvider(cfg DNSProviderConfig) (dnsProvider, error) {
+	switch cfg.Provider {
+	case "exec":
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("dns.command 不能为空")
+		}
+		return &execDNSProvider{command: cfg.Command}, nil
+	case "challtestsrv":
+		if cfg.APIURL == "" {
+			return nil, fmt.Errorf("dns.api_url 不能为空")
+		}
+		return &challtestsrvProvider{apiURL: cfg.APIURL}, nil
+	default:
+		return nil, fmt.Errorf("不支持的 DNS 提供方: %s（可选 exec、challtestsrv）", cfg.Provider)
+	}
+}
+
+// acmeManager 申请并自动续期证书
+type acmeManager struct {
+	cfg      *ACMEConfig
+	domains  []string
+	cacheDir string
+	client   *acme.Client
+	dns      dnsProvider
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newACMEManager 创建 ACME 管理器并加载缓存的证书
+func newACMEManager(cfg *ACMEConfig, baseDomain, configPath string) (*acmeManager, error) {
+	domains := cfg.Domains
+	if len(domains) == 0 {
+		if baseDomain == "" {
+			return nil, fmt.Errorf("未配置 base_domain，无法确定证书域名")
+		}
+		domains = []string{baseDomain, "*." + baseDomain}
+	}
+
+	cacheDir := cfg.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(filepath.Dir(configPath), "acme")
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+
+	dns, err := newDNSProvider(cfg.DNS)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := http.DefaultClient
+	if cfg.CACertFile != "" {
+		caPEM, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("CA 证书格式错误: %s", cfg.CACertFile)
+		}
+		httpClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		}
+	}
+
+	m := &acmeManager{
+		cfg:      cfg,
+		domains:  domains,
+		cacheDir: cacheDir,
+		dns:      dns,
+	}
+
+	accountKey, err := m.loadOrCreateKey(filepath.Join(cacheDir, "account.key"))
+	if err != nil {
+		return nil, fmt.Errorf("加载账号密钥失败: %v", err)
+	}
+
+	directoryURL := cfg.DirectoryURL
+	if directoryURL == "" {
+		directoryURL = acme.LetsEncryptURL
+	}
+	m.client = &acme.Client{
+		Key:          accountKey,
+		DirectoryURL: directoryURL,
+		HTTPClient:   httpClient,
+		UserAgent:    "aideploy",
+	}
+
+	if cert, err := tls.LoadX509KeyPair(m.certPath(), m.keyPath()); err == nil {
+		if cert.Leaf == nil {
+			cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+		}
+		m.cert = &cert
+	}
+
+	return m, nil
+}
+
+func (m *acmeManager) certPath() string {
+	return filepath.Join(m.cacheDir, "cert.pem")
+}
+
+func (m *acmeManager) keyPath() string {
+	return filepath.Join(m.cacheDir, "cert.key")
+}
+
+// loadOrCreateKey 加载 PEM 格式的 EC 私钥，不存在则生成
+func (m *acmeManager) loadOrCreateKey(path string) (*ecdsa.PrivateKey, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("密钥格式错误: %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeECKey(path, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// writeECKey 保存 EC 私钥
+func writeECKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+}
+
+// certificateFor 返回可用于指定主机名的证书
+func (m *acmeManager) certificateFor(host string) *tls.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cert == nil || m.cert.Leaf == nil {
+		return nil
+	}
+	if m.cert.Leaf.VerifyHostname(host) != nil {
+		return nil
+	}
+	return m.cert
+}
+
+// needsRenewal 是否需要申请或续期证书
+func (m *acmeManager) needsRenewal() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cert == nil || m.cert.Leaf == nil {
+		return true
+	}
+	// 配置的域名变化后需要重新申请
+	for _, domain := range m.domains {
+		if m.cert.Leaf.VerifyHostname(strings.Replace(domain, "*", "acme-check", 1)) != nil {
+			return true
+		}
+	}
+	return time.Until(m.cert.Leaf.NotAfter) < acmeRenewBefore
+}
+
+// run 后台申请证书并定期续期
+func (m *acmeManager) run() {
+	for {
+		wait := acmeCheckInterval
+		if m.needsRenewal() {
+			fmt.Printf("正在申请证书: %s\n", strings.Join(m.domains, ", "))
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			err := m.obtain(ctx)
+			cancel()
+			if err != nil {
+				fmt.Printf("申请证书失败: %v\n", err)
+				wait = acmeRetryInterval
+			} else {
+				fmt.Printf("证书申请成功: %s\n", strings.Join(m.domains, ", "))
+			}
+		}
+		time.Sleep(wait)
+	}
+}
+
+// obtain 通过 DNS-01 验证申请证书
+func (m *acmeManager) obtain(ctx context.Context) error {
+	account := &acme.Account{}
+	if m.cfg.Email != "" {
+		account.Contact = []string{"mailto:" + m.cfg.Email}
+	}
+	if _, err := m.client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return fmt.Errorf("注册账号失败: %v", err)
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.domains...))
+	if err != nil {
+		return fmt.Errorf("创建订单失败: %v", err)
+	}
+
+	// 逐个完成验证：域名和通配符域名使用同一个 TXT 记录名，不能同时设置
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+
+	orderURI := order.URI
+	order, err = m.client.WaitOrder(ctx, orderURI)
+	if err != nil {
+		return fmt.Errorf("等待订单完成失败: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.domains[0]},
+		DNSNames: m.domains,
+	}, key)
+	if err != nil {
+		return fmt.Errorf("创建证书请求失败: %v", err)
+	}
+
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		// 部分 CA 的 finalize 响应不带 Location，库无法轮询订单，改用订单地址自行等待
+		order, waitErr := m.client.WaitOrder(ctx, orderURI)
+		if waitErr != nil || order.CertURL == "" {
+			return fmt.Errorf("签发证书失败: %v", err)
+		}
+		if der, err = m.client.FetchCert(ctx, order.CertURL, true); err != nil {
+			return fmt.Errorf("下载证书失败: %v", err)
+		}
+	}
+
+	return m.storeCert(der, key)
+}
+
+// authorize 完成单个域名的 DNS-01 验证
+func (m *acmeManager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("获取授权失败: %v", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("%s 不支持 DNS-01 验证", authz.Identifier.Value)
+	}
+
+	value, err := m.client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+	fqdn := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.")
+
+	if err := m.dns.Present(fqdn, value); err != nil {
+		return fmt.Errorf("设置 DNS 记录失败: %v", err)
+	}
+	defer func() {
+		if err := m.dns.CleanUp(fqdn, value); err != nil {
+			fmt.Printf("清理 DNS 记录失败: %v\n", err)
+		}
+	}()
+
+	if wait := m.cfg.DNS.PropagationSeconds; wait > 0 {
+		time.Sleep(time.Duration(wait) * time.Second)
+	}
+
+	if _, err := m.client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("提交验证失败: %v", err)
+	}
+	if _, err := m.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("%s 验证失败: %v", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// storeCert 保存证书到缓存目录并启用
+func (m *acmeManager) storeCert(der [][]byte, key crypto.Signer) error {
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return fmt.Errorf("解析证书失败: %v", err)
+	}
+
+	var certPEM bytes.Buffer
+	for _, block := range der {
+		pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: block})
+	}
+	if err := os.WriteFile(m.certPath(), certPEM.Bytes(), 0600); err != nil {
+		return fmt.Errorf("保存证书失败: %v", err)
+	}
+	if err := writeECKey(m.keyPath(), key.(*ecdsa.PrivateKey)); err != nil {
+		return fmt.Errorf("保存证书私钥失败: %v", err)
+	}
+
+	m.mu.Lock()
+	m.cert = &tls.Certificate{
+		Certificate: der,
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	m.mu.Unlock()
+	return nil
+}
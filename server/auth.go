@@ -0,0 +1,400 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	accessTokenTTL  = 2 * time.Hour       // 访问令牌有效期
+	refreshTokenTTL = 30 * 24 * time.Hour // 刷新令牌有效期
+
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+)
+
+// tokenClaims 令牌载荷
+type tokenClaims struct {
+	Subject   string `json:"sub"`             // 用户名
+	SessionID string `json:"sid"`             // 会话ID
+	Type      string `json:"typ"`             // access 或 refresh
+	Nonce     string `json:"nonce,omitempty"` // 刷新令牌随机数，每次刷新轮换
+	ExpiresAt int64  `json:"exp"`             // 过期时间（Unix秒）
+}
+
+// authSession 登录会话
+type authSession struct {
+	Username     string    `json:"username"`
+	RefreshNonce string    `json:"refresh_nonce"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// sessionStore 登录会话存储，持久化到配置文件同目录，服务器重启后令牌仍然有效
+type sessionStore struct {
+	mu       sync.Mutex
+	path     string
+	sessions map[string]*authSession
+}
+
+// TokenResponse 登录/刷新返回的令牌
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // 访问令牌剩余秒数
+	User         User   `json:"user"`
+}
+
+// newSessionStore 创建会话存储并加载已有会话
+func newSessionStore(configPath string) *sessionStore {
+	store := &sessionStore{
+		path:     filepath.Join(filepath.Dir(configPath), "sessions.json"),
+		sessions: make(map[string]*authSession),
+	}
+
+	if data, err := os.ReadFile(store.path); err == nil {
+		if err := json.Unmarshal(data, &store.sessions); err != nil {
+			fmt.Printf("加载会话失败: %v\n", err)
+			store.sessions = make(map[string]*authSession)
+		}
+	}
+	return store
+}
+
+// saveLocked 保存会话（调用方需持有锁），顺便清理过期会话
+func (st *sessionStore) saveLocked() error {
+	now := time.Now()
+	for id, session := range st.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(st.sessions, id)
+		}
+	}
+
+	data, err := json.MarshalIndent(st.sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(st.path, data, 0600)
+}
+
+// ensureTokenSecret 确保配置中存在令牌签名密钥，不存在则生成并保存
+func (s *DeployServer) ensureTokenSecret() {
+	if s.config().TokenSecret != "" {
+		return
+	}
+
+	s.config().TokenSecret = randomHex(32)
+	if err := s.saveConfig(); err != nil {
+		fmt.Printf("保存令牌密钥失败: %v\n", err)
+	}
+}
+
+// randomHex 生成 n 字节的随机十六进制字符串
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("生成随机数失败: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// signToken 签发令牌：base64url(载荷) + "." + base64url(HMAC-SHA256)
+func (s *DeployServer) signToken(claims tokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(s.config().TokenSecret))
+	mac.Write([]byte(encoded))
+	signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return encoded + "." + signature, nil
+}
+
+// parseToken 校验令牌签名、类型和有效期
+func (s *DeployServer) parseToken(token, tokenType string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("令牌格式错误")
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.config().TokenSecret))
+	mac.Write([]byte(parts[0]))
+	expected := mac.Sum(nil)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, expected) {
+		return nil, fmt.Errorf("令牌签名无效")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("令牌格式错误")
+	}
+
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("令牌格式错误")
+	}
+
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("令牌类型错误")
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, fmt.Errorf("令牌已过期")
+	}
+
+	return &claims, nil
+}
+
+// issueTokens 为会话签发一对新的访问令牌和刷新令牌
+func (s *DeployServer) issueTokens(sessionID string, session *authSession, user *User) (*TokenResponse, error) {
+	now := time.Now()
+	accessExpires := now.Add(accessTokenTTL)
+
+	accessToken, err := s.signToken(tokenClaims{
+		Subject:   session.Username,
+		SessionID: sessionID,
+		Type:      tokenTypeAccess,
+		ExpiresAt: accessExpires.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := s.signToken(tokenClaims{
+		Subject:   session.Username,
+		SessionID: sessionID,
+		Type:      tokenTypeRefresh,
+		Nonce:     session.RefreshNonce,
+		ExpiresAt: session.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenTTL / time.Second),
+		User: User{
+			Name:               user.Name,
+			IsAdmin:            user.IsAdmin,
+			MustChangePassword: user.MustChangePassword,
+		},
+	}, nil
+}
+
+// userFromAccessToken 通过访问令牌获取用户
+func (s *DeployServer) userFromAccessToken(token string) (*User, error) {
+	claims, err := s.parseToken(token, tokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	// 会话被注销后，未过期的访问令牌同样失效
+	s.sessions.mu.Lock()
+	session, exists := s.sessions.sessions[claims.SessionID]
+	s.sessions.mu.Unlock()
+	if !exists || session.Username != claims.Subject {
+		return nil, fmt.Errorf("会话已失效")
+	}
+
+	s.mu.RLock()
+	user, exists := s.config().Users[claims.Subject]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("用户不存在")
+	}
+	return &user, nil
+}
+
+// revokeUserSessions 注销用户的所有登录会话（keep 指定的会话除外），修改密码后旧令牌随之失效
+// 调用方不能持有 s.mu：刷新令牌时先锁定会话再读取用户配置
+func (s *DeployServer) revokeUserSessions(username, keep string) {
+	s.sessions.mu.Lock()
+	defer s.sessions.mu.Unlock()
+
+	for id, session := range s.sessions.sessions {
+		if session.Username == username && id != keep {
+			delete(s.sessions.sessions, id)
+		}
+	}
+	if err := s.sessions.saveLocked(); err != nil {
+		fmt.Printf("保存会话失败: %v\n", err)
+	}
+}
+
+// currentSessionID 返回请求访问令牌所属的会话ID，不是登录令牌时为空
+func (s *DeployServer) currentSessionID(r *http.Request) string {
+	claims, err := s.parseToken(bearerToken(r), tokenTypeAccess)
+	if err != nil {
+		return ""
+	}
+	return claims.SessionID
+}
+
+// bearerToken 从 Authorization 头中提取 Bearer 令牌
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// handleLogin 用户登录，签发令牌
+func (s *DeployServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, "无效的请求", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		s.respondError(w, "用户名和密码不能为空", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.authenticate(req.Username, req.Password)
+	if err != nil {
+		// 不区分用户不存在和密码错误
+		s.respondError(w, "用户名或密码错误", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID := randomHex(16)
+	session := &authSession{
+		Username:     user.Name,
+		RefreshNonce: randomHex(16),
+		ExpiresAt:    time.Now().Add(refreshTokenTTL),
+	}
+
+	tokens, err := s.issueTokens(sessionID, session, user)
+	if err != nil {
+		s.respondError(w, fmt.Sprintf("签发令牌失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sessions.mu.Lock()
+	s.sessions.sessions[sessionID] = session
+	err = s.sessions.saveLocked()
+	s.sessions.mu.Unlock()
+	if err != nil {
+		fmt.Printf("保存会话失败: %v\n", err)
+	}
+
+	s.respondJSON(w, tokens)
+}
+
+// handleRefreshToken 使用刷新令牌换取新的令牌（刷新令牌同时轮换）
+func (s *DeployServer) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		s.respondError(w, "无效的请求", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.parseToken(req.RefreshToken, tokenTypeRefresh)
+	if err != nil {
+		s.respondError(w, "未授权："+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	s.sessions.mu.Lock()
+	defer s.sessions.mu.Unlock()
+
+	session, exists := s.sessions.sessions[claims.SessionID]
+	if !exists || session.Username != claims.Subject {
+		s.respondError(w, "未授权：会话已失效", http.StatusUnauthorized)
+		return
+	}
+
+	// 刷新令牌只能使用一次，重复使用说明令牌可能泄露，直接注销会话
+	if !hmac.Equal([]byte(session.RefreshNonce), []byte(claims.Nonce)) {
+		delete(s.sessions.sessions, claims.SessionID)
+		s.sessions.saveLocked()
+		s.respondError(w, "未授权：刷新令牌已被使用", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.RLock()
+	user, exists := s.config().Users[claims.Subject]
+	s.mu.RUnlock()
+	if !exists {
+		delete(s.sessions.sessions, claims.SessionID)
+		s.sessions.saveLocked()
+		s.respondError(w, "未授权：用户不存在", http.StatusUnauthorized)
+		return
+	}
+
+	session.RefreshNonce = randomHex(16)
+	tokens, err := s.issueTokens(claims.SessionID, session, &user)
+	if err != nil {
+		s.respondError(w, fmt.Sprintf("签发令牌失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.sessions.saveLocked(); err != nil {
+		fmt.Printf("保存会话失败: %v\n", err)
+	}
+
+	s.respondJSON(w, tokens)
+}
+
+// handleLogout 注销当前会话
+func (s *DeployServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := s.parseToken(bearerToken(r), tokenTypeAccess)
+	if err != nil {
+		s.respondError(w, "未授权："+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	s.sessions.mu.Lock()
+	delete(s.sessions.sessions, claims.SessionID)
+	err = s.sessions.saveLocked()
+	s.sessions.mu.Unlock()
+	if err != nil {
+		fmt.Printf("保存会话失败: %v\n", err)
+	}
+
+	s.respondJSON(w, map[string]string{
+		"message": "已退出登录",
+	})
+}
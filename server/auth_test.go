@@ -0,0 +1,200 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessionIDOf 返回访问令牌所属的会话ID
+func sessionIDOf(t *testing.T, s *DeployServer, accessToken string) string {
+	t.Helper()
+	claims, err := s.parseToken(accessToken, tokenTypeAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims.SessionID
+}
+
+func TestAPIRequiresAccessToken(t *testing.T) {
+	s := newTestServer(t, Config{})
+	list := s.authMiddleware(s.handleListSites)
+
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: got %d, want 401", w.Code)
+	}
+
+	// 不再接受每个请求携带用户名和密码
+	r := httptest.NewRequest(http.MethodGet, "/api/sites/list", nil)
+	r.Header.Set("X-Username", "admin")
+	r.Header.Set("X-Password", "admin-secret")
+	w := httptest.NewRecorder()
+	list.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("X-Username/X-Password: got %d, want 401", w.Code)
+	}
+
+	login := http.HandlerFunc(s.handleLogin)
+	if w := serveTestRequest(t, login, http.MethodPost, "/api/auth/login", "", map[string]string{"username": "admin", "password": "wrong"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: got %d, want 401", w.Code)
+	}
+
+	tokens := loginTestUser(t, s, "admin", "admin-secret")
+	if tokens.TokenType != "Bearer" || tokens.ExpiresIn != int64(accessTokenTTL/time.Second) {
+		t.Errorf("token_type = %q expires_in = %d", tokens.TokenType, tokens.ExpiresIn)
+	}
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", tokens.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("access token: got %d, want 200", w.Code)
+	}
+}
+
+func TestAccessTokenRejectsExpiredForgedAndWrongType(t *testing.T) {
+	s := newTestServer(t, Config{})
+	list := s.authMiddleware(s.handleListSites)
+	tokens := loginTestUser(t, s, "admin", "admin-secret")
+	sessionID := sessionIDOf(t, s, tokens.AccessToken)
+
+	expired, err := s.signToken(tokenClaims{
+		Subject:   "admin",
+		SessionID: sessionID,
+		Type:      tokenTypeAccess,
+		ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, signature, _ := strings.Cut(tokens.AccessToken, ".")
+	forged := payload + "." + strings.Repeat("A", len(signature))
+
+	other := newTestServer(t, Config{})
+	otherTokens := loginTestUser(t, other, "admin", "admin-secret")
+
+	tests := map[string]string{
+		"expired":                  expired,
+		"forged signature":         forged,
+		"refresh token as access":  tokens.RefreshToken,
+		"signed by another server": otherTokens.AccessToken,
+		"malformed":                "not-a-token",
+	}
+	for name, token := range tests {
+		if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", token, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want 401", name, w.Code)
+		}
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	s := newTestServer(t, Config{})
+	tokens := loginTestUser(t, s, "admin", "admin-secret")
+
+	if w := serveTestRequest(t, http.HandlerFunc(s.handleLogout), http.MethodPost, "/api/auth/logout", tokens.AccessToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("logout: got %d", w.Code)
+	}
+	if w := serveTestRequest(t, s.authMiddleware(s.handleListSites), http.MethodGet, "/api/sites/list", tokens.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token after logout: got %d, want 401", w.Code)
+	}
+	w := serveTestRequest(t, http.HandlerFunc(s.handleRefreshToken), http.MethodPost, "/api/auth/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: got %d, want 401", w.Code)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestServer(t, Config{})
+	list := s.authMiddleware(s.handleListSites)
+	refresh := http.HandlerFunc(s.handleRefreshToken)
+	first := loginTestUser(t, s, "admin", "admin-secret")
+
+	w := serveTestRequest(t, refresh, http.MethodPost, "/api/auth/refresh", "", map[string]string{"refresh_token": first.RefreshToken})
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: got %d", w.Code)
+	}
+	second := decodeTokens(t, w)
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", second.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("refreshed access token: got %d, want 200", w.Code)
+	}
+
+	// 重复使用旧的刷新令牌说明令牌可能泄露，整个会话被注销
+	w = serveTestRequest(t, refresh, http.MethodPost, "/api/auth/refresh", "", map[string]string{"refresh_token": first.RefreshToken})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: got %d, want 401", w.Code)
+	}
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", second.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token after refresh token reuse: got %d, want 401", w.Code)
+	}
+
+	// 会话保存在文件中，重启后仍然有效
+	relogin := loginTestUser(t, s, "admin", "admin-secret")
+	restarted := NewDeployServer(*s.config(), s.configPath)
+	if w := serveTestRequest(t, restarted.authMiddleware(restarted.handleListSites), http.MethodGet, "/api/sites/list", relogin.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("access token after restart: got %d, want 200", w.Code)
+	}
+}
+
+func TestDeletedUserTokensStopWorking(t *testing.T) {
+	s := newTestServer(t, Config{Users: map[string]User{
+		"admin": {Name: "admin", Password: "admin-secret", IsAdmin: true},
+		"bob":   {Name: "bob", Password: "bob-secret"},
+	}})
+	admin := loginTestUser(t, s, "admin", "admin-secret")
+	bob := loginTestUser(t, s, "bob", "bob-secret")
+
+	if w := serveTestRequest(t, s.authMiddleware(s.requireAdmin(s.handleListUsers)), http.MethodGet, "/api/users/list", bob.AccessToken, nil); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin listing users: got %d, want 403", w.Code)
+	}
+	deleteUser := s.authMiddleware(s.requireAdmin(s.handleDeleteUser))
+	if w := serveTestRequest(t, deleteUser, http.MethodPost, "/api/users/delete", admin.AccessToken, map[string]string{"name": "bob"}); w.Code != http.StatusOK {
+		t.Fatalf("delete bob: got %d %s", w.Code, w.Body.String())
+	}
+	if w := serveTestRequest(t, s.authMiddleware(s.handleListSites), http.MethodGet, "/api/sites/list", bob.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("deleted user's access token: got %d, want 401", w.Code)
+	}
+}
+
+func TestPasswordResetRevokesUserSessions(t *testing.T) {
+	s := newTestServer(t, Config{Users: map[string]User{
+		"admin": {Name: "admin", Password: "admin-secret", IsAdmin: true},
+		"bob":   {Name: "bob", Password: "bob-secret"},
+	}})
+	list := s.authMiddleware(s.handleListSites)
+	refresh := http.HandlerFunc(s.handleRefreshToken)
+	updateUser := s.authMiddleware(s.requireAdmin(s.handleUpdateUser))
+	admin := loginTestUser(t, s, "admin", "admin-secret")
+	bob := loginTestUser(t, s, "bob", "bob-secret")
+
+	// 只修改权限时不影响已登录的会话
+	if w := serveTestRequest(t, updateUser, http.MethodPost, "/api/users/update", admin.AccessToken, map[string]interface{}{"name": "bob", "isAdmin": false}); w.Code != http.StatusOK {
+		t.Fatalf("update bob: got %d %s", w.Code, w.Body.String())
+	}
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", bob.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("bob's access token after a permission change: got %d, want 200", w.Code)
+	}
+
+	if w := serveTestRequest(t, updateUser, http.MethodPost, "/api/users/update", admin.AccessToken, map[string]string{"name": "bob", "password": "bob-new-secret"}); w.Code != http.StatusOK {
+		t.Fatalf("reset bob's password: got %d %s", w.Code, w.Body.String())
+	}
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", bob.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("bob's access token after a password reset: got %d, want 401", w.Code)
+	}
+	if w := serveTestRequest(t, refresh, http.MethodPost, "/api/auth/refresh", "", map[string]string{"refresh_token": bob.RefreshToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("bob's refresh token after a password reset: got %d, want 401", w.Code)
+	}
+
+	// 管理员修改自己的密码时保留当前会话，注销其他会话
+	other := loginTestUser(t, s, "admin", "admin-secret")
+	if w := serveTestRequest(t, updateUser, http.MethodPost, "/api/users/update", admin.AccessToken, map[string]string{"name": "admin", "password": "admin-new-secret"}); w.Code != http.StatusOK {
+		t.Fatalf("reset admin's password: got %d %s", w.Code, w.Body.String())
+	}
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", admin.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("current session after changing own password: got %d, want 200", w.Code)
+	}
+	if w := serveTestRequest(t, refresh, http.MethodPost, "/api/auth/refresh", "", map[string]string{"refresh_token": other.RefreshToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("other session's refresh token after changing own password: got %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 路径模式下网站访问前缀（/site）的处理方式
+const (
+	pathRewriteOff     = ""        // 不处理
+	pathRewriteBase    = "base"    // 在 HTML 中注入 <base href>（已有的 <base> 改为带前缀的地址）
+	pathRewriteRewrite = "rewrite" // 将 HTML/CSS 中以 / 开头的地址改写为带前缀的地址
+)
+
+var (
+	// htmlURLAttrPattern 匹配 HTML 中以 / 开头（不是 //）的地址属性
+	htmlURLAttrPattern = regexp.MustCompile(`(?i)(\s(?:src|href|action|formaction|poster|data)\s*=\s*["']?)(/)([^/"'\s>][^"'\s>]*|["'\s>])`)
+	// htmlSrcsetPattern 匹配 HTML 中的 srcset 属性
+	htmlSrcsetPattern = regexp.MustCompile(`(?i)(\ssrcset\s*=\s*)("[^"]*"|'[^']*')`)
+	// cssURLPattern 匹配 CSS 中以 / 开头（不是 //）的 url(...) 和 @import 地址
+	cssURLPattern = regexp.MustCompile(`(?i)(url\(\s*["']?|@import\s+["'])(/)([^/"'\s)][^"'\s)]*|["'\s)])`)
+	// htmlBasePattern 匹配 HTML 中已有的 <base> 标签
+	htmlBasePattern = regexp.MustCompile(`(?i)<base\s[^>]*>`)
+	// htmlBaseHrefPattern 匹配 <base> 标签中以 / 开头的 href
+	htmlBaseHrefPattern = regexp.MustCompile(`(?i)(href\s*=\s*["']?)(/)([^/])`)
+	// htmlHeadPattern 匹配 <head> 开始标签
+	htmlHeadPattern = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+)
+
+// validatePathRewrite 校验路径模式下的访问前缀处理方式
+func validatePathRewrite(mode string) error {
+	switch mode {
+	case pathRewriteOff, pathRewriteBase, pathRewriteRewrite:
+		return nil
+	}
+	return fmt.Errorf("无效的路径前缀处理方式: %s（可选 base、rewrite，留空表示不处理）", mode)
+}
+
+// rewritesContentType 判断内容类型是否需要处理访问前缀
+func rewritesContentType(mode, contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch mode {
+	case pathRewriteBase:
+		return mediaType == "text/html"
+	case pathRewriteRewrite:
+		return mediaType == "text/html" || mediaType == "text/css"
+	}
+	return false
+}
+
+// rewriteBasePath 按处理方式为 HTML/CSS 内容加上网站访问前缀
+// base 为网站访问前缀（如 /site 或 /site/_preview/label），relPath 为文件在网站中的路径
+func rewriteBasePath(mode, base, relPath, contentType string, content []byte) []byte {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch mode {
+	case pathRewriteBase:
+		// <base> 指向文件所在目录，页面中原有的相对地址解析结果不变
+		dir := path.Dir(relPath)
+		if !strings.HasSuffix(dir, "/") {
+			dir += "/"
+		}
+		return injectBaseHref(content, base, base+dir)
+	case pathRewriteRewrite:
+		if mediaType == "text/css" {
+			return prefixCSSURLs(content, base)
+		}
+		content = prefixHTMLURLs(content, base)
+		return prefixCSSURLs(content, base)
+	}
+	return content
+}
+
+// injectBaseHref 已有 <base href="/..."> 时加上访问前缀，否则在 <head> 中注入 <base href>
+func injectBaseHref(content []byte, base, href string) []byte {
+	if loc := htmlBasePattern.FindIndex(content); loc != nil {
+		tag := htmlBaseHrefPattern.ReplaceAllFunc(content[loc[0]:loc[1]], func(match []byte) []byte {
+			return prefixMatch(htmlBaseHrefPattern, match, base)
+		})
+		return concatBytes(content[:loc[0]], tag, content[loc[1]:])
+	}
+
+	tag := []byte(fmt.Sprintf(`<base href="%s">`, href))
+	if loc := htmlHeadPattern.FindIndex(content); loc != nil {
+		return concatBytes(content[:loc[1]], tag, content[loc[1]:])
+	}
+	return concatBytes(tag, content)
+}
+
+// prefixHTMLURLs 为 HTML 属性中以 / 开头的地址加上访问前缀
+func prefixHTMLURLs(content []byte, base string) []byte {
+	content = htmlURLAttrPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		return prefixMatch(htmlURLAttrPattern, match, base)
+	})
+	return htmlSrcsetPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := htmlSrcsetPattern.FindSubmatch(match)
+		value := groups[2]
+		quote, inner := value[:1], value[1:len(value)-1]
+		candidates := strings.Split(string(inner), ",")
+		for i, candidate := range candidates {
+			trimmed := strings.TrimLeft(candidate, " \t\n")
+			if strings.HasPrefix(trimmed, "/") && !strings.HasPrefix(trimmed, "//") && !hasBasePrefix(trimmed, base) {
+				candidates[i] = candidate[:len(candidate)-len(trimmed)] + base + trimmed
+			}
+		}
+		return concatBytes(groups[1], quote, []byte(strings.Join(candidates, ",")), quote)
+	})
+}
+
+// prefixCSSURLs 为 CSS（包括 HTML 中的内联样式）中以 / 开头的 url() 和 @import 地址加上访问前缀
+func prefixCSSURLs(content []byte, base string) []byte {
+	return cssURLPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		return prefixMatch(cssURLPattern, match, base)
+	})
+}
+
+// prefixMatch 在正则第一个分组之后插入访问前缀，地址已带前缀时保持不变
+func prefixMatch(pattern *regexp.Regexp, match []byte, base string) []byte {
+	groups := pattern.FindSubmatchIndex(match)
+	prefixEnd := groups[3]
+	if hasBasePrefix(strings.TrimRight(string(match[prefixEnd:]), "\"' \t\r\n>)"), base) {
+		return match
+	}
+	return concatBytes(match[:prefixEnd], []byte(base), match[prefixEnd:])
+}
+
+// hasBasePrefix 判断地址是否已经以访问前缀开头
+func hasBasePrefix(value, base string) bool {
+	return value == base || strings.HasPrefix(value, base+"/")
+}
+
+// concatBytes 拼接字节切片
+func concatBytes(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// refererRedirect 路径模式下，以 / 开头的资源地址会被当作其他网站的请求（如 /assets/app.js），
+// 请求的网站不存在时，根据 Referer 找到来源网站（需开启访问前缀处理），返回带前缀的重定向地址
+func (h *StaticFileHandler) refererRedirect(r *http.Request, siteName string) (string, bool) {
+	if h.siteSettings == nil || r.Header.Get("Referer") == "" {
+		return "", false
+	}
+	if info, err := os.Stat(filepath.Join(h.webRoot, siteName)); err == nil && info.IsDir() && !strings.HasPrefix(siteName, ".") {
+		return "", false
+	}
+
+	referer, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || (referer.Host != "" && !strings.EqualFold(referer.Host, r.Host)) {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(referer.Path, "/"), "/")
+	refSite := parts[0]
+	if refSite == "" || refSite == siteName || strings.HasPrefix(refSite, ".") {
+		return "", false
+	}
+	if info, err := os.Stat(filepath.Join(h.webRoot, refSite)); err != nil || !info.IsDir() {
+		return "", false
+	}
+	if h.siteSettings(refSite).pathRewrite == pathRewriteOff {
+		return "", false
+	}
+
+	// 来源是预览或历史版本时重定向到同一预览或版本
+	base := "/" + refSite
+	if len(parts) > 2 && "/"+parts[1]+"/" == previewPathPrefix {
+		base += previewPathPrefix + parts[2]
+	} else if len(parts) > 1 && strings.HasPrefix(parts[1], "@") && isVersionRef(parts[1][1:]) {
+		base += "/" + parts[1]
+	}
+
+	target := base + r.URL.Path
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	return target, true
+}
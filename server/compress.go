@@ -0,0 +1,306 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	minCompressSize      = 1024     // 小于该大小的文件压缩收益不明显，直接发送
+	maxCompressSize      = 10 << 20 // 超过该大小的文件不做实时压缩，避免占用过多内存
+	compressionCacheSize = 64 << 20 // 实时压缩结果缓存的最大字节数
+)
+
+// precompressedEncodings 预压缩文件的编码和扩展名，按优先级排列
+var precompressedEncodings = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// isCompressible 判断内容类型是否值得压缩（图片、字体等已压缩的格式除外）
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/javascript",
+		mediaType == "application/json",
+		mediaType == "application/xml",
+		mediaType == "image/svg+xml",
+		mediaType == "image/x-icon",
+		mediaType == "application/vnd.ms-fontobject",
+		mediaType == "font/ttf":
+		return true
+	}
+	return false
+}
+
+// acceptsEncoding 判断请求的 Accept-Encoding 是否接受指定编码（q=0 表示拒绝）
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	accepted := false
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != encoding && name != "*" {
+				continue
+			}
+			q := 1.0
+			if key, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(key) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+			if name == encoding {
+				// 明确列出的编码优先于通配符
+				return q > 0
+			}
+			accepted = q > 0
+		}
+	}
+	return accepted
+}
+
+// addVary 添加 Vary 响应头（不重复添加）
+func addVary(w http.ResponseWriter, value string) {
+	for _, existing := range w.Header().Values("Vary") {
+		for _, part := range strings.Split(existing, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), value) {
+				return
+			}
+		}
+	}
+	w.Header().Add("Vary", value)
+}
+
+// openPrecompressed 查找请求可以接受的预压缩文件（x.js.br、x.js.gz）
+// 比原文件旧的预压缩文件视为过期，不会使用
+func openPrecompressed(r *http.Request, filePath string, info os.FileInfo) (*os.File, os.FileInfo, string) {
+	for _, variant := range precompressedEncodings {
+		if !acceptsEncoding(r, variant.encoding) {
+			continue
+		}
+		siblingInfo, err := os.Stat(filePath + variant.ext)
+		if err != nil || !siblingInfo.Mode().IsRegular() || siblingInfo.ModTime().Before(info.ModTime()) {
+			continue
+		}
+		sibling, err := os.Open(filePath + variant.ext)
+		if err != nil {
+			continue
+		}
+		return sibling, siblingInfo, variant.encoding
+	}
+	return nil, nil, ""
+}
+
+// hasPrecompressed 判断文件是否有预压缩版本（用于决定是否需要 Vary 头）
+func hasPrecompressed(filePath string) bool {
+	for _, variant := range precompressedEncodings {
+		if _, err := os.Stat(filePath + variant.ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// compressionCache 实时 gzip 压缩结果的 LRU 缓存，按字节数限制容量
+type compressionCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // 最近使用的在前
+	entries  map[string]*list.Element
+}
+
+// compressionEntry 缓存条目
+type compressionEntry struct {
+	key  string
+	data []byte
+}
+
+// newCompressionCache 创建压缩缓存
+func newCompressionCache(maxBytes int64) *compressionCache {
+	return &compressionCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// gzip 返回内容的 gzip 压缩结果，key 唯一标识内容（如路径+大小+修改时间，或版本对象ID）
+func (c *compressionCache) gzip(key string, content io.Reader) ([]byte, error) {
+	c.mu.Lock()
+	if elem, exists := c.entries[key]; exists {
+		c.order.MoveToFront(elem)
+		data := elem.Value.(*compressionEntry).data
+		c.mu.Unlock()
+		return data, nil
+	}
+	c.mu.Unlock()
+
+	// 压缩在锁外进行，并发请求同一文件时可能重复压缩，结果相同
+	data, err := gzipBytes(content)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; !exists && int64(len(data)) <= c.maxBytes {
+		c.entries[key] = c.order.PushFront(&compressionEntry{key: key, data: data})
+		c.size += int64(len(data))
+		for c.size > c.maxBytes {
+			oldest := c.order.Back()
+			entry := oldest.Value.(*compressionEntry)
+			c.order.Remove(oldest)
+			delete(c.entries, entry.key)
+			c.size -= int64(len(entry.data))
+		}
+	}
+	return data, nil
+}
+
+// gzipBytes 使用最高压缩率压缩内容
+func gzipBytes(content io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(writer, content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// shouldCompress 判断响应是否应实时压缩
+func shouldCompress(r *http.Request, contentType string, size int64) bool {
+	return isCompressible(contentType) && size >= minCompressSize && size <= maxCompressSize &&
+		r.Header.Get("Range") == "" && acceptsEncoding(r, "gzip")
+}
+
+// precompressTree 为目录中可压缩的文件生成 .gz 预压缩文件（部署时可选）
+// 已有不旧于原文件的 .gz 时跳过；太小或压缩后没有变小的文件不生成，并删除之前生成、已经过期的 .gz
+func precompressTree(dir string, contentType func(string) string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			// 遍历过程中删除的过期 .gz
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext == ".gz" || ext == ".br" || !isCompressible(contentType(path)) {
+			return nil
+		}
+		if info.Size() < minCompressSize {
+			return removeStalePrecompressed(path, info)
+		}
+		if existing, err := os.Stat(path + ".gz"); err == nil && !existing.ModTime().Before(info.ModTime()) {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		data, err := gzipBytes(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) >= info.Size() {
+			return removeStalePrecompressed(path, info)
+		}
+
+		// 先写临时文件再重命名，暂存目录中的旧 .gz 可能是线上文件的硬链接
+		if err := writeFileAtomic(path+".gz", data); err != nil {
+			return err
+		}
+		return os.Chtimes(path+".gz", info.ModTime(), info.ModTime())
+	})
+}
+
+// removeStalePrecompressed 删除早于原文件的 .gz 预压缩文件（原文件变化后不再需要），
+// 不早于原文件的 .gz 是随部署包上传的，保留
+func removeStalePrecompressed(path string, info os.FileInfo) error {
+	gz, err := os.Stat(path + ".gz")
+	if err != nil || !gz.ModTime().Before(info.ModTime()) {
+		return nil
+	}
+	if err := os.Remove(path + ".gz"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// isGeneratedGzip 判断 path.gz 是否为部署时由 precompressTree 生成：生成时会把修改时间设为与原文件相同，
+// 内容与重新压缩原文件的结果一致。用户随部署包上传的 .gz、.br 文件是网站内容，即使与原文件同名也不算
+func isGeneratedGzip(path string, info os.FileInfo) bool {
+	gz, err := os.Stat(path + ".gz")
+	if err != nil || !gz.ModTime().Equal(info.ModTime()) {
+		return false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	data, err := gzipBytes(file)
+	file.Close()
+	if err != nil || int64(len(data)) != gz.Size() {
+		return false
+	}
+	existing, err := os.ReadFile(path + ".gz")
+	return err == nil && bytes.Equal(existing, data)
+}
+
+// listContentFiles 列出目录下的内容文件，precompress 为 true 时不含部署时生成的 .gz 预压缩文件
+func listContentFiles(root string, precompress bool) (map[string]os.FileInfo, error) {
+	files, err := listFiles(root)
+	if err != nil || !precompress {
+		return files, err
+	}
+	var generated []string
+	for relPath := range files {
+		original := strings.TrimSuffix(relPath, ".gz")
+		if info, exists := files[original]; exists && original != relPath && isGeneratedGzip(filepath.Join(root, original), info) {
+			generated = append(generated, relPath)
+		}
+	}
+	for _, relPath := range generated {
+		delete(files, relPath)
+	}
+	return files, nil
+}
+
+// precompressStage 按配置为暂存目录生成预压缩文件，失败不影响部署
+func (s *DeployServer) precompressStage(stage string) {
+	if !s.config().Precompress {
+		return
+	}
+	if err := precompressTree(stage, (&StaticFileHandler{}).getContentType); err != nil {
+		fmt.Printf("生成预压缩文件失败: %v\n", err)
+	}
+}
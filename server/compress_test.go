@@ -0,0 +1,146 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// compressibleJS 足够大、可以预压缩的脚本内容
+var compressibleJS = strings.Repeat("console.log('hello');\n", 200)
+
+func TestPrecompressTreeRemovesStaleSiblings(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"app.js":      compressibleJS,
+		"small.js":    "console.log(1)",
+		"small.js.gz": "uploaded",
+		"old.js":      "console.log(2)",
+		"old.js.gz":   "stale",
+	})
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "old.js.gz"), past, past); err != nil {
+		t.Fatal(err)
+	}
+	contentType := (&StaticFileHandler{}).getContentType
+
+	if err := precompressTree(dir, contentType); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.js.gz")); err != nil {
+		t.Errorf("app.js.gz was not generated: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.js.gz")); !os.IsNotExist(err) {
+		t.Errorf("stale old.js.gz was kept: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "small.js.gz")); err != nil || string(data) != "uploaded" {
+		t.Errorf("uploaded small.js.gz = %q, %v, want it kept", data, err)
+	}
+
+	// 文件变小到不再压缩后，之前生成的 .gz 也要删除
+	writeTestFiles(t, dir, map[string]string{"app.js": "console.log(3)"})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "app.js"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := precompressTree(dir, contentType); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.js.gz")); !os.IsNotExist(err) {
+		t.Errorf("stale app.js.gz was kept: %v", err)
+	}
+}
+
+func TestCompareTreesIgnoresGeneratedPrecompressed(t *testing.T) {
+	live, stage := t.TempDir(), t.TempDir()
+	writeTestFiles(t, live, map[string]string{
+		"index.html": "<h1>v1</h1>",
+		"app.js":     compressibleJS,
+		"old.js":     compressibleJS + "// old",
+	})
+	writeTestFiles(t, stage, map[string]string{
+		"index.html":  "<h1>v1</h1>",
+		"app.js":      compressibleJS + "// v2",
+		"new.js":      compressibleJS + "// new",
+		"data.csv":    "a,b",
+		"data.csv.gz": "uploaded",
+	})
+	contentType := (&StaticFileHandler{}).getContentType
+	for _, dir := range []string{live, stage} {
+		if err := precompressTree(dir, contentType); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		precompress bool
+		want        DeployStats
+	}{
+		// 生成的 app.js.gz、old.js.gz、new.js.gz 不计入统计，上传的 data.csv.gz 照常统计
+		{true, DeployStats{Added: 3, Replaced: 1, Removed: 1, Unchanged: 1}},
+		{false, DeployStats{Added: 4, Replaced: 2, Removed: 2, Unchanged: 1}},
+	}
+	for _, tt := range tests {
+		stats, err := compareTrees(live, stage, tt.precompress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats != tt.want {
+			t.Errorf("compareTrees(precompress=%v) = %+v, want %+v", tt.precompress, stats, tt.want)
+		}
+	}
+}
+
+func TestCommitKeepsUploadedPrecompressedFiles(t *testing.T) {
+	webRoot := t.TempDir()
+	sitePath := filepath.Join(webRoot, "demo")
+	uploaded := map[string]string{
+		"index.html":  "<h1>demo</h1>",
+		"app.js":      compressibleJS,
+		"app.js.br":   "uploaded br",
+		"data.csv":    "a,b",
+		"data.csv.gz": "uploaded gz",
+	}
+	writeTestFiles(t, sitePath, uploaded)
+	if err := precompressTree(sitePath, (&StaticFileHandler{}).getContentType); err != nil {
+		t.Fatal(err)
+	}
+
+	store := newSnapshotStore(webRoot)
+	store.precompress = func() bool { return true }
+	version, err := store.Commit("demo", sitePath, "v1", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := store.Files("demo", version.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := files["app.js.gz"]; exists {
+		t.Error("snapshot contains the generated app.js.gz")
+	}
+	if len(files) != len(uploaded) {
+		t.Errorf("snapshot has %d files, want the %d uploaded files", len(files), len(uploaded))
+	}
+
+	// 检出后上传的预压缩文件原样恢复
+	dest := filepath.Join(t.TempDir(), "checkout")
+	if err := store.Checkout("demo", version.Hash, dest); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range uploaded {
+		if data, err := os.ReadFile(filepath.Join(dest, name)); err != nil || string(data) != content {
+			t.Errorf("checkout %s = %q, %v, want %q", name, data, err, content)
+		}
+	}
+
+	// 重新生成预压缩文件不产生新版本
+	if err := precompressTree(sitePath, (&StaticFileHandler{}).getContentType); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := store.Commit("demo", sitePath, "v2", "admin"); err != nil || version != nil {
+		t.Errorf("Commit after precompressing again = %v, %v, want no new version", version, err)
+	}
+}
@@ -9,10 +9,12 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,13 +25,20 @@ const userContextKey contextKey = "user"
 
 // Config 服务器配置
 type Config struct {
-	BaseDomain       string            `json:"base_domain"`       // 基础域名（子域名模式）
+	BaseDomain       string            `json:"base_domain"`       // 基础域名（子域名和混合模式）
 	WebRoot          string            `json:"web_root"`          // 网站根目录
-	Mode             string            `json:"mode"`              // 部署模式：subdomain 或 path
-	SingleDomain     string            `json:"single_domain"`     // 单域名模式下的域名
+	Mode             string            `json:"mode"`              // 部署模式：subdomain、path 或 hybrid（子域名和路径同时可用）
+	SingleDomain     string            `json:"single_domain"`     // 单域名（路径和混合模式）下的域名
 	Port             int               `json:"port"`              // 服务器端口
 	EnableVersioning bool              `json:"enable_versioning"` // 是否启用版本控制
 	APIKey           string            `json:"api_key,omitempty"` // API密钥（已弃用，保留兼容）
+	TokenSecret      string            `json:"token_secret,omitempty"` // 访问令牌签名密钥（为空时自动生成）
+	DeployTokens     map[string]DeployToken `json:"deploy_tokens,omitempty"` // 部署令牌（按ID索引）
+	TLS              *TLSConfig        `json:"tls,omitempty"`     // HTTPS 配置
+	PreviewTTLHours  int               `json:"preview_ttl_hours,omitempty"` // 预览部署默认有效期（小时），默认 168
+	Retention        *RetentionPolicy  `json:"retention,omitempty"` // 全局版本保留策略，为空表示保留全部版本
+	Precompress      bool              `json:"precompress,omitempty"` // 部署时为可压缩文件生成 .gz 预压缩文件
+	ProxyHosts       []string          `json:"proxy_hosts,omitempty"` // _redirects 代理规则允许的目标主机（* 表示全部），为空表示禁止代理
 	Sites            map[string]Site   `json:"sites"`             // 网站配置
 	Users            map[string]User   `json:"users"`             // 用户配置
 }
@@ -40,13 +49,21 @@ type Site struct {
 	Desc string   `json:"desc"` // 网站描述
 	Owner string   `json:"owner"` // 所有者
 	Users []string `json:"users"` // 授权用户列表
+	Domains []string `json:"domains,omitempty"` // 自定义域名
+	Access *SiteAccess `json:"access,omitempty"` // 访问策略，为空表示公开
+	Retention *RetentionPolicy `json:"retention,omitempty"` // 版本保留策略，为空表示使用全局策略
+	Headers []HeaderRule `json:"headers,omitempty"` // 响应头规则，优先于部署内容中的 _headers 文件
+	NotFound string `json:"not_found,omitempty"` // 请求路径不存在时的处理方式：spa、strict、custom，为空表示自动
+	PathRewrite string `json:"path_rewrite,omitempty"` // 路径模式下网站访问前缀的处理方式：base、rewrite，为空表示不处理
+	Routing string `json:"routing,omitempty"` // 混合模式下网站的访问方式：subdomain、path，为空表示两种方式都可以
 }
 
 // User 用户配置
 type User struct {
-	Name     string `json:"name"`     // 用户名
-	Password string `json:"pass"`     // 密码
-	IsAdmin  bool   `json:"isAdmin"` // 是否是管理员
+	Name               string `json:"name"`                           // 用户名
+	Password           string `json:"pass,omitempty"`                 // 密码哈希（bcrypt）
+	IsAdmin            bool   `json:"isAdmin"`                        // 是否是管理员
+	MustChangePassword bool   `json:"must_change_password,omitempty"` // 下次登录后必须修改密码
 }
 
 // Website 网站信息
@@ -61,39 +78,75 @@ type Website struct {
 
 // Version 版本信息
 type Version struct {
-	Hash        string    `json:"hash"`
-	Message     string    `json:"message"`
-	Author      string    `json:"author"`
-	Date        time.Time `json:"date"`
+	Hash         string    `json:"hash"`
+	Message      string    `json:"message"`
+	Author       string    `json:"author"`
+	Date         time.Time `json:"date"`
+	FilesChanged int       `json:"files_changed"` // 本次提交变更的文件数
+	Size         int64     `json:"size"`          // 该版本所有文件的总字节数
+	URL          string    `json:"url,omitempty"` // 历史版本只读访问地址
+	Tags         []string  `json:"tags,omitempty"` // 版本标签
 }
 
 // DeployServer 部署服务器
 type DeployServer struct {
-	config         Config
+	conf           atomic.Pointer[Config] // 当前配置，通过 s.config() 读取
 	sites          map[string]*Website
 	mu             sync.RWMutex
-	configPath     string // 配置文件路径
+	configPath     string     // 配置文件路径
+	locks          *siteLocks    // 网站级部署/切换锁
+	sessions       *sessionStore // 登录会话
+	domains        *domainIndex  // 自定义域名索引
+	previews       *previewStore // 预览部署索引
+	versions       VersionStore  // 网站版本存储
+	etags          *etagCache    // 文件内容哈希 ETag 缓存
+	router         *staticRouter // 当前部署模式的静态文件处理器，配置热加载时替换（由 s.mu 保护）
+	configLoader   ConfigLoader  // 配置热加载使用的加载函数，为空表示不监视配置文件
+	configHashMu   sync.Mutex
+	configHash     string        // 最近一次加载或保存的配置文件内容哈希，用于忽略服务器自己写入的变化
 }
 
 // NewDeployServer 创建新的部署服务器
 func NewDeployServer(config Config, configPath string) *DeployServer {
+	versions := newSnapshotStore(config.WebRoot)
 	s := &DeployServer{
-		config:     config,
 		sites:      make(map[string]*Website),
 		configPath: configPath,
-	}
+		locks:      newSiteLocks(),
+		sessions:   newSessionStore(configPath),
+		domains:    newDomainIndex(),
+		previews:   newPreviewStore(config.WebRoot),
+		versions:   versions,
+		etags:      newETagCache(),
+	}
+	s.conf.Store(&config)
+	versions.precompress = func() bool { return s.config().Precompress }
+	// 确保令牌签名密钥存在
+	s.ensureTokenSecret()
+	// 迁移明文密码
+	s.migratePasswords()
+	// 迁移网站目录中旧的 git 版本历史
+	s.migrateGitHistories()
 	// 从配置文件加载网站信息
 	s.reloadSitesFromConfig()
 	return s
 }
 
+// config 返回当前配置。热加载时整体替换为新的配置，已取得的配置中的普通字段不会再被修改，
+// 无需加锁即可读取；Sites、Users、DeployTokens 的内容仍然需要持有 s.mu 读写
+func (s *DeployServer) config() *Config {
+	return s.conf.Load()
+}
+
 // saveConfig 保存配置到文件
 func (s *DeployServer) saveConfig() error {
-	data, err := json.MarshalIndent(s.config, "", "  ")
+	data, err := json.MarshalIndent(s.config(), "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.configPath, data, 0644)
+	// 先记录内容哈希再原子替换文件，配置监视不会读到写了一半的文件，也不会把自己写入的内容当作外部修改
+	s.setConfigHash(data)
+	return writeFileAtomic(s.configPath, data)
 }
 
 // reloadSitesFromConfig 从配置重新加载网站信息到内存
@@ -102,14 +155,15 @@ func (s *DeployServer) reloadSitesFromConfig() {
 	s.sites = make(map[string]*Website)
 
 	// 从配置中重新加载
-	for name := range s.config.Sites {
-		sitePath := filepath.Join(s.config.WebRoot, name)
+	for name := range s.config().Sites {
+		sitePath := filepath.Join(s.config().WebRoot, name)
 
 		var domain string
-		if s.config.Mode == "subdomain" {
-			domain = fmt.Sprintf("%s.%s", name, s.config.BaseDomain)
+		site := s.config().Sites[name]
+		if subdomain, _ := s.siteRoutings(&site); subdomain {
+			domain = fmt.Sprintf("%s.%s", name, s.config().BaseDomain)
 		} else {
-			domain = fmt.Sprintf("%s/%s", s.config.SingleDomain, name)
+			domain = fmt.Sprintf("%s/%s", s.config().SingleDomain, name)
 		}
 
 		// 尝试读取文件信息获取时间戳
@@ -131,25 +185,38 @@ func (s *DeployServer) reloadSitesFromConfig() {
 			UpdatedAt: updated,
 		}
 	}
+
+	// 重建自定义域名索引
+	s.domains.rebuild(s.config().Sites)
 }
 
 // authenticate 用户认证
 func (s *DeployServer) authenticate(username, password string) (*User, error) {
-	user, exists := s.config.Users[username]
+	s.mu.RLock()
+	user, exists := s.config().Users[username]
+	s.mu.RUnlock()
 	if !exists {
 		return nil, fmt.Errorf("用户不存在")
 	}
 
-	if user.Password != password {
+	if !checkPassword(user.Password, password) {
 		return nil, fmt.Errorf("密码错误")
 	}
 
+	// 明文密码在首次登录成功后迁移为哈希
+	if !isPasswordHash(user.Password) {
+		s.upgradePassword(username, password)
+		s.mu.RLock()
+		user = s.config().Users[username]
+		s.mu.RUnlock()
+	}
+
 	return &user, nil
 }
 
-// canAccessSite 检查用户是否有权限访问网站
+// canAccessSite 检查用户是否有权限访问网站（调用方需持有 s.mu）
 func (s *DeployServer) canAccessSite(siteName, username string, user *User) bool {
-	site, exists := s.config.Sites[siteName]
+	site, exists := s.config().Sites[siteName]
 	if !exists {
 		return false
 	}
@@ -174,9 +241,9 @@ func (s *DeployServer) canAccessSite(siteName, username string, user *User) bool
 	return false
 }
 
-// isSiteOwner 检查用户是否是网站的所有者
+// isSiteOwner 检查用户是否是网站的所有者（调用方需持有 s.mu）
 func (s *DeployServer) isSiteOwner(siteName, username string) bool {
-	site, exists := s.config.Sites[siteName]
+	site, exists := s.config().Sites[siteName]
 	if !exists {
 		return false
 	}
@@ -212,16 +279,106 @@ func (s *DeployServer) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// staticRouter 按部署模式组装的静态文件处理器
+type staticRouter struct {
+	handler  http.Handler       // 处理网站访问请求
+	resolver *StaticFileHandler // 按主机名解析网站，用于选择网站独立证书
+}
+
+// newStaticRouter 按当前配置的部署模式和域名组装静态文件处理器（调用方需持有 s.mu），
+// 各处理器共享 base 中的缓存、网站锁和网站设置
+func (s *DeployServer) newStaticRouter(base *StaticFileHandler) *staticRouter {
+	fileHandler := *base
+	fileHandler.mode = s.config().Mode
+	fileHandler.baseDomain = s.config().BaseDomain
+	fileHandler.singleDomain = s.config().SingleDomain
+
+	switch s.config().Mode {
+	case "subdomain":
+		return &staticRouter{handler: &fileHandler, resolver: &fileHandler}
+	case "hybrid":
+		hybridHandler := NewHybridModeHandler(&fileHandler)
+		return &staticRouter{handler: hybridHandler, resolver: hybridHandler.subdomain}
+	}
+	return &staticRouter{
+		handler:  &PathModeHandler{StaticFileHandler: &fileHandler},
+		resolver: &fileHandler,
+	}
+}
+
+// currentRouter 返回当前的静态文件处理器
+func (s *DeployServer) currentRouter() *staticRouter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.router
+}
+
 // Start 启动服务器
 func (s *DeployServer) Start() error {
 	// 确保web根目录存在
-	if err := os.MkdirAll(s.config.WebRoot, 0755); err != nil {
+	if err := os.MkdirAll(s.config().WebRoot, 0755); err != nil {
 		return fmt.Errorf("创建web根目录失败: %v", err)
 	}
 
+	// 清理上次异常退出残留的暂存目录
+	os.RemoveAll(s.stagingRoot())
+
+	// 定期清理过期的预览部署
+	go s.cleanupPreviews()
+
+	// 定期按保留策略清理旧版本并回收内容对象
+	go s.enforceRetention()
+
+	handler := s.newHandler()
+
+	// 监视配置文件变化和 SIGHUP 信号，热加载配置
+	if s.configLoader != nil {
+		s.setConfigHashFromFile()
+		go s.watchConfig()
+	}
+
+	fmt.Printf("部署模式: %s, 基础域名: %s\n", s.config().Mode, s.config().BaseDomain)
+	switch s.config().Mode {
+	case "subdomain":
+		fmt.Printf("访问格式: %s://site-name.%s\n", s.publicScheme(), s.config().BaseDomain)
+	case "hybrid":
+		pathDomain := s.config().SingleDomain
+		if pathDomain == "" {
+			pathDomain = s.config().BaseDomain
+		}
+		fmt.Printf("访问格式: %s://site-name.%s 或 %s://%s/site-name\n", s.publicScheme(), s.config().BaseDomain, s.publicScheme(), pathDomain)
+	default:
+		fmt.Printf("访问格式: %s://%s/site-name\n", s.publicScheme(), s.config().SingleDomain)
+	}
+
+	if s.tlsEnabled() {
+		// 按 SNI 主机名解析网站，用于选择网站独立证书
+		resolveSite := func(host string) string {
+			siteName, err := s.currentRouter().resolver.extractSiteName(host)
+			if err != nil {
+				return ""
+			}
+			return siteName
+		}
+		return s.serveTLS(handler, resolveSite)
+	}
+
+	addr := fmt.Sprintf(":%d", s.config().Port)
+	fmt.Printf("服务器启动在 http://localhost%s\n", addr)
+	return http.ListenAndServe(addr, handler)
+}
+
+// newHandler 创建处理全部请求的处理器：/api/ 交给 API 路由，其余按当前部署模式作为静态网站访问
+func (s *DeployServer) newHandler() http.Handler {
 	// 创建API路由
 	mux := http.NewServeMux()
 
+	// 认证路由（无需预先认证）
+	mux.HandleFunc("/api/auth/login", s.corsMiddleware(s.handleLogin))
+	mux.HandleFunc("/api/auth/refresh", s.corsMiddleware(s.handleRefreshToken))
+	mux.HandleFunc("/api/auth/logout", s.corsMiddleware(s.handleLogout))
+	mux.HandleFunc("/api/auth/change-password", s.corsMiddleware(s.handleChangePassword))
+
 	// API路由
 	mux.HandleFunc("/api/sites", s.corsMiddleware(s.authMiddleware(s.handleSites)))
 	mux.HandleFunc("/api/sites/create", s.corsMiddleware(s.authMiddleware(s.handleCreateSite)))
@@ -232,8 +389,20 @@ func (s *DeployServer) Start() error {
 	mux.HandleFunc("/api/sites/deploy-incremental", s.corsMiddleware(s.authMiddleware(s.handleDeployIncremental))) // 增量部署
 	mux.HandleFunc("/api/sites/versions", s.corsMiddleware(s.authMiddleware(s.handleVersions)))
 	mux.HandleFunc("/api/sites/rollback", s.corsMiddleware(s.authMiddleware(s.handleRollback)))
+	mux.HandleFunc("/api/sites/diff", s.corsMiddleware(s.authMiddleware(s.handleDiff)))
+	mux.HandleFunc("/api/sites/tags", s.corsMiddleware(s.authMiddleware(s.handleTags)))
+	mux.HandleFunc("/api/sites/tags/create", s.corsMiddleware(s.authMiddleware(s.handleCreateTag)))
+	mux.HandleFunc("/api/sites/tags/delete", s.corsMiddleware(s.authMiddleware(s.handleDeleteTag)))
 	mux.HandleFunc("/api/sites/list", s.corsMiddleware(s.authMiddleware(s.handleListSites)))
 	mux.HandleFunc("/api/sites/export", s.corsMiddleware(s.authMiddleware(s.handleExport)))
+	mux.HandleFunc("/api/sites/previews", s.corsMiddleware(s.authMiddleware(s.handleListPreviews)))
+	mux.HandleFunc("/api/sites/previews/delete", s.corsMiddleware(s.authMiddleware(s.handleDeletePreview)))
+	mux.HandleFunc("/api/sites/promote", s.corsMiddleware(s.authMiddleware(s.handlePromotePreview)))
+
+	// 部署令牌管理路由（部署令牌本身不能管理令牌）
+	mux.HandleFunc("/api/tokens/list", s.corsMiddleware(s.authMiddleware(s.handleListTokens)))
+	mux.HandleFunc("/api/tokens/create", s.corsMiddleware(s.authMiddleware(s.handleCreateToken)))
+	mux.HandleFunc("/api/tokens/revoke", s.corsMiddleware(s.authMiddleware(s.handleRevokeToken)))
 
 	// 用户管理路由（需要管理员权限）
 	mux.HandleFunc("/api/users/list", s.corsMiddleware(s.authMiddleware(s.requireAdmin(s.handleListUsers))))
@@ -241,42 +410,48 @@ func (s *DeployServer) Start() error {
 	mux.HandleFunc("/api/users/update", s.corsMiddleware(s.authMiddleware(s.requireAdmin(s.handleUpdateUser))))
 	mux.HandleFunc("/api/users/delete", s.corsMiddleware(s.authMiddleware(s.requireAdmin(s.handleDeleteUser))))
 
+	// 版本维护API（需要管理员权限）
+	mux.HandleFunc("/api/admin/prune", s.corsMiddleware(s.authMiddleware(s.requireAdmin(s.handlePruneVersions))))
+
 	// 网站授权路由
 	mux.HandleFunc("/api/sites/authorize", s.corsMiddleware(s.authMiddleware(s.handleAuthorizeSite)))
 	mux.HandleFunc("/api/sites/unauthorize", s.corsMiddleware(s.authMiddleware(s.handleUnauthorizeSite)))
 
 	// 创建静态文件处理器
-	var staticHandler http.Handler
-	if s.config.Mode == "subdomain" {
-		staticHandler = NewStaticFileHandler(s.config.WebRoot, s.config.Mode, s.config.BaseDomain, s.config.SingleDomain)
-	} else {
-		staticHandler = &PathModeHandler{
-			StaticFileHandler: NewStaticFileHandler(s.config.WebRoot, s.config.Mode, s.config.BaseDomain, s.config.SingleDomain),
-		}
-	}
+	fileHandler := NewStaticFileHandler(s.config().WebRoot, s.config().Mode, s.config().BaseDomain, s.config().SingleDomain)
+	fileHandler.locks = s.locks
+	fileHandler.versions = s.versions
+	fileHandler.domains = s.domains
+	fileHandler.previews = s.previews
+	fileHandler.etags = s.etags
+	fileHandler.siteSettings = s.siteServeSettings
+	fileHandler.allowProxy = s.allowProxyHost
+	fileHandler.authorize = s.authorizeSiteRequest
+	s.mu.Lock()
+	s.router = s.newStaticRouter(fileHandler)
+	s.mu.Unlock()
 
 	// 创建最终处理器
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// API请求使用mux处理
 		if strings.HasPrefix(r.URL.Path, "/api/") {
 			mux.ServeHTTP(w, r)
 			return
 		}
 
+		// 网站访问登录（users 访问策略）
+		switch r.URL.Path {
+		case siteLoginPath:
+			s.handleSiteLogin(w, r)
+			return
+		case siteLogoutPath:
+			s.handleSiteLogout(w, r)
+			return
+		}
+
 		// 其他请求使用静态文件处理器
-		staticHandler.ServeHTTP(w, r)
+		s.currentRouter().handler.ServeHTTP(w, r)
 	})
-
-	addr := fmt.Sprintf(":%d", s.config.Port)
-	fmt.Printf("服务器启动在 http://localhost%s\n", addr)
-	fmt.Printf("部署模式: %s, 基础域名: %s\n", s.config.Mode, s.config.BaseDomain)
-	if s.config.Mode == "subdomain" {
-		fmt.Printf("访问格式: http://site-name.%s\n", s.config.BaseDomain)
-	} else {
-		fmt.Printf("访问格式: http://%s/site-name\n", s.config.SingleDomain)
-	}
-
-	return http.ListenAndServe(addr, handler)
 }
 
 // corsMiddleware CORS中间件
@@ -284,7 +459,8 @@ func (s *DeployServer) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, X-Username, X-Password")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Offset")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -297,18 +473,15 @@ func (s *DeployServer) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 // getUserFromRequest 从请求中获取用户信息
 func (s *DeployServer) getUserFromRequest(r *http.Request) (*User, error) {
-	// 优先使用新的用户名/密码认证
-	username := r.Header.Get("X-Username")
-	password := r.Header.Get("X-Password")
-
-	if username != "" && password != "" {
-		return s.authenticate(username, password)
+	// 优先使用登录签发的访问令牌
+	if token := bearerToken(r); token != "" {
+		return s.userFromAccessToken(token)
 	}
 
 	// 兼容旧的 API Key 认证
-	if s.config.APIKey != "" {
+	if s.config().APIKey != "" {
 		providedKey := r.Header.Get("X-API-Key")
-		if providedKey == s.config.APIKey {
+		if providedKey == s.config().APIKey {
 			// API Key 认证通过，返回管理员权限
 			return &User{
 				Name:    "admin",
@@ -326,7 +499,16 @@ func (s *DeployServer) getUserFromRequest(r *http.Request) (*User, error) {
 func (s *DeployServer) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// 如果配置了用户系统，使用用户认证
-		if len(s.config.Users) > 0 {
+		s.mu.RLock()
+		hasUsers := len(s.config().Users) > 0
+		s.mu.RUnlock()
+		if hasUsers {
+			// 部署令牌（CI 使用）的权限受令牌范围限制
+			if token := bearerToken(r); strings.HasPrefix(token, deployTokenPrefix) {
+				s.serveWithDeployToken(w, r, token, next)
+				return
+			}
+
 			user, err := s.getUserFromRequest(r)
 			if err != nil {
 				w.Header().Set("Content-Type", "application/json")
@@ -337,6 +519,16 @@ func (s *DeployServer) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 				return
 			}
 
+			// 使用默认密码的账号必须先修改密码
+			if user.MustChangePassword {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": "请先修改默认密码",
+				})
+				return
+			}
+
 			// 将用户信息存储到请求上下文中
 			ctx := contextWithUser(r.Context(), user)
 			next(w, r.WithContext(ctx))
@@ -344,9 +536,9 @@ func (s *DeployServer) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		// 兼容旧的 API Key 认证
-		if s.config.APIKey != "" {
+		if s.config().APIKey != "" {
 			providedKey := r.Header.Get("X-API-Key")
-			if providedKey != s.config.APIKey {
+			if providedKey != s.config().APIKey {
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusUnauthorized)
 				json.NewEncoder(w).Encode(map[string]string{
@@ -386,7 +578,7 @@ func (s *DeployServer) handleListSites(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entries, err := os.ReadDir(s.config.WebRoot)
+	entries, err := os.ReadDir(s.config().WebRoot)
 	if err != nil {
 		s.respondError(w, fmt.Sprintf("读取目录失败: %v", err), http.StatusInternalServerError)
 		return
@@ -395,12 +587,12 @@ func (s *DeployServer) handleListSites(w http.ResponseWriter, r *http.Request) {
 	// 获取当前用户
 	user := userFromContext(r.Context())
 
-	// 获取请求的协议和主机
-	scheme := "http"
+	// 获取对外访问的协议和主机
+	scheme := s.publicScheme()
 	if r.TLS != nil {
 		scheme = "https"
 	}
-	host := r.Host
+	host := s.publicHost(r.Host)
 
 	// 构建网站信息列表
 	type SiteInfo struct {
@@ -409,11 +601,24 @@ func (s *DeployServer) handleListSites(w http.ResponseWriter, r *http.Request) {
 		Desc   string   `json:"desc"`
 		URL    string   `json:"url"`
 		Users  []string `json:"users"`
+		Domains []string `json:"domains"` // 自定义域名
+		Access SiteAccessInfo `json:"access"` // 访问策略
+		Retention *RetentionPolicy `json:"retention"` // 生效的版本保留策略，为空表示保留全部版本
+		RetentionInherited bool `json:"retention_inherited"` // 是否使用全局策略
+		Headers []HeaderRule `json:"headers,omitempty"` // 网站设置中的响应头规则
+		NotFound string `json:"not_found"` // 404 处理方式，为空表示自动
+		PathRewrite string `json:"path_rewrite"` // 路径模式下访问前缀的处理方式，为空表示不处理
+		Routing string `json:"routing"` // 混合模式下的访问方式，为空表示两种方式都可以
+		URLs []string `json:"urls"` // 所有访问地址（子域名、路径和自定义域名）
 	}
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	sites := []SiteInfo{}
 	for _, entry := range entries {
-		if entry.IsDir() {
+		// 跳过暂存等隐藏目录
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			siteName := entry.Name()
 
 			// 如果配置了用户系统，进行权限过滤
@@ -424,8 +629,13 @@ func (s *DeployServer) handleListSites(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			// 部署令牌只列出授权范围内的网站
+			if token := deployTokenFromContext(r.Context()); token != nil && !token.allowsSite(siteName) {
+				continue
+			}
+
 			// 从配置中获取网站信息
-			siteConfig, exists := s.config.Sites[siteName]
+			siteConfig, exists := s.config().Sites[siteName]
 			var desc string
 			if exists {
 				desc = siteConfig.Desc
@@ -434,23 +644,25 @@ func (s *DeployServer) handleListSites(w http.ResponseWriter, r *http.Request) {
 			var siteURL string
 			var domain string
 
-			// 根据模式生成 URL
-			if s.config.Mode == "subdomain" {
+			domains := siteConfig.Domains
+			if domains == nil {
+				domains = []string{}
+			}
+
+			// 根据模式生成 URL，混合模式下优先使用子域名地址
+			if subdomain, _ := s.siteRoutings(&siteConfig); subdomain {
 				// 子域名模式: siteName.baseDomain
-				domain = fmt.Sprintf("%s.%s", siteName, s.config.BaseDomain)
+				// 非默认端口时带上端口
+				domain = s.publicHost(fmt.Sprintf("%s.%s", siteName, s.config().BaseDomain))
 				siteURL = fmt.Sprintf("%s://%s", scheme, domain)
-				// 如果有端口，添加端口
-				if s.config.Port != 80 && s.config.Port != 443 {
-					siteURL = fmt.Sprintf("%s:%d", siteURL, s.config.Port)
-					domain = fmt.Sprintf("%s:%d", domain, s.config.Port)
-				}
+			} else if s.config().Mode == "hybrid" {
+				// 混合模式下只能按路径访问: singleDomain/siteName/
+				domain = fmt.Sprintf("%s/%s", s.pathHost(r), siteName)
+				siteURL = fmt.Sprintf("%s://%s/", scheme, domain)
 			} else {
-				// 路径模式: host/siteName
-				domain = fmt.Sprintf("%s/%s", s.config.BaseDomain, siteName)
-				siteURL = fmt.Sprintf("%s://%s", scheme, host)
-				if s.config.Port != 80 && s.config.Port != 443 {
-					siteURL = fmt.Sprintf("%s:%d", siteURL, s.config.Port)
-				}
+				// 路径模式: host/siteName/
+				domain = fmt.Sprintf("%s/%s", s.config().BaseDomain, siteName)
+				siteURL = fmt.Sprintf("%s://%s/%s/", scheme, host, siteName)
 			}
 
 			sites = append(sites, SiteInfo{
@@ -459,6 +671,15 @@ func (s *DeployServer) handleListSites(w http.ResponseWriter, r *http.Request) {
 				Desc:   desc,
 				URL:    siteURL,
 				Users:  siteConfig.Users,
+				Domains: domains,
+				Access: s.siteAccessInfo(r, siteName, &siteConfig),
+				Retention: s.retentionPolicy(siteName),
+				RetentionInherited: siteConfig.Retention == nil,
+				Headers: siteConfig.Headers,
+				NotFound: siteConfig.NotFound,
+				PathRewrite: siteConfig.PathRewrite,
+				Routing: siteConfig.Routing,
+				URLs: s.siteURLs(r, siteName, &siteConfig),
 			})
 		}
 	}
@@ -476,8 +697,9 @@ func (s *DeployServer) handleCreateSite(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req struct {
-		Name string `json:"name"`
-		Desc string `json:"desc"`
+		Name    string   `json:"name"`
+		Desc    string   `json:"desc"`
+		Domains []string `json:"domains"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -516,16 +738,33 @@ func (s *DeployServer) handleCreateSite(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// "--" 用于子域名模式下的预览地址（label--site）
+	if strings.Contains(name, previewHostSeparator) {
+		s.respondError(w, "网站名称不能包含 '--'", http.StatusBadRequest)
+		return
+	}
+
+	domains, err := normalizeDomains(req.Domains)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// 检查配置文件中是否已存在
-	if _, exists := s.config.Sites[name]; exists {
+	if _, exists := s.config().Sites[name]; exists {
 		s.respondError(w, "网站已存在", http.StatusConflict)
 		return
 	}
 
-	sitePath := filepath.Join(s.config.WebRoot, name)
+	if err := s.checkDomainConflicts(name, domains); err != nil {
+		s.respondError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, name)
 	if _, err := os.Stat(sitePath); err == nil {
 		s.respondError(w, "网站目录已存在", http.StatusConflict)
 		return
@@ -537,20 +776,21 @@ func (s *DeployServer) handleCreateSite(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 初始化git仓库
-	if s.config.EnableVersioning {
-		if err := s.initGitRepo(sitePath); err != nil {
-			s.respondError(w, fmt.Sprintf("初始化git仓库失败: %v", err), http.StatusInternalServerError)
+	// 初始化版本存储
+	if s.config().EnableVersioning {
+		if err := s.versions.Init(name); err != nil {
+			s.respondError(w, fmt.Sprintf("初始化版本存储失败: %v", err), http.StatusInternalServerError)
 			return
 		}
 	}
 
 	// 在配置中添加网站
-	s.config.Sites[name] = Site{
+	s.config().Sites[name] = Site{
 		Name:   name,
 		Desc:   req.Desc,
 		Owner:  user.Name,
 		Users:  []string{},
+		Domains: domains,
 	}
 
 	// 保存配置
@@ -564,12 +804,13 @@ func (s *DeployServer) handleCreateSite(w http.ResponseWriter, r *http.Request)
 
 	var domain string
 	var url string
-	if s.config.Mode == "subdomain" {
-		domain = fmt.Sprintf("%s.%s", name, s.config.BaseDomain)
-		url = fmt.Sprintf("http://%s", domain)
+	site := s.config().Sites[name]
+	if subdomain, _ := s.siteRoutings(&site); subdomain {
+		domain = fmt.Sprintf("%s.%s", name, s.config().BaseDomain)
+		url = fmt.Sprintf("%s://%s", s.publicScheme(), s.publicHost(domain))
 	} else {
-		domain = fmt.Sprintf("%s/%s", s.config.SingleDomain, name)
-		url = fmt.Sprintf("http://%s/%s", s.config.BaseDomain, name)
+		domain = fmt.Sprintf("%s/%s", s.config().SingleDomain, name)
+		url = fmt.Sprintf("%s://%s/%s/", s.publicScheme(), s.publicHost(s.config().BaseDomain), name)
 	}
 
 	s.respondJSON(w, map[string]interface{}{
@@ -579,6 +820,8 @@ func (s *DeployServer) handleCreateSite(w http.ResponseWriter, r *http.Request)
 		"path":       sitePath,
 		"desc":       req.Desc,
 		"url":        url,
+		"urls":       s.siteURLs(r, name, &site),
+		"domains":    domains,
 		"created_at": time.Now().Format("2006-01-02 15:04:05"),
 		"updated_at": time.Now().Format("2006-01-02 15:04:05"),
 	})
@@ -609,7 +852,7 @@ func (s *DeployServer) handleDeleteSite(w http.ResponseWriter, r *http.Request)
 	defer s.mu.Unlock()
 
 	// 检查配置中是否存在
-	siteConfig, exists := s.config.Sites[req.Name]
+	siteConfig, exists := s.config().Sites[req.Name]
 	if !exists {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
@@ -622,10 +865,10 @@ func (s *DeployServer) handleDeleteSite(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	sitePath := filepath.Join(s.config.WebRoot, req.Name)
+	sitePath := filepath.Join(s.config().WebRoot, req.Name)
 	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
 		// 即使目录不存在，也从配置中删除
-		delete(s.config.Sites, req.Name)
+		delete(s.config().Sites, req.Name)
 		s.saveConfig()
 		s.reloadSitesFromConfig()
 		s.respondError(w, "网站目录不存在，但已从配置中删除", http.StatusNotFound)
@@ -638,8 +881,19 @@ func (s *DeployServer) handleDeleteSite(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 删除网站的预览部署和版本历史
+	if err := s.previews.removeSite(req.Name); err != nil {
+		fmt.Printf("删除网站 %s 的预览失败: %v\n", req.Name, err)
+	}
+	if err := s.versions.Remove(req.Name); err != nil {
+		fmt.Printf("删除网站 %s 的版本历史失败: %v\n", req.Name, err)
+	}
+	// 回收只被该网站引用的内容对象
+	go s.collectVersionGarbage()
+	s.etags.forget(filepath.Join(s.config().WebRoot, req.Name))
+
 	// 从配置中删除
-	delete(s.config.Sites, req.Name)
+	delete(s.config().Sites, req.Name)
 
 	// 保存配置
 	if err := s.saveConfig(); err != nil {
@@ -663,9 +917,16 @@ func (s *DeployServer) handleUpdateSite(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req struct {
-		Name  string   `json:"name"`
-		Desc  string   `json:"desc"`
-		Users []string `json:"users"`
+		Name    string    `json:"name"`
+		Desc    *string   `json:"desc"`    // 为空表示不修改描述
+		Users   *[]string `json:"users"`   // 为空表示不修改授权用户
+		Domains *[]string `json:"domains"` // 为空表示不修改自定义域名
+		Access  *siteAccessRequest `json:"access"` // 为空表示不修改访问策略
+		Retention *retentionRequest `json:"retention"` // 为空表示不修改版本保留策略
+		Headers *[]HeaderRule `json:"headers"` // 为空表示不修改响应头规则，空列表表示清除
+		NotFound *string `json:"not_found"` // 为空表示不修改 404 处理方式
+		PathRewrite *string `json:"path_rewrite"` // 为空表示不修改访问前缀处理方式
+		Routing *string `json:"routing"` // 为空表示不修改混合模式下的访问方式
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -682,7 +943,7 @@ func (s *DeployServer) handleUpdateSite(w http.ResponseWriter, r *http.Request)
 	defer s.mu.Unlock()
 
 	// 检查配置中是否存在
-	siteConfig, exists := s.config.Sites[req.Name]
+	siteConfig, exists := s.config().Sites[req.Name]
 	if !exists {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
@@ -695,10 +956,88 @@ func (s *DeployServer) handleUpdateSite(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 更新自定义域名
+	if req.Domains != nil {
+		domains, err := normalizeDomains(*req.Domains)
+		if err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.checkDomainConflicts(req.Name, domains); err != nil {
+			s.respondError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		siteConfig.Domains = domains
+	}
+
+	// 更新访问策略
+	if req.Access != nil {
+		access, err := buildSiteAccess(req.Access, siteConfig.Access)
+		if err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		siteConfig.Access = access
+	}
+
+	// 更新版本保留策略
+	if req.Retention != nil {
+		retention, err := buildRetention(req.Retention)
+		if err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		siteConfig.Retention = retention
+	}
+
+	// 更新响应头规则
+	if req.Headers != nil {
+		rules := *req.Headers
+		if err := validateHeaderRules(rules); err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(rules) == 0 {
+			rules = nil
+		}
+		siteConfig.Headers = rules
+	}
+
+	// 更新 404 处理方式
+	if req.NotFound != nil {
+		if err := validateNotFoundMode(*req.NotFound); err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		siteConfig.NotFound = *req.NotFound
+	}
+
+	// 更新路径模式下访问前缀的处理方式
+	if req.PathRewrite != nil {
+		if err := validatePathRewrite(*req.PathRewrite); err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		siteConfig.PathRewrite = *req.PathRewrite
+	}
+
+	// 更新混合模式下的访问方式
+	if req.Routing != nil {
+		if err := validateRouting(*req.Routing); err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		siteConfig.Routing = *req.Routing
+	}
+
 	// 更新描述和授权用户
-	siteConfig.Desc = req.Desc
-	siteConfig.Users = req.Users
-	s.config.Sites[req.Name] = siteConfig
+	if req.Desc != nil {
+		siteConfig.Desc = *req.Desc
+	}
+	if req.Users != nil {
+		siteConfig.Users = *req.Users
+	}
+	s.config().Sites[req.Name] = siteConfig
 
 	// 保存配置
 	if err := s.saveConfig(); err != nil {
@@ -711,6 +1050,7 @@ func (s *DeployServer) handleUpdateSite(w http.ResponseWriter, r *http.Request)
 
 	s.respondJSON(w, map[string]interface{}{
 		"message": "更新成功",
+		"access":  s.siteAccessInfo(r, req.Name, &siteConfig),
 	})
 }
 
@@ -738,6 +1078,15 @@ func (s *DeployServer) handleDeploy(w http.ResponseWriter, r *http.Request) {
 		message = "更新部署"
 	}
 
+	// 部署后为新版本设置标签
+	tag := r.FormValue("tag")
+	if tag != "" {
+		if err := validateTagName(tag); err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		s.respondError(w, "获取文件失败", http.StatusBadRequest)
@@ -745,49 +1094,77 @@ func (s *DeployServer) handleDeploy(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	sitePath := filepath.Join(s.config.WebRoot, name)
+	if err := s.checkTokenSite(r, name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, name)
 	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
 	}
 
-	// 清空现有文件（保留.git目录）
-	entries, _ := os.ReadDir(sitePath)
-	for _, entry := range entries {
-		if entry.Name() != ".git" {
-			os.RemoveAll(filepath.Join(sitePath, entry.Name()))
+	lock := s.locks.get(name)
+	lock.deploy.Lock()
+	defer lock.deploy.Unlock()
+
+	if tag != "" {
+		if err := s.checkTagAvailable(name, tag); err != nil {
+			s.respondError(w, err.Error(), http.StatusConflict)
+			return
 		}
 	}
 
+	// 在空的暂存目录中准备新版本（单文件部署不保留旧文件）
+	stage, err := s.newStage(name, false)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(stage)
+
 	// 保存上传的文件
 	filename := header.Filename
 	if filename == "" {
 		filename = "index.html"
 	}
 
-	destPath := filepath.Join(sitePath, filename)
-	destFile, err := os.Create(destPath)
+	stagePath := filepath.Join(stage, filename)
+	destFile, err := os.Create(stagePath)
 	if err != nil {
 		s.respondError(w, fmt.Sprintf("创建文件失败: %v", err), http.StatusInternalServerError)
 		return
 	}
-	defer destFile.Close()
 
 	if _, err := io.Copy(destFile, file); err != nil {
+		destFile.Close()
 		s.respondError(w, "保存文件失败", http.StatusInternalServerError)
 		return
 	}
+	destFile.Close()
 
 	// 如果是HTML文件，解压相关资源
 	if strings.HasSuffix(strings.ToLower(filename), ".html") {
-		s.extractHTMLResources(destPath, sitePath)
+		s.extractHTMLResources(stagePath, stage)
+	}
+
+	s.precompressStage(stage)
+
+	// 切换为线上版本
+	if err := s.activateStage(name, stage); err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	destPath := filepath.Join(sitePath, filename)
 
-	// Git提交
-	if s.config.EnableVersioning {
-		if err := s.commitChanges(sitePath, message); err != nil {
+	// 保存版本
+	if s.config().EnableVersioning {
+		if err := s.commitChanges(name, message, requestAuthor(r)); err != nil {
 			// 提交失败不影响部署
-			fmt.Printf("Git提交失败: %v\n", err)
+			fmt.Printf("版本提交失败: %v\n", err)
+		} else if tag != "" {
+			s.tagDeployment(name, tag)
 		}
 	}
 
@@ -822,23 +1199,43 @@ func (s *DeployServer) handleVersions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sitePath := filepath.Join(s.config.WebRoot, name)
+	query, err := parseVersionQuery(r.URL.Query())
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.checkTokenSite(r, name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, name)
 	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
 	}
 
-	if !s.config.EnableVersioning {
+	if !s.config().EnableVersioning {
 		s.respondError(w, "版本控制未启用", http.StatusBadRequest)
 		return
 	}
 
-	versions, err := s.getGitVersions(sitePath)
+	versions, total, err := s.versions.List(name, query)
 	if err != nil {
 		s.respondError(w, fmt.Sprintf("获取版本失败: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	for i := range versions {
+		versions[i].URL = s.versionURL(r, name, versions[i].Hash)
+	}
+
+	// 响应体保持版本数组，分页信息通过响应头返回
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if next := query.Offset + len(versions); next < total {
+		w.Header().Set("X-Next-Offset", strconv.Itoa(next))
+	}
 	s.respondJSON(w, versions)
 }
 
@@ -869,18 +1266,27 @@ func (s *DeployServer) handleRollback(w http.ResponseWriter, r *http.Request) {
 		req.Message = "回滚版本"
 	}
 
-	sitePath := filepath.Join(s.config.WebRoot, req.Name)
+	if err := s.checkTokenSite(r, req.Name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, req.Name)
 	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
 	}
 
-	if !s.config.EnableVersioning {
+	if !s.config().EnableVersioning {
 		s.respondError(w, "版本控制未启用", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.rollbackVersion(sitePath, req.Hash, req.Message); err != nil {
+	lock := s.locks.get(req.Name)
+	lock.deploy.Lock()
+	defer lock.deploy.Unlock()
+
+	if err := s.rollbackVersion(req.Name, req.Hash, req.Message, requestAuthor(r)); err != nil {
 		s.respondError(w, fmt.Sprintf("回滚失败: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -890,137 +1296,54 @@ func (s *DeployServer) handleRollback(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// initGitRepo 初始化git仓库
-func (s *DeployServer) initGitRepo(path string) error {
-	cmd := exec.Command("git", "init")
-	cmd.Dir = path
-	if err := cmd.Run(); err != nil {
-		return err
+// requestAuthor 版本作者：发起请求的用户（部署令牌为其所属用户）
+func requestAuthor(r *http.Request) string {
+	if user := userFromContext(r.Context()); user != nil {
+		return user.Name
 	}
-
-	// 配置用户（如果需要）
-	cmd = exec.Command("git", "config", "user.email", "deployer@local")
-	cmd.Dir = path
-	_ = cmd.Run()
-
-	cmd = exec.Command("git", "config", "user.name", "Deployer")
-	cmd.Dir = path
-	_ = cmd.Run()
-
-	return nil
+	return "Deployer"
 }
 
-// commitChanges 提交更改
-func (s *DeployServer) commitChanges(path, message string) error {
-	// 添加所有文件
-	cmd := exec.Command("git", "add", ".")
-	cmd.Dir = path
-	if err := cmd.Run(); err != nil {
-		return err
-	}
+// commitChanges 将网站当前内容保存为新版本（内容未变化时不创建版本）
+func (s *DeployServer) commitChanges(name, message, author string) error {
+	_, err := s.versions.Commit(name, filepath.Join(s.config().WebRoot, name), message, author)
+	return err
+}
 
-	// 提交
-	cmd = exec.Command("git", "commit", "-m", message)
-	cmd.Dir = path
-	output, err := cmd.CombinedOutput()
+// rollbackVersion 回滚到指定版本
+// 历史版本先检出到暂存目录，再原子切换上线
+func (s *DeployServer) rollbackVersion(name, ref, message, author string) error {
+	hash, err := s.versions.Resolve(name, ref)
 	if err != nil {
-		return fmt.Errorf("%v: %s", err, string(output))
+		return err
 	}
 
-	return nil
-}
-
-// getGitVersions 获取git版本列表
-func (s *DeployServer) getGitVersions(path string) ([]Version, error) {
-	// 首先检查 .git 目录是否存在
-	gitDir := filepath.Join(path, ".git")
-	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
-		// Git 仓库不存在，返回空列表而不是错误
-		return []Version{}, nil
+	// 线上内容与最新版本不一致时（例如上次提交失败），先保存当前状态
+	if err := s.commitChanges(name, "临时提交：回滚前保存", author); err != nil {
+		return fmt.Errorf("保存当前状态失败: %v", err)
 	}
 
-	cmd := exec.Command("git", "log", "--pretty=format:%H|%s|%an|%ai", "-20")
-	cmd.Dir = path
-	output, err := cmd.Output()
+	stage, err := s.newStage(name, false)
 	if err != nil {
-		// 如果 git log 失败（可能没有提交），返回空列表
-		return []Version{}, nil
+		return err
 	}
+	defer os.RemoveAll(stage)
 
-	lines := strings.Split(string(output), "\n")
-	versions := make([]Version, 0, len(lines))
-
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		parts := strings.SplitN(line, "|", 4)
-		if len(parts) != 4 {
-			continue
-		}
-
-		date, err := time.Parse("2006-01-02 15:04:05 -0700", parts[3])
-		if err != nil {
-			continue
-		}
-
-		versions = append(versions, Version{
-			Hash:    parts[0],
-			Message: parts[1],
-			Author:  parts[2],
-			Date:    date,
-		})
+	if err := s.versions.Checkout(name, hash, stage); err != nil {
+		return fmt.Errorf("检出版本失败: %v", err)
 	}
 
-	return versions, nil
-}
-
-// rollbackVersion 回滚到指定版本
-func (s *DeployServer) rollbackVersion(path, hash, message string) error {
-	// 先检查是否有未提交的更改
-	cmd := exec.Command("git", "status", "--porcelain")
-	cmd.Dir = path
-	output, _ := cmd.Output()
-
-	// 如果有未提交的更改，先暂存
-	if len(strings.TrimSpace(string(output))) > 0 {
-		// 创建临时提交保存当前状态
-		cmd = exec.Command("git", "add", ".")
-		cmd.Dir = path
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("暂存当前状态失败: %v", err)
-		}
-
-		cmd = exec.Command("git", "commit", "-m", "临时提交：回滚前保存")
-		cmd.Dir = path
-		_ = cmd.Run() // 忽略错误，可能没有内容需要提交
-	}
-
-	// 使用 git checkout 恢复到指定版本
-	cmd = exec.Command("git", "checkout", hash, "--", ".")
-	cmd.Dir = path
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("回滚失败: %v: %s", err, string(output))
+	if err := validateStage(stage); err != nil {
+		return err
 	}
-
-	// 添加更改的文件
-	cmd = exec.Command("git", "add", "-A")
-	cmd.Dir = path
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("添加文件失败: %v", err)
+	s.precompressStage(stage)
+	if err := s.activateStage(name, stage); err != nil {
+		return err
 	}
 
-	// 创建回滚提交
-	cmd = exec.Command("git", "commit", "-m", message)
-	cmd.Dir = path
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		// 如果没有变更，说明已经在该版本，不算错误
-		if strings.Contains(string(output), "nothing to commit") {
-			return nil
-		}
-		return fmt.Errorf("创建回滚提交失败: %v: %s", err, string(output))
+	// 创建回滚版本（已经是该版本的内容时不会产生新版本）
+	if err := s.commitChanges(name, message, author); err != nil {
+		return fmt.Errorf("创建回滚版本失败: %v", err)
 	}
 
 	return nil
@@ -1059,6 +1382,33 @@ func (s *DeployServer) handleDeployFull(w http.ResponseWriter, r *http.Request)
 		message = "全量部署"
 	}
 
+	// 部署后为新版本设置标签
+	tag := r.FormValue("tag")
+	if tag != "" {
+		if err := validateTagName(tag); err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 指定预览标签时发布到独立的预览地址，不影响线上版本
+	previewLabel := r.FormValue("preview")
+	if previewLabel != "" {
+		if tag != "" {
+			s.respondError(w, "预览部署不能设置版本标签，请在提升为线上版本后设置", http.StatusBadRequest)
+			return
+		}
+		if err := validatePreviewTarget(name, previewLabel); err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// hash--site 形式的子域名用于访问历史版本
+		if isVersionRef(previewLabel) {
+			s.respondError(w, "预览标签不能是版本哈希形式（7-40 位十六进制）", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// 获取上传的文件
 	file, _, err := r.FormFile("package")
 	if err != nil {
@@ -1067,22 +1417,71 @@ func (s *DeployServer) handleDeployFull(w http.ResponseWriter, r *http.Request)
 	}
 	defer file.Close()
 
-	sitePath := filepath.Join(s.config.WebRoot, name)
+	if err := s.checkTokenSite(r, name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, name)
 	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
 	}
 
+	lock := s.locks.get(name)
+	lock.deploy.Lock()
+	defer lock.deploy.Unlock()
+
+	if tag != "" {
+		if err := s.checkTagAvailable(name, tag); err != nil {
+			s.respondError(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	if previewLabel != "" {
+		s.deployPreview(w, r, name, previewLabel, message, file)
+		return
+	}
+
+	// 全量部署从空的暂存目录开始，上线后网站内容与部署包完全一致
+	stage, err := s.newStage(name, false)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(stage)
+
 	// 解压部署包
-	if err := s.extractPackage(file, sitePath); err != nil {
+	if _, err := s.extractPackage(file, stage); err != nil {
 		s.respondError(w, fmt.Sprintf("解压失败: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Git提交
-	if s.config.EnableVersioning {
-		if err := s.commitChanges(sitePath, message); err != nil {
-			fmt.Printf("Git提交失败: %v\n", err)
+	// 校验并统计文件变化
+	if err := validateStage(stage); err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.precompressStage(stage)
+	stats, err := compareTrees(sitePath, stage, s.config().Precompress)
+	if err != nil {
+		s.respondError(w, fmt.Sprintf("统计文件变化失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// 切换为线上版本
+	if err := s.activateStage(name, stage); err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 保存版本
+	if s.config().EnableVersioning {
+		if err := s.commitChanges(name, message, requestAuthor(r)); err != nil {
+			fmt.Printf("版本提交失败: %v\n", err)
+		} else if tag != "" {
+			s.tagDeployment(name, tag)
 		}
 	}
 
@@ -1093,8 +1492,12 @@ func (s *DeployServer) handleDeployFull(w http.ResponseWriter, r *http.Request)
 	s.mu.Unlock()
 
 	s.respondJSON(w, map[string]interface{}{
-		"message": "全量部署成功",
-		"mode":    "full",
+		"message":   "全量部署成功",
+		"mode":      "full",
+		"added":     stats.Added,
+		"replaced":  stats.Replaced,
+		"removed":   stats.Removed,
+		"unchanged": stats.Unchanged,
 	})
 }
 
@@ -1116,6 +1519,15 @@ func (s *DeployServer) handleDeployIncremental(w http.ResponseWriter, r *http.Re
 		message = "增量部署"
 	}
 
+	// 部署后为新版本设置标签
+	tag := r.FormValue("tag")
+	if tag != "" {
+		if err := validateTagName(tag); err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// 获取上传的文件
 	file, _, err := r.FormFile("package")
 	if err != nil {
@@ -1124,22 +1536,70 @@ func (s *DeployServer) handleDeployIncremental(w http.ResponseWriter, r *http.Re
 	}
 	defer file.Close()
 
-	sitePath := filepath.Join(s.config.WebRoot, name)
+	if err := s.checkTokenSite(r, name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, name)
 	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
 	}
 
+	lock := s.locks.get(name)
+	lock.deploy.Lock()
+	defer lock.deploy.Unlock()
+
+	if tag != "" {
+		if err := s.checkTagAvailable(name, tag); err != nil {
+			s.respondError(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	// 以当前版本为基础准备暂存目录
+	stage, err := s.newStage(name, true)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(stage)
+
 	// 解压增量包
-	if err := s.extractPackage(file, sitePath); err != nil {
+	manifest, err := s.extractPackage(file, stage)
+	if err != nil {
 		s.respondError(w, fmt.Sprintf("解压失败: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Git提交
-	if s.config.EnableVersioning {
-		if err := s.commitChanges(sitePath, message); err != nil {
-			fmt.Printf("Git提交失败: %v\n", err)
+	// 应用删除清单
+	var deleted []string
+	if manifest != nil {
+		deleted, err = s.applyDeletions(stage, manifest.Deleted)
+		if err != nil {
+			s.respondError(w, fmt.Sprintf("删除文件失败: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 校验并切换为线上版本
+	if err := validateStage(stage); err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.precompressStage(stage)
+	if err := s.activateStage(name, stage); err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 保存版本
+	if s.config().EnableVersioning {
+		if err := s.commitChanges(name, commitMessageWithDeletions(message, deleted), requestAuthor(r)); err != nil {
+			fmt.Printf("版本提交失败: %v\n", err)
+		} else if tag != "" {
+			s.tagDeployment(name, tag)
 		}
 	}
 
@@ -1152,21 +1612,32 @@ func (s *DeployServer) handleDeployIncremental(w http.ResponseWriter, r *http.Re
 	s.respondJSON(w, map[string]interface{}{
 		"message": "增量部署成功",
 		"mode":    "incremental",
+		"deleted": deleted,
 	})
 }
 
-// extractPackage 解压部署包
-func (s *DeployServer) extractPackage(packageFile io.Reader, destPath string) error {
+// manifestFileName 部署包中保留的清单条目名称，不会被解压到网站目录
+const manifestFileName = ".aideploy-manifest.json"
+
+// PackageManifest 部署包清单
+type PackageManifest struct {
+	Deleted []string `json:"deleted"` // 需要删除的文件（相对路径，使用"/"分隔）
+}
+
+// extractPackage 解压部署包，如果包中带有清单则一并返回
+func (s *DeployServer) extractPackage(packageFile io.Reader, destPath string) (*PackageManifest, error) {
 	// 创建gzip reader
 	gzReader, err := gzip.NewReader(packageFile)
 	if err != nil {
-		return fmt.Errorf("创建gzip reader失败: %v", err)
+		return nil, fmt.Errorf("创建gzip reader失败: %v", err)
 	}
 	defer gzReader.Close()
 
 	// 创建tar reader
 	tarReader := tar.NewReader(gzReader)
 
+	var manifest *PackageManifest
+
 	// 遍历tar文件
 	for {
 		header, err := tarReader.Next()
@@ -1174,15 +1645,22 @@ func (s *DeployServer) extractPackage(packageFile io.Reader, destPath string) er
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("读取tar条目失败: %v", err)
+			return nil, fmt.Errorf("读取tar条目失败: %v", err)
 		}
 
-		// 构建目标路径
-		targetPath := filepath.Join(destPath, header.Name)
+		// 清单条目只读取，不落盘
+		if path.Clean(header.Name) == manifestFileName {
+			manifest = &PackageManifest{}
+			if err := json.NewDecoder(tarReader).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("解析部署清单失败: %v", err)
+			}
+			continue
+		}
 
-		// 检查路径安全
-		if !strings.HasPrefix(targetPath, destPath) {
-			return fmt.Errorf("非法路径: %s", header.Name)
+		// 构建目标路径并检查路径安全
+		targetPath, err := safeJoin(destPath, header.Name)
+		if err != nil {
+			return nil, err
 		}
 
 		// 根据文件类型处理
@@ -1190,23 +1668,28 @@ func (s *DeployServer) extractPackage(packageFile io.Reader, destPath string) er
 		case tar.TypeDir:
 			// 创建目录
 			if err := os.MkdirAll(targetPath, 0755); err != nil {
-				return fmt.Errorf("创建目录失败: %v", err)
+				return nil, fmt.Errorf("创建目录失败: %v", err)
 			}
 
 		case tar.TypeReg:
 			// 创建文件
 			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-				return fmt.Errorf("创建父目录失败: %v", err)
+				return nil, fmt.Errorf("创建父目录失败: %v", err)
+			}
+
+			// 先删除再创建，避免改写与线上版本共享的硬链接
+			if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("替换文件失败: %v", err)
 			}
 
 			outFile, err := os.Create(targetPath)
 			if err != nil {
-				return fmt.Errorf("创建文件失败: %v", err)
+				return nil, fmt.Errorf("创建文件失败: %v", err)
 			}
 
 			if _, err := io.Copy(outFile, tarReader); err != nil {
 				outFile.Close()
-				return fmt.Errorf("写入文件失败: %v", err)
+				return nil, fmt.Errorf("写入文件失败: %v", err)
 			}
 			outFile.Close()
 
@@ -1216,7 +1699,90 @@ func (s *DeployServer) extractPackage(packageFile io.Reader, destPath string) er
 		}
 	}
 
-	return nil
+	return manifest, nil
+}
+
+// safeJoin 将包内相对路径拼接到根目录下，拒绝逃逸根目录或指向.git的路径
+func safeJoin(root, name string) (string, error) {
+	cleaned := path.Clean("/" + filepath.ToSlash(name))
+	if cleaned == "/" {
+		return "", fmt.Errorf("非法路径: %s", name)
+	}
+	for _, part := range strings.Split(cleaned, "/") {
+		if part == ".git" {
+			return "", fmt.Errorf("非法路径: %s", name)
+		}
+	}
+
+	root = filepath.Clean(root)
+	target := filepath.Join(root, filepath.FromSlash(cleaned))
+	if !strings.HasPrefix(target, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("非法路径: %s", name)
+	}
+	return target, nil
+}
+
+// applyDeletions 按清单删除网站中的文件，返回实际删除的文件列表
+// 所有路径先全部校验，任何一个非法都不会删除文件
+func (s *DeployServer) applyDeletions(sitePath string, files []string) ([]string, error) {
+	targets := make([]string, 0, len(files))
+	for _, f := range files {
+		target, err := safeJoin(sitePath, f)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	deleted := make([]string, 0, len(targets))
+	for i, target := range targets {
+		info, err := os.Lstat(target)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		// 清单只允许删除文件，不允许整目录删除
+		if info.IsDir() {
+			return deleted, fmt.Errorf("不能删除目录: %s", files[i])
+		}
+		generatedGzip := s.config().Precompress && isGeneratedGzip(target, info)
+		if err := os.Remove(target); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, path.Clean(filepath.ToSlash(files[i])))
+
+		// 同时删除部署时为该文件生成的预压缩文件（用户上传的 .gz 需要在清单中单独删除）
+		if generatedGzip {
+			os.Remove(target + ".gz")
+		}
+
+		// 清理删除后留下的空目录
+		for dir := filepath.Dir(target); dir != filepath.Clean(sitePath); dir = filepath.Dir(dir) {
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+// commitMessageWithDeletions 在提交信息中附加删除的文件列表
+func commitMessageWithDeletions(message string, deleted []string) string {
+	if len(deleted) == 0 {
+		return message
+	}
+	var b strings.Builder
+	b.WriteString(message)
+	b.WriteString("\n\n删除文件:\n")
+	for _, f := range deleted {
+		b.WriteString("- ")
+		b.WriteString(f)
+		b.WriteString("\n")
+	}
+	return b.String()
 }
 
 // FileHash 文件哈希信息
@@ -1243,7 +1809,12 @@ func (s *DeployServer) handleExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sitePath := filepath.Join(s.config.WebRoot, name)
+	if err := s.checkTokenSite(r, name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, name)
 	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
@@ -1326,14 +1897,16 @@ func (s *DeployServer) handleListUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	users := make([]User, 0, len(s.config.Users))
-	for _, user := range s.config.Users {
+	s.mu.RLock()
+	users := make([]User, 0, len(s.config().Users))
+	for _, user := range s.config().Users {
 		users = append(users, User{
 			Name:    user.Name,
 			IsAdmin: user.IsAdmin,
 			// 不返回密码
 		})
 	}
+	s.mu.RUnlock()
 
 	s.respondJSON(w, map[string]interface{}{
 		"users": users,
@@ -1363,18 +1936,29 @@ func (s *DeployServer) handleCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := validateNewPassword(req.Password); err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := HashPassword(req.Password)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.config.Users[req.Name]; exists {
+	if _, exists := s.config().Users[req.Name]; exists {
 		s.respondError(w, "用户已存在", http.StatusConflict)
 		return
 	}
 
-	// 创建用户
-	s.config.Users[req.Name] = User{
+	// 创建用户（只保存密码哈希）
+	s.config().Users[req.Name] = User{
 		Name:     req.Name,
-		Password: req.Password,
+		Password: hash,
 		IsAdmin:  req.IsAdmin,
 	}
 
@@ -1413,18 +1997,30 @@ func (s *DeployServer) handleUpdateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	var hash string
+	if req.Password != "" {
+		if err := validateNewPassword(req.Password); err != nil {
+			s.respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var err error
+		if hash, err = HashPassword(req.Password); err != nil {
+			s.respondError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
-	user, exists := s.config.Users[req.Name]
+	s.mu.Lock()
+	user, exists := s.config().Users[req.Name]
 	if !exists {
+		s.mu.Unlock()
 		s.respondError(w, "用户不存在", http.StatusNotFound)
 		return
 	}
 
-	// 更新密码
-	if req.Password != "" {
-		user.Password = req.Password
+	// 更新密码（只保存密码哈希）
+	if hash != "" {
+		user.Password = hash
 	}
 
 	// 更新管理员权限
@@ -1432,14 +2028,25 @@ func (s *DeployServer) handleUpdateUser(w http.ResponseWriter, r *http.Request)
 		user.IsAdmin = *req.IsAdmin
 	}
 
-	s.config.Users[req.Name] = user
+	s.config().Users[req.Name] = user
 
 	// 保存配置
-	if err := s.saveConfig(); err != nil {
+	err := s.saveConfig()
+	s.mu.Unlock()
+	if err != nil {
 		s.respondError(w, "保存配置失败: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// 重置密码后注销该用户已登录的会话（管理员修改自己的密码时保留当前会话）
+	if hash != "" {
+		keep := ""
+		if current := userFromContext(r.Context()); current != nil && current.Name == req.Name {
+			keep = s.currentSessionID(r)
+		}
+		s.revokeUserSessions(req.Name, keep)
+	}
+
 	s.respondJSON(w, map[string]string{
 		"message": "用户更新成功",
 		"name":    req.Name,
@@ -1470,12 +2077,19 @@ func (s *DeployServer) handleDeleteUser(w http.ResponseWriter, r *http.Request)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.config.Users[req.Name]; !exists {
+	if _, exists := s.config().Users[req.Name]; !exists {
 		s.respondError(w, "用户不存在", http.StatusNotFound)
 		return
 	}
 
-	delete(s.config.Users, req.Name)
+	delete(s.config().Users, req.Name)
+
+	// 同时吊销该用户的部署令牌
+	for id, token := range s.config().DeployTokens {
+		if token.Owner == req.Name {
+			delete(s.config().DeployTokens, id)
+		}
+	}
 
 	// 保存配置
 	if err := s.saveConfig(); err != nil {
@@ -1516,7 +2130,7 @@ func (s *DeployServer) handleAuthorizeSite(w http.ResponseWriter, r *http.Reques
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	site, exists := s.config.Sites[req.SiteName]
+	site, exists := s.config().Sites[req.SiteName]
 	if !exists {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
@@ -1537,7 +2151,7 @@ func (s *DeployServer) handleAuthorizeSite(w http.ResponseWriter, r *http.Reques
 	// 授权用户
 	for _, username := range usersToAuthorize {
 		// 检查用户是否存在
-		if _, exists := s.config.Users[username]; !exists {
+		if _, exists := s.config().Users[username]; !exists {
 			continue
 		}
 
@@ -1555,7 +2169,7 @@ func (s *DeployServer) handleAuthorizeSite(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	s.config.Sites[req.SiteName] = site
+	s.config().Sites[req.SiteName] = site
 
 	// 保存配置
 	if err := s.saveConfig(); err != nil {
@@ -1595,7 +2209,7 @@ func (s *DeployServer) handleUnauthorizeSite(w http.ResponseWriter, r *http.Requ
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	site, exists := s.config.Sites[req.SiteName]
+	site, exists := s.config().Sites[req.SiteName]
 	if !exists {
 		s.respondError(w, "网站不存在", http.StatusNotFound)
 		return
@@ -1616,7 +2230,7 @@ func (s *DeployServer) handleUnauthorizeSite(w http.ResponseWriter, r *http.Requ
 	}
 	site.Users = newUsers
 
-	s.config.Sites[req.SiteName] = site
+	s.config().Sites[req.SiteName] = site
 
 	// 保存配置
 	if err := s.saveConfig(); err != nil {
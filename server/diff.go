@@ -0,0 +1,355 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	diffContextLines = 3         // 差异上下文行数
+	maxDiffFileSize  = 1 << 20   // 超过该大小的文件只比较状态，不生成文本差异
+	maxDiffCells     = 4_000_000 // 行差异计算表的最大规模，超出时整段视为替换
+)
+
+// textDiffExtensions 生成文本差异的文件类型
+var textDiffExtensions = map[string]bool{
+	".html": true,
+	".htm":  true,
+	".css":  true,
+	".js":   true,
+	".mjs":  true,
+	".json": true,
+	".svg":  true,
+	".txt":  true,
+	".md":   true,
+}
+
+// FileDiff 单个文件的差异
+type FileDiff struct {
+	Path     string `json:"path"`
+	Status   string `json:"status"`              // added、modified、deleted
+	Diff     string `json:"diff,omitempty"`      // 统一格式的文本差异（仅文本文件）
+	TooLarge bool   `json:"too_large,omitempty"` // 文件过大，未生成文本差异
+}
+
+// VersionDiff 两个版本之间的差异
+type VersionDiff struct {
+	Name     string     `json:"name"`
+	From     string     `json:"from"`
+	To       string     `json:"to"`
+	Added    int        `json:"added"`
+	Modified int        `json:"modified"`
+	Deleted  int        `json:"deleted"`
+	Files    []FileDiff `json:"files"`
+}
+
+// handleDiff 比较两个版本
+func (s *DeployServer) handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	name := query.Get("name")
+	from := query.Get("from")
+	to := query.Get("to")
+	if name == "" || from == "" {
+		s.respondError(w, "网站名称和起始版本不能为空", http.StatusBadRequest)
+		return
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+
+	if err := s.checkSiteAccess(r, name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, name)
+	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
+		s.respondError(w, "网站不存在", http.StatusNotFound)
+		return
+	}
+
+	if !s.config().EnableVersioning {
+		s.respondError(w, "版本控制未启用", http.StatusBadRequest)
+		return
+	}
+
+	fromHash, err := s.versions.Resolve(name, from)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	toHash, err := s.versions.Resolve(name, to)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	diff, err := diffVersions(s.versions, name, fromHash, toHash)
+	if err != nil {
+		s.respondError(w, fmt.Sprintf("比较版本失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	diff.Name = name
+
+	s.respondJSON(w, diff)
+}
+
+// diffVersions 比较两个版本的文件列表，并为文本文件生成差异
+func diffVersions(store VersionStore, site, fromHash, toHash string) (*VersionDiff, error) {
+	fromFiles, err := store.Files(site, fromHash)
+	if err != nil {
+		return nil, err
+	}
+	toFiles, err := store.Files(site, toHash)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VersionDiff{From: fromHash, To: toHash, Files: []FileDiff{}}
+
+	for _, file := range sortedPaths(fromFiles, toFiles) {
+		oldFile, inFrom := fromFiles[file]
+		newFile, inTo := toFiles[file]
+
+		entry := FileDiff{Path: file}
+		switch {
+		case !inFrom:
+			entry.Status = "added"
+			result.Added++
+		case !inTo:
+			entry.Status = "deleted"
+			result.Deleted++
+		case oldFile.Object != newFile.Object:
+			entry.Status = "modified"
+			result.Modified++
+		default:
+			continue
+		}
+
+		if textDiffExtensions[strings.ToLower(filepath.Ext(file))] {
+			if err := fillTextDiff(store, site, &entry, oldFile, newFile, inFrom, inTo); err != nil {
+				return nil, err
+			}
+		}
+		result.Files = append(result.Files, entry)
+	}
+
+	return result, nil
+}
+
+// fillTextDiff 读取文件的新旧内容并生成统一格式差异（inFrom/inTo 表示该侧是否存在）
+func fillTextDiff(store VersionStore, site string, entry *FileDiff, oldFile, newFile VersionFile, inFrom, inTo bool) error {
+	var contents [2][]byte
+	for i, side := range []struct {
+		file   VersionFile
+		exists bool
+	}{{oldFile, inFrom}, {newFile, inTo}} {
+		if !side.exists {
+			continue
+		}
+		if side.file.Size > maxDiffFileSize {
+			entry.TooLarge = true
+			return nil
+		}
+		data, err := readVersionObject(store, site, side.file)
+		if err != nil {
+			return fmt.Errorf("读取文件 %s 失败: %v", entry.Path, err)
+		}
+		contents[i] = data
+	}
+
+	oldName, newName := "a/"+entry.Path, "b/"+entry.Path
+	if !inFrom {
+		oldName = "/dev/null"
+	}
+	if !inTo {
+		newName = "/dev/null"
+	}
+	entry.Diff = unifiedDiff(oldName, newName, contents[0], contents[1])
+	return nil
+}
+
+// readVersionObject 读取版本中文件的完整内容
+func readVersionObject(store VersionStore, site string, file VersionFile) ([]byte, error) {
+	reader, err := store.Open(site, file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// diffOp 行差异操作：' ' 相同，'-' 删除，'+' 新增
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// splitLines 按行拆分文本，保留末尾不完整的一行
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	return strings.Split(text, "\n")
+}
+
+// diffLines 基于最长公共子序列计算行差异
+func diffLines(a, b []string) []diffOp {
+	// 去掉公共前缀和后缀，缩小计算规模
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(midA), len(midB)
+
+	if n*m > maxDiffCells {
+		// 规模过大时整段视为替换
+		for _, line := range midA {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		// lcs[i][j] 为 midA[i:] 与 midB[j:] 的最长公共子序列长度
+		width := m + 1
+		lcs := make([]int32, (n+1)*width)
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+				} else if lcs[(i+1)*width+j] >= lcs[i*width+j+1] {
+					lcs[i*width+j] = lcs[(i+1)*width+j]
+				} else {
+					lcs[i*width+j] = lcs[i*width+j+1]
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < n && j < m {
+			switch {
+			case midA[i] == midB[j]:
+				ops = append(ops, diffOp{' ', midA[i]})
+				i++
+				j++
+			case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+				ops = append(ops, diffOp{'-', midA[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', midB[j]})
+				j++
+			}
+		}
+		for ; i < n; i++ {
+			ops = append(ops, diffOp{'-', midA[i]})
+		}
+		for ; j < m; j++ {
+			ops = append(ops, diffOp{'+', midB[j]})
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// unifiedDiff 生成统一格式（unified diff）的文本差异，内容相同时返回空字符串
+func unifiedDiff(oldName, newName string, oldData, newData []byte) string {
+	ops := diffLines(splitLines(oldData), splitLines(newData))
+
+	// 记录每个操作之前的新旧行号
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	for k, op := range ops {
+		oldLine[k+1], newLine[k+1] = oldLine[k], newLine[k]
+		if op.kind != '+' {
+			oldLine[k+1]++
+		}
+		if op.kind != '-' {
+			newLine[k+1]++
+		}
+	}
+
+	var buf bytes.Buffer
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+
+		// 向后合并间隔不超过两倍上下文的变更
+		start := k - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContextLines {
+				break
+			}
+			end = next
+		}
+		stop := end + diffContextLines
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[stop]-oldLine[start]),
+			hunkRange(newLine[start], newLine[stop]-newLine[start]))
+		for _, op := range ops[start:stop] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.text)
+			buf.WriteByte('\n')
+		}
+		k = stop
+	}
+	return buf.String()
+}
+
+// hunkRange 格式化差异块的行范围（起始行从1开始，空范围使用前一行）
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffRequiresSiteAccess(t *testing.T) {
+	s := newTestServer(t, Config{
+		EnableVersioning: true,
+		Users: map[string]User{
+			"admin": {Name: "admin", Password: "admin-secret", IsAdmin: true},
+			"alice": {Name: "alice", Password: "alice-secret"},
+			"bob":   {Name: "bob", Password: "bob-secret"},
+		},
+		Sites: map[string]Site{"demo": {Name: "demo", Owner: "alice"}},
+	})
+	writeTestFiles(t, filepath.Join(s.config().WebRoot, "demo"), map[string]string{"index.html": "v1"})
+	if err := s.commitChanges("demo", "v1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, password string
+		want           int
+	}{
+		{"alice", "alice-secret", http.StatusOK},
+		{"bob", "bob-secret", http.StatusForbidden},
+		{"admin", "admin-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		tokens := loginTestUser(t, s, tt.user, tt.password)
+		w := serveTestRequest(t, s.authMiddleware(s.handleDiff), http.MethodGet, "/api/sites/diff?name=demo&from=HEAD", tokens.AccessToken, nil)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d (%s)", tt.user, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// domainIndex 自定义域名索引（主机名 -> 网站名），与静态文件处理器共享
+type domainIndex struct {
+	mu    sync.RWMutex
+	hosts map[string]string
+}
+
+// newDomainIndex 创建自定义域名索引
+func newDomainIndex() *domainIndex {
+	return &domainIndex{hosts: make(map[string]string)}
+}
+
+// lookup 根据请求的 Host 查找网站，Host 可以带端口
+func (d *domainIndex) lookup(host string) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	siteName, exists := d.hosts[host]
+	return siteName, exists
+}
+
+// rebuild 根据网站配置重建索引
+func (d *domainIndex) rebuild(sites map[string]Site) {
+	hosts := make(map[string]string)
+	for name, site := range sites {
+		for _, domain := range site.Domains {
+			hosts[domain] = name
+		}
+	}
+
+	d.mu.Lock()
+	d.hosts = hosts
+	d.mu.Unlock()
+}
+
+// normalizeDomain 校验并规范化自定义域名（小写、去掉末尾的点，不允许端口、路径和通配符）
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" {
+		return "", fmt.Errorf("域名不能为空")
+	}
+	if len(domain) > 253 {
+		return "", fmt.Errorf("域名过长: %s", domain)
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("无效的域名: %s", domain)
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("无效的域名: %s", domain)
+		}
+		for _, c := range label {
+			if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-') {
+				return "", fmt.Errorf("无效的域名: %s", domain)
+			}
+		}
+	}
+	return domain, nil
+}
+
+// normalizeDomains 规范化域名列表并去重
+func normalizeDomains(domains []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		normalized, err := normalizeDomain(domain)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			result = append(result, normalized)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// checkDomainConflicts 检查自定义域名是否与其他网站或内置访问域名冲突（调用方需持有 s.mu）
+func (s *DeployServer) checkDomainConflicts(siteName string, domains []string) error {
+	return checkConfigDomainConflicts(s.config(), siteName, domains)
+}
+
+// checkConfigDomainConflicts 按指定配置检查网站的自定义域名冲突
+func checkConfigDomainConflicts(cfg *Config, siteName string, domains []string) error {
+	baseDomain := strings.ToLower(cfg.BaseDomain)
+	singleDomain := strings.ToLower(cfg.SingleDomain)
+
+	for _, domain := range domains {
+		// 子域名和混合模式下 <name>.<base_domain> 已经按网站名解析
+		if (cfg.Mode == "subdomain" || cfg.Mode == "hybrid") && baseDomain != "" &&
+			(domain == baseDomain || strings.HasSuffix(domain, "."+baseDomain)) {
+			return fmt.Errorf("域名 %s 与基础域名 %s 冲突", domain, baseDomain)
+		}
+		// 路径和混合模式下的共享域名用于按路径访问所有网站
+		if cfg.Mode != "subdomain" && (domain == singleDomain || domain == baseDomain) {
+			return fmt.Errorf("域名 %s 与共享访问域名冲突", domain)
+		}
+
+		for name, site := range cfg.Sites {
+			if name == siteName {
+				continue
+			}
+			for _, used := range site.Domains {
+				if used == domain {
+					return fmt.Errorf("域名 %s 已被网站 '%s' 使用", domain, name)
+				}
+			}
+		}
+	}
+	return nil
+}
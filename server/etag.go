@@ -0,0 +1,160 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// etagCache 缓存文件内容哈希生成的强 ETag，按路径、大小和修改时间判断是否过期
+// 内容相同的文件即使重新解压（修改时间变化）也得到相同的 ETag
+type etagCache struct {
+	mu      sync.RWMutex
+	entries map[string]etagEntry
+}
+
+// etagEntry ETag 缓存条目
+type etagEntry struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// newETagCache 创建 ETag 缓存
+func newETagCache() *etagCache {
+	return &etagCache{entries: make(map[string]etagEntry)}
+}
+
+// get 返回文件的 ETag，缓存未命中时读取 file 计算内容哈希（读取后 file 的偏移量回到开头）
+func (c *etagCache) get(path string, info os.FileInfo, file io.ReadSeeker) (string, error) {
+	c.mu.RLock()
+	entry, exists := c.entries[path]
+	c.mu.RUnlock()
+	if exists && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.etag, nil
+	}
+
+	etag, err := contentETag(file)
+	if _, seekErr := file.Seek(0, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[path] = etagEntry{size: info.Size(), modTime: info.ModTime(), etag: etag}
+	c.mu.Unlock()
+	return etag, nil
+}
+
+// warm 部署后预先计算目录中所有文件的 ETag，并清除目录下已不存在的文件的缓存
+func (c *etagCache) warm(dir string) {
+	seen := make(map[string]bool)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		seen[path] = true
+		file, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+		if _, err := c.get(path, info, file); err != nil {
+			fmt.Printf("计算 %s 的 ETag 失败: %v\n", path, err)
+		}
+		return nil
+	})
+
+	prefix := dir + string(filepath.Separator)
+	c.mu.Lock()
+	for path := range c.entries {
+		if strings.HasPrefix(path, prefix) && !seen[path] {
+			delete(c.entries, path)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// forget 清除目录下所有文件的缓存（删除网站时使用）
+func (c *etagCache) forget(dir string) {
+	prefix := dir + string(filepath.Separator)
+	c.mu.Lock()
+	for path := range c.entries {
+		if strings.HasPrefix(path, prefix) {
+			delete(c.entries, path)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// contentETag 根据内容的 SHA-256 生成强 ETag
+func contentETag(content io.Reader) (string, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, content); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(hasher.Sum(nil)[:16]) + `"`, nil
+}
+
+// encodedETag 为压缩后的内容生成 ETag："abc" -> "abc-gzip"
+func encodedETag(etag, encoding string) string {
+	if encoding == "" {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// etagMatches 判断 If-None-Match 中的 ETag 列表是否包含指定 ETag（弱比较，* 匹配任意 ETag）
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified 按条件请求头判断是否可以返回 304：
+// If-None-Match 存在时只使用 ETag 判断，否则按 If-Modified-Since 比较修改时间（精确到秒）
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, etag)
+	}
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !modTime.IsZero() {
+		since, err := http.ParseTime(header)
+		return err == nil && !modTime.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// writeNotModified 返回 304，删除与实体内容相关的响应头
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
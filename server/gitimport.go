@@ -0,0 +1,503 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitRepo 只读的 git 仓库（纯 Go 实现，仅用于迁移旧版本历史，支持松散对象和 pack 文件）
+type gitRepo struct {
+	dir   string
+	packs []*gitPack
+}
+
+// gitPack pack 文件及其索引
+type gitPack struct {
+	path    string
+	hashes  [][20]byte // 按哈希排序
+	offsets []uint64   // 与 hashes 一一对应
+}
+
+// gitCommit 解析后的提交
+type gitCommit struct {
+	Tree    string
+	Parent  string // 第一个父提交
+	Author  string
+	Date    time.Time
+	Message string
+}
+
+// openGitRepo 打开 .git 目录
+func openGitRepo(dir string) (*gitRepo, error) {
+	repo := &gitRepo{dir: dir}
+	idxFiles, _ := filepath.Glob(filepath.Join(dir, "objects", "pack", "*.idx"))
+	for _, idxFile := range idxFiles {
+		pack, err := readGitPackIndex(idxFile)
+		if err != nil {
+			return nil, err
+		}
+		repo.packs = append(repo.packs, pack)
+	}
+	return repo, nil
+}
+
+// head 解析 HEAD 指向的提交，没有提交时返回空字符串
+func (g *gitRepo) head() (string, error) {
+	data, err := os.ReadFile(filepath.Join(g.dir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	ref := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(ref, "ref: ") {
+		return ref, nil
+	}
+	ref = strings.TrimPrefix(ref, "ref: ")
+
+	if data, err := os.ReadFile(filepath.Join(g.dir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	// 引用可能已被打包
+	packed, err := os.ReadFile(filepath.Join(g.dir, "packed-refs"))
+	if err != nil {
+		return "", nil
+	}
+	for _, line := range strings.Split(string(packed), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == ref {
+			return fields[0], nil
+		}
+	}
+	return "", nil
+}
+
+// readObject 读取对象，返回类型和内容
+func (g *gitRepo) readObject(hash string) (string, []byte, error) {
+	// 松散对象
+	loose := filepath.Join(g.dir, "objects", hash[:2], hash[2:])
+	if file, err := os.Open(loose); err == nil {
+		defer file.Close()
+		zr, err := zlib.NewReader(file)
+		if err != nil {
+			return "", nil, fmt.Errorf("读取对象 %s 失败: %v", hash, err)
+		}
+		defer zr.Close()
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			return "", nil, fmt.Errorf("读取对象 %s 失败: %v", hash, err)
+		}
+		header, body, found := bytes.Cut(data, []byte{0})
+		if !found {
+			return "", nil, fmt.Errorf("对象 %s 格式错误", hash)
+		}
+		objType, _, _ := strings.Cut(string(header), " ")
+		return objType, body, nil
+	}
+
+	// pack 文件中的对象
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 20 {
+		return "", nil, fmt.Errorf("无效的对象哈希: %s", hash)
+	}
+	var key [20]byte
+	copy(key[:], raw)
+	for _, pack := range g.packs {
+		if offset, found := pack.find(key); found {
+			return g.readPackObject(pack, offset)
+		}
+	}
+	return "", nil, fmt.Errorf("对象不存在: %s", hash)
+}
+
+// readCommit 读取并解析提交
+func (g *gitRepo) readCommit(hash string) (*gitCommit, error) {
+	objType, data, err := g.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != "commit" {
+		return nil, fmt.Errorf("对象 %s 不是提交", hash)
+	}
+
+	header, message, _ := strings.Cut(string(data), "\n\n")
+	commit := &gitCommit{Message: strings.TrimSpace(message)}
+	for _, line := range strings.Split(header, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			if commit.Parent == "" {
+				commit.Parent = value
+			}
+		case "author":
+			// 格式: Name <email> 1700000000 +0800
+			fields := strings.Fields(value)
+			if len(fields) < 3 {
+				continue
+			}
+			if unix, err := strconv.ParseInt(fields[len(fields)-2], 10, 64); err == nil {
+				commit.Date = time.Unix(unix, 0)
+			}
+			name, _, _ := strings.Cut(value, " <")
+			commit.Author = name
+		}
+	}
+	return commit, nil
+}
+
+// walkTree 递归列出树对象中的文件（路径 -> blob 哈希），跳过符号链接和子模块
+func (g *gitRepo) walkTree(hash, prefix string, files map[string]string) error {
+	objType, data, err := g.readObject(hash)
+	if err != nil {
+		return err
+	}
+	if objType != "tree" {
+		return fmt.Errorf("对象 %s 不是目录树", hash)
+	}
+
+	for len(data) > 0 {
+		// 格式: <mode> <name>\0<20字节哈希>
+		header, rest, found := bytes.Cut(data, []byte{0})
+		if !found || len(rest) < 20 {
+			return fmt.Errorf("目录树 %s 格式错误", hash)
+		}
+		mode, name, _ := strings.Cut(string(header), " ")
+		child := hex.EncodeToString(rest[:20])
+		data = rest[20:]
+
+		switch mode {
+		case "40000":
+			if err := g.walkTree(child, path.Join(prefix, name), files); err != nil {
+				return err
+			}
+		case "100644", "100755", "100664":
+			files[path.Join(prefix, name)] = child
+		}
+	}
+	return nil
+}
+
+// readGitPackIndex 读取 pack 索引（版本2）
+func readGitPackIndex(idxFile string) (*gitPack, error) {
+	data, err := os.ReadFile(idxFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, fmt.Errorf("不支持的 pack 索引格式: %s", idxFile)
+	}
+
+	count := int(binary.BigEndian.Uint32(data[8+255*4:]))
+	hashStart := 8 + 256*4
+	crcStart := hashStart + count*20
+	offsetStart := crcStart + count*4
+	largeStart := offsetStart + count*4
+	if len(data) < largeStart {
+		return nil, fmt.Errorf("pack 索引已损坏: %s", idxFile)
+	}
+
+	pack := &gitPack{
+		path:    strings.TrimSuffix(idxFile, ".idx") + ".pack",
+		hashes:  make([][20]byte, count),
+		offsets: make([]uint64, count),
+	}
+	for i := 0; i < count; i++ {
+		copy(pack.hashes[i][:], data[hashStart+i*20:])
+		offset := uint64(binary.BigEndian.Uint32(data[offsetStart+i*4:]))
+		if offset&0x80000000 != 0 {
+			// 大于 2GB 的偏移量保存在 8 字节偏移表中
+			pos := largeStart + int(offset&0x7fffffff)*8
+			if len(data) < pos+8 {
+				return nil, fmt.Errorf("pack 索引已损坏: %s", idxFile)
+			}
+			offset = binary.BigEndian.Uint64(data[pos:])
+		}
+		pack.offsets[i] = offset
+	}
+	return pack, nil
+}
+
+// find 查找对象在 pack 中的偏移量
+func (p *gitPack) find(key [20]byte) (uint64, bool) {
+	i := sort.Search(len(p.hashes), func(i int) bool {
+		return bytes.Compare(p.hashes[i][:], key[:]) >= 0
+	})
+	if i < len(p.hashes) && p.hashes[i] == key {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// gitPackTypes pack 中的对象类型
+var gitPackTypes = map[byte]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+// readPackObject 读取 pack 中指定偏移量的对象，自动还原增量对象
+func (g *gitRepo) readPackObject(pack *gitPack, offset uint64) (string, []byte, error) {
+	file, err := os.Open(pack.path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(int64(offset), io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	reader := bufio.NewReader(file)
+
+	// 对象头：类型（3位）和长度（变长编码）
+	c, err := reader.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	kind := (c >> 4) & 0x7
+	for c&0x80 != 0 {
+		if c, err = reader.ReadByte(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var baseType string
+	var base []byte
+	switch kind {
+	case 6: // OFS_DELTA：基础对象位于之前的偏移量
+		c, err := reader.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		back := uint64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = reader.ReadByte(); err != nil {
+				return "", nil, err
+			}
+			back = ((back + 1) << 7) | uint64(c&0x7f)
+		}
+		if baseType, base, err = g.readPackObject(pack, offset-back); err != nil {
+			return "", nil, err
+		}
+	case 7: // REF_DELTA：按哈希引用基础对象
+		var ref [20]byte
+		if _, err := io.ReadFull(reader, ref[:]); err != nil {
+			return "", nil, err
+		}
+		if baseType, base, err = g.readObject(hex.EncodeToString(ref[:])); err != nil {
+			return "", nil, err
+		}
+	}
+
+	zr, err := zlib.NewReader(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if kind == 6 || kind == 7 {
+		result, err := applyGitDelta(base, data)
+		return baseType, result, err
+	}
+	objType, ok := gitPackTypes[kind]
+	if !ok {
+		return "", nil, fmt.Errorf("不支持的 pack 对象类型: %d", kind)
+	}
+	return objType, data, nil
+}
+
+// applyGitDelta 将增量数据应用到基础对象
+func applyGitDelta(base, delta []byte) ([]byte, error) {
+	pos := 0
+	readSize := func() uint64 {
+		var size uint64
+		var shift uint
+		for pos < len(delta) {
+			c := delta[pos]
+			pos++
+			size |= uint64(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		return size
+	}
+
+	if readSize() != uint64(len(base)) {
+		return nil, fmt.Errorf("增量对象与基础对象不匹配")
+	}
+	result := make([]byte, 0, readSize())
+
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+		if op&0x80 != 0 {
+			// 复制基础对象中的一段
+			var offset, size uint64
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 && pos < len(delta) {
+					offset |= uint64(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(1<<(4+i)) != 0 && pos < len(delta) {
+					size |= uint64(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, fmt.Errorf("增量对象已损坏")
+			}
+			result = append(result, base[offset:offset+size]...)
+		} else if op != 0 {
+			// 插入新数据
+			end := pos + int(op)
+			if end > len(delta) {
+				return nil, fmt.Errorf("增量对象已损坏")
+			}
+			result = append(result, delta[pos:end]...)
+			pos = end
+		} else {
+			return nil, fmt.Errorf("增量对象已损坏")
+		}
+	}
+	return result, nil
+}
+
+// migrateGitHistories 将网站目录中旧的 .git 版本历史迁移到版本存储
+// 迁移成功后 .git 移动到版本存储目录下的 legacy.git 备份，确认无误后可以删除
+func (s *DeployServer) migrateGitHistories() {
+	store, ok := s.versions.(*snapshotStore)
+	if !ok || !s.config().EnableVersioning {
+		return
+	}
+
+	entries, err := os.ReadDir(s.config().WebRoot)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		gitDir := filepath.Join(s.config().WebRoot, name, ".git")
+		if _, err := os.Stat(gitDir); err != nil {
+			continue
+		}
+		if store.exists(name) {
+			fmt.Printf("网站 %s 已有版本存储，跳过 .git 迁移\n", name)
+			continue
+		}
+
+		count, err := store.migrateGitHistory(name, gitDir)
+		if err != nil {
+			fmt.Printf("迁移网站 %s 的 git 版本历史失败: %v\n", name, err)
+			continue
+		}
+		fmt.Printf("已迁移网站 %s 的 %d 个 git 版本\n", name, count)
+	}
+}
+
+// migrateGitHistory 导入网站的 .git 历史，并将 .git 移动到版本存储目录下的 legacy.git
+func (st *snapshotStore) migrateGitHistory(site, gitDir string) (int, error) {
+	count, err := st.importGit(site, gitDir)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(gitDir, filepath.Join(st.siteDir(site), "legacy.git")); err != nil {
+		return count, fmt.Errorf("已导入 %d 个版本，但移动 .git 目录失败（请手动移走网站目录中的 .git）: %v", count, err)
+	}
+	return count, nil
+}
+
+// importGit 按提交顺序导入 git 历史（沿第一个父提交），保留原提交哈希
+// 先导入到临时目录，全部成功后再切换，失败时不留下不完整的版本存储
+func (st *snapshotStore) importGit(site, gitDir string) (int, error) {
+	repo, err := openGitRepo(gitDir)
+	if err != nil {
+		return 0, err
+	}
+	head, err := repo.head()
+	if err != nil {
+		return 0, err
+	}
+
+	var commits []string
+	for hash := head; hash != ""; {
+		commit, err := repo.readCommit(hash)
+		if err != nil {
+			return 0, err
+		}
+		commits = append(commits, hash)
+		hash = commit.Parent
+	}
+
+	tmpSite := "." + site + ".importing"
+	defer os.RemoveAll(st.siteDir(tmpSite))
+	if err := st.Init(tmpSite); err != nil {
+		return 0, err
+	}
+
+	// git 对象 -> 版本对象，相同内容只导入一次
+	imported := make(map[string]VersionFile)
+	for i := len(commits) - 1; i >= 0; i-- {
+		commit, err := repo.readCommit(commits[i])
+		if err != nil {
+			return 0, err
+		}
+		blobs := make(map[string]string)
+		if err := repo.walkTree(commit.Tree, "", blobs); err != nil {
+			return 0, err
+		}
+
+		snap := &snapshot{
+			Message: commit.Message,
+			Author:  commit.Author,
+			Date:    commit.Date,
+			Files:   make(map[string]VersionFile, len(blobs)),
+		}
+		for relPath, blob := range blobs {
+			file, exists := imported[blob]
+			if !exists {
+				_, data, err := repo.readObject(blob)
+				if err != nil {
+					return 0, err
+				}
+				object, size, err := st.putObject(bytes.NewReader(data))
+				if err != nil {
+					return 0, err
+				}
+				file = VersionFile{Object: object, Size: size}
+				imported[blob] = file
+			}
+			snap.Files[relPath] = file
+		}
+
+		if _, err := st.addSnapshot(tmpSite, snap, commits[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := os.Rename(st.siteDir(tmpSite), st.siteDir(site)); err != nil {
+		return 0, fmt.Errorf("保存版本存储失败: %v", err)
+	}
+	return len(commits), nil
+}
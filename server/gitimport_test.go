@@ -0,0 +1,228 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitFixture 用 git 命令生成的旧版本历史，commits 按提交顺序记录每个版本的哈希和文件内容
+type gitFixture struct {
+	dir     string
+	commits []gitFixtureCommit
+}
+
+// gitFixtureCommit 测试仓库中的一个提交
+type gitFixtureCommit struct {
+	hash    string
+	message string
+	files   map[string]string
+}
+
+// runGit 在目录中执行 git 命令并返回输出
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=deployer",
+		"GIT_AUTHOR_EMAIL=deployer@example.com",
+		"GIT_COMMITTER_NAME=deployer",
+		"GIT_COMMITTER_EMAIL=deployer@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newGitFixture 在网站目录中创建带多个提交的 git 仓库，大文件每次只修改一行，gc 后会生成增量对象
+func newGitFixture(t *testing.T, siteDir string) *gitFixture {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git 不可用")
+	}
+	if err := os.MkdirAll(siteDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, siteDir, "init", "-q", "-b", "master")
+
+	fixture := &gitFixture{dir: siteDir}
+	files := map[string]string{}
+	for i := 1; i <= 4; i++ {
+		var lines []string
+		for line := 0; line < 300; line++ {
+			if line == i*10 {
+				lines = append(lines, fmt.Sprintf("<p>version %d</p>", i))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("<p>line %d of the page</p>", line))
+		}
+		files["index.html"] = strings.Join(lines, "\n")
+		files["assets/app.js"] = fmt.Sprintf("console.log(%d)\n", i)
+		switch i {
+		case 2:
+			files["about.html"] = "<h1>about</h1>"
+		case 3:
+			delete(files, "about.html")
+			os.Remove(filepath.Join(siteDir, "about.html"))
+		}
+		writeTestFiles(t, siteDir, files)
+
+		message := fmt.Sprintf("deploy %d", i)
+		runGit(t, siteDir, "add", "-A")
+		runGit(t, siteDir, "commit", "-q", "-m", message, "--date", fmt.Sprintf("2024-01-0%dT10:00:00Z", i))
+
+		snapshot := make(map[string]string, len(files))
+		for relPath, content := range files {
+			snapshot[relPath] = content
+		}
+		fixture.commits = append(fixture.commits, gitFixtureCommit{
+			hash:    runGit(t, siteDir, "rev-parse", "HEAD"),
+			message: message,
+			files:   snapshot,
+		})
+	}
+	return fixture
+}
+
+// verifyImport 检查导入的每个版本的哈希、说明、作者和文件内容
+func (f *gitFixture) verifyImport(t *testing.T, store *snapshotStore, site string) {
+	t.Helper()
+	versions, total, err := store.List(site, versionQuery{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != len(f.commits) {
+		t.Fatalf("imported %d versions, want %d", total, len(f.commits))
+	}
+	for i, commit := range f.commits {
+		version := versions[len(versions)-1-i]
+		if version.Hash != commit.hash || version.Message != commit.message || version.Author != "deployer" {
+			t.Errorf("version %d = %s %q by %q, want %s %q by deployer", i, version.Hash, version.Message, version.Author, commit.hash, commit.message)
+		}
+
+		files, err := store.Files(site, commit.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != len(commit.files) {
+			t.Errorf("version %d has %d files, want %d", i, len(files), len(commit.files))
+		}
+		for relPath, want := range commit.files {
+			file, exists := files[relPath]
+			if !exists {
+				t.Errorf("version %d is missing %s", i, relPath)
+				continue
+			}
+			reader, err := store.Open(site, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("version %d %s content differs from git", i, relPath)
+			}
+		}
+	}
+}
+
+// hasPackDeltas 判断仓库的 pack 中是否包含增量对象
+func hasPackDeltas(t *testing.T, gitDir string) bool {
+	t.Helper()
+	packs, _ := filepath.Glob(filepath.Join(gitDir, "objects", "pack", "*.idx"))
+	for _, pack := range packs {
+		if strings.Contains(runGit(t, gitDir, "verify-pack", "-v", pack), "chain length") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMigrateGitHistory(t *testing.T) {
+	tests := []struct {
+		name   string
+		repack func(t *testing.T, siteDir string)
+	}{
+		{"loose objects", func(t *testing.T, siteDir string) {}},
+		{"packed objects with offset deltas and packed refs", func(t *testing.T, siteDir string) {
+			runGit(t, siteDir, "gc", "-q", "--aggressive", "--prune=now")
+		}},
+		{"packed objects with ref deltas", func(t *testing.T, siteDir string) {
+			runGit(t, siteDir, "-c", "repack.useDeltaBaseOffset=false", "repack", "-q", "-a", "-d", "-f")
+			runGit(t, siteDir, "pack-refs", "--all")
+			runGit(t, siteDir, "prune", "--expire=now")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webRoot := t.TempDir()
+			siteDir := filepath.Join(webRoot, "demo")
+			fixture := newGitFixture(t, siteDir)
+			tt.repack(t, siteDir)
+
+			gitDir := filepath.Join(siteDir, ".git")
+			if tt.name != "loose objects" {
+				if _, err := os.Stat(filepath.Join(gitDir, "refs", "heads", "master")); !os.IsNotExist(err) {
+					t.Fatal("fixture should only have packed refs")
+				}
+				if !hasPackDeltas(t, gitDir) {
+					t.Fatal("fixture pack has no delta objects")
+				}
+			}
+
+			store := newSnapshotStore(webRoot)
+			count, err := store.migrateGitHistory("demo", gitDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(fixture.commits) {
+				t.Errorf("migrateGitHistory = %d versions, want %d", count, len(fixture.commits))
+			}
+			fixture.verifyImport(t, store, "demo")
+
+			if _, err := os.Stat(gitDir); !os.IsNotExist(err) {
+				t.Error(".git was left in the site directory")
+			}
+			if _, err := os.Stat(filepath.Join(store.siteDir("demo"), "legacy.git", "HEAD")); err != nil {
+				t.Errorf(".git was not moved to legacy.git: %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrateGitHistoryFailureKeepsGitDir(t *testing.T) {
+	webRoot := t.TempDir()
+	siteDir := filepath.Join(webRoot, "demo")
+	fixture := newGitFixture(t, siteDir)
+	gitDir := filepath.Join(siteDir, ".git")
+
+	// 删除第一个提交的目录树对象，导入中途失败
+	tree := runGit(t, siteDir, "rev-parse", fixture.commits[0].hash+"^{tree}")
+	if err := os.Remove(filepath.Join(gitDir, "objects", tree[:2], tree[2:])); err != nil {
+		t.Fatal(err)
+	}
+
+	store := newSnapshotStore(webRoot)
+	if _, err := store.migrateGitHistory("demo", gitDir); err == nil {
+		t.Fatal("migrateGitHistory succeeded with a missing object")
+	}
+	if store.exists("demo") {
+		t.Error("a partial version store was left behind")
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); err != nil {
+		t.Errorf(".git was not kept after the failed import: %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// headersFileName 部署包中的响应头规则文件
+const headersFileName = "_headers"
+
+// protectedHeaders 不允许通过规则修改的响应头（由服务器根据内容生成）
+var protectedHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Content-Encoding":  true,
+	"Content-Range":     true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Etag":              true,
+	"Last-Modified":     true,
+	"Vary":              true,
+}
+
+// HeaderRule 响应头规则，路径匹配时设置对应的响应头
+// 以 / 开头的模式匹配文件在网站中的完整路径（* 可跨目录），否则只匹配文件名，如 *.js
+type HeaderRule struct {
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+}
+
+// matches 判断规则是否匹配文件路径（relPath 以 / 开头）
+func (rule *HeaderRule) matches(relPath string) bool {
+	if strings.HasPrefix(rule.Path, "/") {
+		return globMatch(rule.Path, relPath)
+	}
+	return globMatch(rule.Path, path.Base(relPath))
+}
+
+// globMatch 通配符匹配，* 匹配任意字符序列（包括 /），? 匹配单个字符
+func globMatch(pattern, name string) bool {
+	p, n := 0, 0
+	star, mark := -1, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]):
+			p++
+			n++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, n
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			n = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// validateHeaderRules 校验响应头规则，并规范化响应头名称
+func validateHeaderRules(rules []HeaderRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		rule.Path = strings.TrimSpace(rule.Path)
+		if rule.Path == "" {
+			return fmt.Errorf("第 %d 条规则的路径不能为空", i+1)
+		}
+		if len(rule.Headers) == 0 {
+			return fmt.Errorf("规则 %s 没有设置响应头", rule.Path)
+		}
+		headers := make(map[string]string, len(rule.Headers))
+		for name, value := range rule.Headers {
+			canonical, err := checkHeader(name, value)
+			if err != nil {
+				return fmt.Errorf("规则 %s: %v", rule.Path, err)
+			}
+			if _, exists := headers[canonical]; exists {
+				return fmt.Errorf("规则 %s: 响应头 %s 重复", rule.Path, canonical)
+			}
+			headers[canonical] = strings.TrimSpace(value)
+		}
+		rule.Headers = headers
+	}
+	return nil
+}
+
+// checkHeader 校验响应头名称和值，返回规范化的名称
+func checkHeader(name, value string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("响应头名称不能为空")
+	}
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return "", fmt.Errorf("无效的响应头名称: %s", name)
+		}
+	}
+	canonical := http.CanonicalHeaderKey(name)
+	if protectedHeaders[canonical] {
+		return "", fmt.Errorf("不允许设置响应头 %s", canonical)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("响应头 %s 的值不能包含换行", canonical)
+	}
+	return canonical, nil
+}
+
+// parseHeadersFile 解析 _headers 文件：
+//
+//	/assets/*
+//	  Cache-Control: public, max-age=31536000, immutable
+//	*.html
+//	  X-Frame-Options: DENY
+//
+// 不缩进的行是路径模式，缩进的 "名称: 值" 行属于上面的模式，# 开头的行是注释；
+// 同一模式下重复的响应头以逗号合并
+func parseHeadersFile(data []byte) ([]HeaderRule, error) {
+	var rules []HeaderRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			rules = append(rules, HeaderRule{Path: trimmed, Headers: make(map[string]string)})
+			continue
+		}
+
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("第 %d 行: 响应头之前缺少路径", lineNo)
+		}
+		name, value, found := strings.Cut(trimmed, ":")
+		if !found {
+			return nil, fmt.Errorf("第 %d 行: 应为 \"名称: 值\" 格式", lineNo)
+		}
+		canonical, err := checkHeader(name, value)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %v", lineNo, err)
+		}
+		headers := rules[len(rules)-1].Headers
+		value = strings.TrimSpace(value)
+		if existing, exists := headers[canonical]; exists {
+			value = existing + ", " + value
+		}
+		headers[canonical] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if len(rule.Headers) == 0 {
+			return nil, fmt.Errorf("路径 %s 没有设置响应头", rule.Path)
+		}
+	}
+	return rules, nil
+}
+
+// applyHeaderRules 按顺序应用匹配的规则，后面的规则覆盖前面设置的同名响应头
+// 受访问策略保护的网站（private）中 public 缓存会改为 private；keepCacheControl 时忽略规则中的 Cache-Control
+func applyHeaderRules(w http.ResponseWriter, rules []HeaderRule, relPath string, private, keepCacheControl bool) {
+	for i := range rules {
+		if !rules[i].matches(relPath) {
+			continue
+		}
+		for name, value := range rules[i].Headers {
+			if name == "Cache-Control" {
+				if keepCacheControl {
+					continue
+				}
+				if private {
+					value = privateCacheControl(value)
+				}
+			}
+			w.Header().Set(name, value)
+		}
+	}
+}
+
+// privateCacheControl 将缓存策略限制为浏览器私有缓存
+func privateCacheControl(value string) string {
+	var directives []string
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" || strings.EqualFold(directive, "public") || strings.EqualFold(directive, "private") ||
+			strings.HasPrefix(strings.ToLower(directive), "s-maxage") {
+			continue
+		}
+		directives = append(directives, directive)
+	}
+	return strings.Join(append([]string{"private"}, directives...), ", ")
+}
+
+// isFingerprinted 判断文件名是否带内容指纹，只识别构建工具生成的 name.<hash>.ext 和 name-<hash>.ext：
+// 哈希为 8~64 位小写十六进制（webpack 等，如 app.3f2a1b9c.js），或 8 位 base64url（Vite/Rollup，如 index-D4wrgTda.js）。
+// 哈希和扩展名之间可以有其他以 . 分隔的部分（如 Create React App 的 main.3f2a1b9c.chunk.js）。
+// 带指纹的文件内容变化时文件名也会变化，可以长期缓存；无法确定时按未带指纹处理，最多多一次协商缓存请求
+func isFingerprinted(filePath string) bool {
+	name := path.Base(filepath.ToSlash(filePath))
+	stem := strings.TrimSuffix(name, path.Ext(name))
+
+	for {
+		if hasHashSuffix(stem) {
+			return true
+		}
+		i := strings.LastIndex(stem, ".")
+		if i <= 0 {
+			return false
+		}
+		stem = stem[:i]
+	}
+}
+
+// hasHashSuffix 判断文件名（不含扩展名）是否以 .<hash> 或 -<hash> 结尾
+func hasHashSuffix(stem string) bool {
+	if i := strings.LastIndexAny(stem, ".-"); i > 0 && isHexHash(stem[i+1:]) {
+		return true
+	}
+	// base64url 哈希本身可能包含 -，按固定长度从末尾截取
+	const base64HashLen = 8
+	if i := len(stem) - base64HashLen - 1; i > 0 && (stem[i] == '.' || stem[i] == '-') {
+		return isBase64Hash(stem[i+1:])
+	}
+	return false
+}
+
+// isHexHash 判断是否为小写十六进制哈希，全是数字（如日期）或全是字母时不算
+func isHexHash(s string) bool {
+	if len(s) < 8 || len(s) > 64 {
+		return false
+	}
+	hasDigit, hasLetter := false, false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case c >= 'a' && c <= 'f':
+			hasLetter = true
+		default:
+			return false
+		}
+	}
+	return hasDigit && hasLetter
+}
+
+// isBase64Hash 判断是否为 base64url 哈希，要求同时包含数字、小写和大写字母，避免把普通单词当作哈希
+func isBase64Hash(s string) bool {
+	hasDigit, hasLower, hasUpper := false, false, false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case c >= 'a' && c <= 'z':
+			hasLower = true
+		case c >= 'A' && c <= 'Z':
+			hasUpper = true
+		case c == '-' || c == '_':
+		default:
+			return false
+		}
+	}
+	return hasDigit && hasLower && hasUpper
+}
@@ -0,0 +1,43 @@
+package server
+
+import "testing"
+
+func TestIsFingerprinted(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		// webpack 等生成的十六进制哈希
+		{"app.3f2a1b9c.js", true},
+		{"static/js/main.8e2f1a0b4c6d7e9f1a2b.chunk.css", true},
+		{"static/js/787.2c7e6e5d.chunk.js", true},
+		{"static/css/main.3f2a1b9c.chunk.min.css", true},
+		{"static/js/main.8e2f1a0b4c6d7e9f1a2b.js", true},
+		{"vendor-0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d.css", true},
+		// Vite/Rollup 生成的 base64url 哈希
+		{"assets/index-D4wrgTda.js", true},
+		{"assets/index-B-x9_kQz.css", true},
+		{"assets/vendor.Ck3mZp0Q.js", true},
+		// 普通文件名
+		{"20241017.html", false},
+		{"Vue3Demo.js", false},
+		{"Header2Nav.css", false},
+		{"index.html", false},
+		{"app.js", false},
+		{"report-20241017.pdf", false},
+		{"app-settings.js", false},
+		{"user-Settings.js", false},
+		{"photo-deadbeef.png", false},
+		{"3f2a1b9c.js", false},
+		{"3f2a1b9c.chunk.js", false},
+		{"report.20241017.final.pdf", false},
+		{"app.settings.chunk.js", false},
+		{"app.3F2A1B9C.js", false},
+		{"app.3f2a1b9.js", false},
+	}
+	for _, tt := range tests {
+		if got := isFingerprinted(tt.path); got != tt.want {
+			t.Errorf("isFingerprinted(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestServer 在临时目录中创建部署服务器，配置会先写入配置文件
+func newTestServer(t *testing.T, cfg Config) *DeployServer {
+	t.Helper()
+	dir := t.TempDir()
+	if cfg.WebRoot == "" {
+		cfg.WebRoot = filepath.Join(dir, "www")
+	}
+	if err := os.MkdirAll(cfg.WebRoot, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = "path"
+	}
+	if cfg.Sites == nil {
+		cfg.Sites = make(map[string]Site)
+	}
+	if cfg.Users == nil {
+		cfg.Users = map[string]User{"admin": {Name: "admin", Password: "admin-secret", IsAdmin: true}}
+	}
+
+	configPath := filepath.Join(dir, "config.json")
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewDeployServer(cfg, configPath)
+}
+
+// loadTestConfig 测试使用的配置加载函数
+func loadTestConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// writeTestFiles 按相对路径写入测试文件
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for relPath, content := range files {
+		target := filepath.Join(root, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// serveTestRequest 发送 API 请求，token 非空时作为 Bearer 令牌，body 非空时编码为 JSON
+func serveTestRequest(t *testing.T, handler http.Handler, method, target, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// loginTestUser 登录并返回签发的令牌
+func loginTestUser(t *testing.T, s *DeployServer, username, password string) TokenResponse {
+	t.Helper()
+	w := serveTestRequest(t, http.HandlerFunc(s.handleLogin), http.MethodPost, "/api/auth/login", "", map[string]string{
+		"username": username,
+		"password": password,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login %s: %d %s", username, w.Code, w.Body.String())
+	}
+	return decodeTokens(t, w)
+}
+
+// decodeTokens 解析登录或刷新接口返回的令牌
+func decodeTokens(t *testing.T, w *httptest.ResponseRecorder) TokenResponse {
+	t.Helper()
+	var tokens TokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	versionPathPrefix = "/@" // 历史版本路径前缀：/@<hash>/path
+	versionURLHashLen = 12   // 历史版本地址中使用的哈希长度
+	minVersionRefLen  = 7    // 历史版本地址中哈希的最短长度，更短的十六进制名称可以用作标签
+)
+
+// isVersionRef 判断是否为历史版本哈希（7-40 位小写十六进制）
+func isVersionRef(ref string) bool {
+	if len(ref) < minVersionRefLen || len(ref) > 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitVersionPath 拆分历史版本路径：/@hash/path -> (hash, /path)
+func splitVersionPath(requestPath string) (ref, rest string, ok bool) {
+	if !strings.HasPrefix(requestPath, versionPathPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(requestPath, versionPathPrefix), "/", 2)
+	if !isVersionRef(parts[0]) {
+		return "", "", false
+	}
+	// 缺少结尾的 / 时 rest 为空，由静态文件处理器重定向到目录地址
+	if len(parts) > 1 {
+		rest = "/" + parts[1]
+	}
+	return parts[0], rest, true
+}
+
+// versionURL 生成历史版本的只读访问地址
+// 网站可以通过子域名访问时优先使用 hash--site.base_domain，域名标签超长时改用 /@hash/ 路径
+func (s *DeployServer) versionURL(r *http.Request, site, hash string) string {
+	if len(hash) > versionURLHashLen {
+		hash = hash[:versionURLHashLen]
+	}
+
+	scheme := s.publicScheme()
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	siteConfig := s.lookupSite(site)
+	if subdomain, _ := s.siteRoutings(&siteConfig); subdomain {
+		label := hash + previewHostSeparator + site
+		if len(label) <= 63 {
+			host := s.publicHost(fmt.Sprintf("%s.%s", label, s.config().BaseDomain))
+			return fmt.Sprintf("%s://%s/", scheme, host)
+		}
+		host := s.publicHost(fmt.Sprintf("%s.%s", site, s.config().BaseDomain))
+		return fmt.Sprintf("%s://%s%s%s/", scheme, host, versionPathPrefix, hash)
+	}
+	return fmt.Sprintf("%s://%s/%s%s%s/", scheme, s.pathHost(r), site, versionPathPrefix, hash)
+}
+
+// serveVersion 直接从网站版本库中读取并服务历史版本的文件，不影响线上版本
+func (h *StaticFileHandler) serveVersion(w http.ResponseWriter, r *http.Request, siteName, ref, requestPath string) {
+	if siteName == "" || siteName != filepath.Base(siteName) || strings.HasPrefix(siteName, ".") {
+		http.Error(w, errWebsiteNotFound.message, errWebsiteNotFound.status)
+		return
+	}
+
+	// 历史版本沿用网站的访问策略
+	if h.authorize != nil && !h.authorize(w, r, siteName) {
+		return
+	}
+
+	var settings siteServeConfig
+	if h.siteSettings != nil {
+		settings = h.siteSettings(siteName)
+	}
+
+	// 版本存储独立于网站目录，读取历史版本不需要持有网站锁
+	files, err := readVersionTree(h.versions, siteName, ref)
+	if err == nil && requestPath == "" {
+		err = errDirRedirect
+	}
+
+	// 使用历史版本自己的 _redirects 和 _headers，与线上网站从目录中读取规则一致
+	base := siteBasePath(r, requestPath)
+	var redirect *RedirectRule
+	var target string
+	var rules []HeaderRule
+	if err == nil {
+		if redirects, ok := h.redirectFiles.loadVersion(h.versions, siteName, files).([]RedirectRule); ok {
+			redirect, target = findRedirect(redirects, cleanRequestPath(requestPath), func(requestPath string) bool {
+				return versionFileExists(files, requestPath)
+			})
+		}
+		rules, _ = h.headerFiles.loadVersion(h.versions, siteName, files).([]HeaderRule)
+	}
+	rewrite := redirect != nil && redirect.Status == http.StatusOK && !redirect.isProxy()
+	if redirect != nil && !rewrite {
+		if redirect.isProxy() {
+			h.proxyRequest(w, r, siteName, target)
+			return
+		}
+		http.Redirect(w, r, redirectLocation(r, base, target), redirect.Status)
+		return
+	}
+	if rewrite {
+		// 站内重写：直接服务目标路径对应的文件，不再匹配其他规则
+		requestPath, _, _ = strings.Cut(target, "?")
+	}
+
+	var filePath string
+	var file VersionFile
+	var status int
+	if err == nil {
+		filePath, file, status, err = findVersionFile(files, requestPath, settings.notFound)
+		if err == errDirRedirect && rewrite {
+			// 重写目标是目录时直接使用其中的 index.html
+			filePath, file, status, err = findVersionFile(files, requestPath+"/", settings.notFound)
+		}
+	}
+	if err == errDirRedirect {
+		redirectToDirectory(w, r)
+		return
+	}
+	if err != nil {
+		if se, ok := err.(*serveError); ok {
+			http.Error(w, se.message, se.status)
+			return
+		}
+		log.Printf("[ERROR] Failed to read version %s of site %s: %v", ref, siteName, err)
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	// 网站设置中的规则在 _headers 之后应用，优先级更高
+	rules = append(rules[:len(rules):len(rules)], settings.headers...)
+	opts := serveOptions{rules: rules, relPath: "/" + filePath}
+	if h.mode == "path" {
+		opts.basePath, opts.pathRewrite = base, settings.pathRewrite
+	}
+
+	if status == http.StatusNotFound {
+		data, err := readVersionObject(h.versions, siteName, file)
+		if err != nil {
+			log.Printf("[ERROR] Failed to read version %s of site %s: %v", ref, siteName, err)
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		h.serveNotFound(w, r, bytes.NewReader(data), opts)
+		return
+	}
+
+	w.Header().Set("Content-Type", h.getContentType(filePath))
+
+	// 历史版本内容不会再变化，可以长期缓存
+	if w.Header().Get("Cache-Control") == "private" {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+
+	// 版本中的 _headers 和网站设置中的响应头规则（如 CSP）同样适用于历史版本，缓存策略保持不变
+	applyHeaderRules(w, opts.rules, opts.relPath, false, true)
+
+	contentType := h.getContentType(filePath)
+	encoding := ""
+	if isCompressible(contentType) {
+		addVary(w, "Accept-Encoding")
+		if h.compression != nil && shouldCompress(r, contentType, file.Size) {
+			encoding = "gzip"
+		}
+	}
+
+	// 路径模式下按设置为 HTML/CSS 加上网站访问前缀
+	rewritePrefix := opts.rewritesBasePath(contentType)
+	etag := fmt.Sprintf(`"%s"`, file.Object)
+	if rewritePrefix {
+		etag = encodedETag(etag, opts.pathRewrite)
+	}
+	etag = encodedETag(etag, encoding)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag, time.Time{}) {
+		writeNotModified(w)
+		return
+	}
+
+	data, err := readVersionObject(h.versions, siteName, file)
+	cacheKey := "version|" + file.Object
+	if err == nil && rewritePrefix {
+		data = rewriteBasePath(opts.pathRewrite, opts.basePath, opts.relPath, contentType, data)
+		cacheKey += "|" + opts.pathRewrite + "|" + opts.basePath
+	}
+	if err == nil && encoding != "" {
+		// 版本对象内容不变，以对象ID作为缓存键
+		data, err = h.compression.gzip(cacheKey, bytes.NewReader(data))
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	if err != nil {
+		w.Header().Del("Content-Encoding")
+		log.Printf("[ERROR] Failed to read version %s of site %s: %v", ref, siteName, err)
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, filePath, time.Time{}, bytes.NewReader(data))
+}
+
+// readVersionTree 解析版本引用并返回该版本的文件列表
+func readVersionTree(store VersionStore, siteName, ref string) (map[string]VersionFile, error) {
+	if store == nil {
+		return nil, errWebsiteNotFound
+	}
+
+	hash, err := store.Resolve(siteName, ref)
+	if err != nil {
+		return nil, &serveError{http.StatusNotFound, "Version not found"}
+	}
+	return store.Files(siteName, hash)
+}
+
+// findVersionFile 在历史版本中解析请求路径，返回文件路径、版本文件和响应状态码
+// 解析规则与线上版本一致：目录返回 index.html（地址缺少结尾的 / 时重定向），文件不存在时按网站的 404 处理方式处理
+func findVersionFile(files map[string]VersionFile, requestPath, notFound string) (string, VersionFile, int, error) {
+	if requestPath == "" {
+		return "", VersionFile{}, 0, errDirRedirect
+	}
+	filePath := strings.TrimPrefix(path.Clean("/"+requestPath), "/")
+	if filePath == "" {
+		filePath = "index.html"
+	}
+	if isRuleFile(filePath) {
+		return "", VersionFile{}, 0, errHiddenFile
+	}
+
+	file, exists := files[filePath]
+	if exists {
+		return filePath, file, http.StatusOK, nil
+	}
+
+	if hasTreePrefix(files, filePath+"/") {
+		// 目录，尝试 index.html
+		if !strings.HasSuffix(requestPath, "/") {
+			return "", VersionFile{}, 0, errDirRedirect
+		}
+		filePath = filePath + "/index.html"
+		if file, exists = files[filePath]; !exists {
+			return "", VersionFile{}, 0, errDirListing
+		}
+		return filePath, file, http.StatusOK, nil
+	}
+
+	_, hasIndex := files["index.html"]
+	_, has404 := files[notFoundPage]
+	fallback, status := notFoundFallback(notFound, hasIndex, has404)
+	if fallback == "" {
+		return "", VersionFile{}, 0, errFileNotFound
+	}
+	return fallback, files[fallback], status, nil
+}
+
+// versionFileExists 判断请求路径在历史版本中是否有对应的文件（目录需要包含 index.html）
+func versionFileExists(files map[string]VersionFile, requestPath string) bool {
+	filePath := strings.TrimPrefix(path.Clean("/"+requestPath), "/")
+	if _, exists := files[filePath]; exists {
+		return true
+	}
+	if filePath == "" {
+		filePath = "index.html"
+	} else {
+		filePath += "/index.html"
+	}
+	_, exists := files[filePath]
+	return exists
+}
+
+// hasTreePrefix 判断版本中是否存在以 prefix 开头的文件（即 prefix 对应目录）
+func hasTreePrefix(files map[string]VersionFile, prefix string) bool {
+	for file := range files {
+		if strings.HasPrefix(file, prefix) {
+			return true
+		}
+	}
+	return false
+}
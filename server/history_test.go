@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeVersionUsesVersionHeadersFile(t *testing.T) {
+	s := newTestServer(t, Config{EnableVersioning: true, Sites: map[string]Site{"demo": {Name: "demo", Owner: "admin"}}})
+	handler := s.newHandler()
+	siteDir := filepath.Join(s.config().WebRoot, "demo")
+
+	writeTestFiles(t, siteDir, map[string]string{
+		"index.html": "v1",
+		"_headers":   "/*\n  X-Version: v1\n",
+	})
+	if err := s.commitChanges("demo", "v1", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := s.versions.Resolve("demo", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versionPath := "/demo" + versionPathPrefix + hash[:versionURLHashLen]
+
+	// 线上版本已经删除了 _headers，历史版本仍按自己的 _headers 处理
+	if err := os.Remove(filepath.Join(siteDir, "_headers")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, siteDir, map[string]string{"index.html": "v2"})
+	if err := s.commitChanges("demo", "v2", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get(versionPath + "/")
+	if w.Code != http.StatusOK || w.Body.String() != "v1" || w.Header().Get("X-Version") != "v1" {
+		t.Errorf("version index: got %d %q X-Version=%q, want 200 v1 with the version's _headers", w.Code, w.Body.String(), w.Header().Get("X-Version"))
+	}
+	if w := get("/demo/"); w.Header().Get("X-Version") != "" {
+		t.Errorf("live site: got X-Version=%q, want the deleted _headers not to apply", w.Header().Get("X-Version"))
+	}
+}
+
+func TestServeVersionUsesVersionRedirectsFile(t *testing.T) {
+	s := newTestServer(t, Config{EnableVersioning: true, Sites: map[string]Site{"demo": {Name: "demo", Owner: "admin"}}})
+	handler := s.newHandler()
+	siteDir := filepath.Join(s.config().WebRoot, "demo")
+
+	writeTestFiles(t, siteDir, map[string]string{
+		"index.html": "v1",
+		"_redirects": "/old /index.html 301\n/app/* /index.html 200\n",
+	})
+	if err := s.commitChanges("demo", "v1", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := s.versions.Resolve("demo", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versionPath := "/demo" + versionPathPrefix + hash[:versionURLHashLen]
+
+	// 线上版本已经删除了 _redirects，历史版本仍按自己的 _redirects 处理
+	if err := os.Remove(filepath.Join(siteDir, "_redirects")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commitChanges("demo", "v2", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get(versionPath + "/old")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != versionPath+"/index.html" {
+		t.Errorf("version redirect: got %d Location=%q, want 301 %s/index.html", w.Code, w.Header().Get("Location"), versionPath)
+	}
+	if w := get(versionPath + "/app/settings"); w.Code != http.StatusOK || w.Body.String() != "v1" {
+		t.Errorf("version rewrite: got %d %q, want 200 v1", w.Code, w.Body.String())
+	}
+	if w := get("/demo/old"); w.Code == http.StatusMovedPermanently {
+		t.Error("live site: the deleted _redirects still applies")
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 混合模式下网站的访问方式
+const (
+	routingBoth      = ""          // 子域名和路径两种方式都可以访问
+	routingSubdomain = "subdomain" // 只能通过 <site>.base_domain 访问
+	routingPath      = "path"      // 只能通过 single_domain/<site> 访问
+)
+
+// validateRouting 校验网站的访问方式
+func validateRouting(routing string) error {
+	switch routing {
+	case routingBoth, routingSubdomain, routingPath:
+		return nil
+	}
+	return fmt.Errorf("无效的访问方式: %s（可选 subdomain、path，留空表示两种方式都可以）", routing)
+}
+
+// HybridModeHandler 混合模式的处理器：<site>.base_domain 按子域名解析，其他主机按路径解析
+type HybridModeHandler struct {
+	subdomain *StaticFileHandler
+	path      *PathModeHandler
+}
+
+// NewHybridModeHandler 创建混合模式处理器，两种解析方式共享缓存、网站锁和网站设置
+func NewHybridModeHandler(fileHandler *StaticFileHandler) *HybridModeHandler {
+	subdomain := *fileHandler
+	subdomain.mode = "subdomain"
+	path := *fileHandler
+	path.mode = "path"
+	return &HybridModeHandler{
+		subdomain: &subdomain,
+		path:      &PathModeHandler{StaticFileHandler: &path},
+	}
+}
+
+// ServeHTTP 按请求主机选择解析方式，自定义域名在两种解析方式下都直接对应网站
+func (h *HybridModeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.subdomain.isSubdomainHost(r.Host) {
+		h.subdomain.ServeHTTP(w, r)
+		return
+	}
+	h.path.ServeHTTP(w, r)
+}
+
+// isSubdomainHost 判断主机是否为 base_domain 的子域名（single_domain 本身按路径解析）
+func (h *StaticFileHandler) isSubdomainHost(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(host)
+	baseDomain := strings.ToLower(h.baseDomain)
+	if baseDomain == "" || host == strings.ToLower(h.singleDomain) {
+		return false
+	}
+	return strings.HasSuffix(host, "."+baseDomain)
+}
+
+// servesRouting 判断网站是否可以通过当前处理器的解析方式（subdomain 或 path）访问
+// 只有混合模式下网站设置了访问方式时才会限制
+func (h *StaticFileHandler) servesRouting(siteName string) bool {
+	if h.siteSettings == nil {
+		return true
+	}
+	routing := h.siteSettings(siteName).routing
+	return routing == routingBoth || routing == h.mode
+}
+
+// siteRoutings 返回网站是否可以通过子域名、路径访问
+func (s *DeployServer) siteRoutings(site *Site) (subdomain, path bool) {
+	switch s.config().Mode {
+	case "subdomain":
+		return true, false
+	case "hybrid":
+		return site.Routing != routingPath, site.Routing != routingSubdomain
+	}
+	return false, true
+}
+
+// pathHost 返回路径方式访问网站使用的主机：混合模式使用 single_domain（未配置时为 base_domain），
+// 路径模式使用当前请求的主机
+func (s *DeployServer) pathHost(r *http.Request) string {
+	if s.config().Mode == "hybrid" {
+		if s.config().SingleDomain != "" {
+			return s.publicHost(s.config().SingleDomain)
+		}
+		return s.publicHost(s.config().BaseDomain)
+	}
+	return s.publicHost(r.Host)
+}
+
+// siteURLs 生成网站所有的访问地址：子域名地址、路径地址和自定义域名地址
+func (s *DeployServer) siteURLs(r *http.Request, name string, site *Site) []string {
+	scheme := s.publicScheme()
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	var urls []string
+	subdomain, path := s.siteRoutings(site)
+	if subdomain {
+		urls = append(urls, fmt.Sprintf("%s://%s", scheme, s.publicHost(fmt.Sprintf("%s.%s", name, s.config().BaseDomain))))
+	}
+	if path {
+		urls = append(urls, fmt.Sprintf("%s://%s/%s/", scheme, s.pathHost(r), name))
+	}
+	for _, domain := range site.Domains {
+		urls = append(urls, fmt.Sprintf("%s://%s/", scheme, s.publicHost(domain)))
+	}
+	return urls
+}
+
+// lookupSite 获取网站配置（加读锁）
+func (s *DeployServer) lookupSite(name string) Site {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config().Sites[name]
+}
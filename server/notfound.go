@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// 请求路径不存在时的处理方式
+const (
+	notFoundAuto   = ""       // 默认：网站有 404.html 时按 custom 处理，否则按 spa 处理
+	notFoundSPA    = "spa"    // 返回 index.html（单页应用前端路由）
+	notFoundStrict = "strict" // 直接返回 404
+	notFoundCustom = "custom" // 返回网站的 404.html，状态码 404
+)
+
+// notFoundPage 自定义 404 页面文件名
+const notFoundPage = "404.html"
+
+// validateNotFoundMode 校验网站的 404 处理方式
+func validateNotFoundMode(mode string) error {
+	switch mode {
+	case notFoundAuto, notFoundSPA, notFoundStrict, notFoundCustom:
+		return nil
+	}
+	return fmt.Errorf("无效的 404 处理方式: %s（可选 spa、strict、custom，留空为自动）", mode)
+}
+
+// notFoundFallback 根据处理方式决定请求路径不存在时返回的文件和状态码，文件为空表示直接返回 404
+func notFoundFallback(mode string, hasIndex, has404 bool) (string, int) {
+	if mode == notFoundAuto {
+		mode = notFoundSPA
+		if has404 {
+			mode = notFoundCustom
+		}
+	}
+	switch mode {
+	case notFoundSPA:
+		if hasIndex {
+			return "index.html", http.StatusOK
+		}
+	case notFoundCustom:
+		if has404 {
+			return notFoundPage, http.StatusNotFound
+		}
+	}
+	return "", http.StatusNotFound
+}
+
+// siteServeConfig 静态文件处理器需要的网站设置
+type siteServeConfig struct {
+	headers     []HeaderRule // 网站设置中的响应头规则
+	notFound    string       // 请求路径不存在时的处理方式
+	pathRewrite string       // 路径模式下网站访问前缀的处理方式
+	routing     string       // 混合模式下网站的访问方式，为空表示不限制
+}
+
+// siteServeSettings 获取网站的静态文件服务设置
+func (s *DeployServer) siteServeSettings(siteName string) siteServeConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	site := s.config().Sites[siteName]
+	settings := siteServeConfig{headers: site.Headers, notFound: site.NotFound, pathRewrite: site.PathRewrite}
+	if s.config().Mode == "hybrid" {
+		settings.routing = site.Routing
+	}
+	return settings
+}
+
+// serveNotFoundPage 以 404 状态码返回自定义 404 页面（不参与缓存协商），响应头规则中的缓存策略不生效
+func serveNotFoundPage(w http.ResponseWriter, r *http.Request, content io.Reader, rules []HeaderRule) {
+	private := w.Header().Get("Cache-Control") == "private"
+	if private {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	applyHeaderRules(w, rules, "/"+notFoundPage, private, true)
+	w.WriteHeader(http.StatusNotFound)
+	if r.Method != http.MethodHead {
+		io.Copy(w, content)
+	}
+}
+
+// redirectToDirectory 目录地址不以 / 结尾时重定向到带 / 的地址，保证页面中的相对路径正确解析
+func redirectToDirectory(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Path + "/"
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
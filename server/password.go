@@ -0,0 +1,180 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultAdminPassword 默认管理员密码，使用该密码的账号首次登录后必须修改
+const defaultAdminPassword = "admin123"
+
+// minPasswordLength 新密码最小长度
+const minPasswordLength = 6
+
+// HashPassword 使用 bcrypt 计算密码哈希
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("计算密码哈希失败: %v", err)
+	}
+	return string(hash), nil
+}
+
+// isPasswordHash 判断存储的密码是否已经是 bcrypt 哈希
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+// checkPassword 校验密码，兼容尚未迁移的明文密码
+func checkPassword(stored, password string) bool {
+	if isPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
+
+// validateNewPassword 校验新密码
+func validateNewPassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("密码长度不能少于 %d 位", minPasswordLength)
+	}
+	if password == defaultAdminPassword {
+		return fmt.Errorf("不能使用默认密码")
+	}
+	return nil
+}
+
+// migratePasswords 将配置中的明文密码迁移为哈希，仍在使用默认密码的账号标记为必须修改
+func (s *DeployServer) migratePasswords() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	migrated := 0
+	for name, user := range s.config().Users {
+		if user.Password == "" || isPasswordHash(user.Password) {
+			continue
+		}
+
+		hash, err := HashPassword(user.Password)
+		if err != nil {
+			fmt.Printf("迁移用户 %s 的密码失败: %v\n", name, err)
+			continue
+		}
+		if user.Password == defaultAdminPassword {
+			user.MustChangePassword = true
+		}
+		user.Password = hash
+		s.config().Users[name] = user
+		migrated++
+	}
+
+	if migrated == 0 {
+		return
+	}
+	if err := s.saveConfig(); err != nil {
+		fmt.Printf("保存迁移后的密码失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已将 %d 个用户的明文密码迁移为哈希存储\n", migrated)
+}
+
+// upgradePassword 登录成功后将明文密码升级为哈希（启动迁移失败时的兜底）
+func (s *DeployServer) upgradePassword(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.config().Users[username]
+	if !exists || isPasswordHash(user.Password) {
+		return
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		fmt.Printf("升级用户 %s 的密码失败: %v\n", username, err)
+		return
+	}
+	if password == defaultAdminPassword {
+		user.MustChangePassword = true
+	}
+	user.Password = hash
+	s.config().Users[username] = user
+
+	if err := s.saveConfig(); err != nil {
+		fmt.Printf("保存用户 %s 的密码失败: %v\n", username, err)
+	}
+}
+
+// handleChangePassword 当前用户修改自己的密码
+// 不经过认证中间件，必须修改默认密码的用户也可以调用
+func (s *DeployServer) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, err := s.userFromAccessToken(bearerToken(r))
+	if err != nil {
+		s.respondError(w, "未授权："+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, "无效的请求", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateNewPassword(req.NewPassword); err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := HashPassword(req.NewPassword)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	user, exists := s.config().Users[current.Name]
+	if !exists {
+		s.mu.Unlock()
+		s.respondError(w, "用户不存在", http.StatusNotFound)
+		return
+	}
+
+	if !checkPassword(user.Password, req.OldPassword) {
+		s.mu.Unlock()
+		s.respondError(w, "原密码错误", http.StatusUnauthorized)
+		return
+	}
+
+	user.Password = hash
+	user.MustChangePassword = false
+	s.config().Users[current.Name] = user
+
+	err = s.saveConfig()
+	s.mu.Unlock()
+	if err != nil {
+		s.respondError(w, "保存配置失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 注销该用户在其他地方登录的会话，保留当前会话
+	s.revokeUserSessions(current.Name, s.currentSessionID(r))
+
+	s.respondJSON(w, map[string]string{
+		"message": "密码修改成功",
+	})
+}
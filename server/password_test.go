@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPlaintextPasswordsMigratedOnStartup(t *testing.T) {
+	s := newTestServer(t, Config{Users: map[string]User{
+		"admin": {Name: "admin", Password: defaultAdminPassword, IsAdmin: true},
+		"bob":   {Name: "bob", Password: "bob-secret"},
+	}})
+
+	saved, err := loadTestConfig(s.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, user := range saved.Users {
+		if !isPasswordHash(user.Password) {
+			t.Errorf("%s's password was saved as %q, want a bcrypt hash", name, user.Password)
+		}
+	}
+	if !saved.Users["admin"].MustChangePassword || saved.Users["bob"].MustChangePassword {
+		t.Error("only the default admin password should require a change")
+	}
+	if _, err := s.authenticate("bob", "bob-secret"); err != nil {
+		t.Errorf("authenticate(bob) after migration = %v", err)
+	}
+}
+
+func TestDefaultPasswordMustBeChanged(t *testing.T) {
+	s := newTestServer(t, Config{Users: map[string]User{
+		"admin": {Name: "admin", Password: defaultAdminPassword, IsAdmin: true},
+	}})
+	list := s.authMiddleware(s.handleListSites)
+	changePassword := http.HandlerFunc(s.handleChangePassword)
+	tokens := loginTestUser(t, s, "admin", defaultAdminPassword)
+
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", tokens.AccessToken, nil); w.Code != http.StatusForbidden {
+		t.Errorf("API before changing the default password: got %d, want 403", w.Code)
+	}
+
+	tests := []struct {
+		oldPassword, newPassword string
+		want                     int
+	}{
+		{"wrong-password", "new-secret1", http.StatusUnauthorized},
+		{defaultAdminPassword, "short", http.StatusBadRequest},
+		{defaultAdminPassword, defaultAdminPassword, http.StatusBadRequest},
+		{defaultAdminPassword, "new-secret1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := serveTestRequest(t, changePassword, http.MethodPost, "/api/auth/change-password", tokens.AccessToken, map[string]string{
+			"old_password": tt.oldPassword,
+			"new_password": tt.newPassword,
+		})
+		if w.Code != tt.want {
+			t.Errorf("change %q -> %q: got %d, want %d", tt.oldPassword, tt.newPassword, w.Code, tt.want)
+		}
+	}
+
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", tokens.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("API after changing the password: got %d, want 200", w.Code)
+	}
+	if w := serveTestRequest(t, http.HandlerFunc(s.handleLogin), http.MethodPost, "/api/auth/login", "", map[string]string{"username": "admin", "password": defaultAdminPassword}); w.Code != http.StatusUnauthorized {
+		t.Errorf("login with the old password: got %d, want 401", w.Code)
+	}
+
+	saved, err := loadTestConfig(s.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin := saved.Users["admin"]; !isPasswordHash(admin.Password) || strings.Contains(admin.Password, "new-secret1") || admin.MustChangePassword {
+		t.Errorf("saved admin = %+v, want a hashed password without must_change_password", admin)
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	s := newTestServer(t, Config{})
+	list := s.authMiddleware(s.handleListSites)
+	refresh := http.HandlerFunc(s.handleRefreshToken)
+	current := loginTestUser(t, s, "admin", "admin-secret")
+	other := loginTestUser(t, s, "admin", "admin-secret")
+
+	w := serveTestRequest(t, http.HandlerFunc(s.handleChangePassword), http.MethodPost, "/api/auth/change-password", current.AccessToken, map[string]string{
+		"old_password": "admin-secret",
+		"new_password": "new-secret1",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("change password: got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", current.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("current session after changing the password: got %d, want 200", w.Code)
+	}
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", other.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("other session's access token: got %d, want 401", w.Code)
+	}
+	if w := serveTestRequest(t, refresh, http.MethodPost, "/api/auth/refresh", "", map[string]string{"refresh_token": other.RefreshToken}); w.Code != http.StatusUnauthorized {
+		t.Errorf("other session's refresh token: got %d, want 401", w.Code)
+	}
+}
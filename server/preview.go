@@ -0,0 +1,569 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// previewsDirName 预览目录名（位于web根目录下，隐藏目录不会被当作网站）
+const previewsDirName = ".previews"
+
+// previewPathPrefix 路径模式下预览地址的前缀：/site/_preview/label/
+const previewPathPrefix = "/_preview/"
+
+// previewHostSeparator 子域名模式下预览地址中标签与网站名的分隔符：label--site.base_domain
+const previewHostSeparator = "--"
+
+// defaultPreviewTTL 预览默认有效期
+const defaultPreviewTTL = 7 * 24 * time.Hour
+
+// previewCleanupInterval 过期预览清理间隔
+const previewCleanupInterval = 10 * time.Minute
+
+// Preview 预览部署信息
+type Preview struct {
+	Site      string    `json:"site"`       // 网站名称
+	Label     string    `json:"label"`      // 预览标签（如分支名）
+	Message   string    `json:"message"`    // 部署说明
+	CreatedBy string    `json:"created_by"` // 部署用户
+	CreatedAt time.Time `json:"created_at"` // 部署时间
+	ExpiresAt time.Time `json:"expires_at"` // 过期时间
+}
+
+// expired 预览是否已过期
+func (p *Preview) expired() bool {
+	return time.Now().After(p.ExpiresAt)
+}
+
+// previewStore 预览索引，与静态文件处理器共享
+// 预览内容保存在 .previews/<site>/<label>/，元数据保存在 .previews/<site>/<label>.json
+type previewStore struct {
+	root  string
+	mu    sync.RWMutex
+	items map[string]*Preview // site/label -> 预览
+}
+
+// newPreviewStore 创建预览索引并从磁盘加载已有预览
+func newPreviewStore(webRoot string) *previewStore {
+	p := &previewStore{
+		root:  filepath.Join(webRoot, previewsDirName),
+		items: make(map[string]*Preview),
+	}
+
+	metas, _ := filepath.Glob(filepath.Join(p.root, "*", "*.json"))
+	for _, meta := range metas {
+		data, err := os.ReadFile(meta)
+		if err != nil {
+			continue
+		}
+		var preview Preview
+		if err := json.Unmarshal(data, &preview); err != nil {
+			continue
+		}
+		p.items[previewKey(preview.Site, preview.Label)] = &preview
+	}
+	return p
+}
+
+// previewKey 预览索引键
+func previewKey(site, label string) string {
+	return site + "/" + label
+}
+
+// dir 返回预览内容目录
+func (p *previewStore) dir(site, label string) string {
+	return filepath.Join(p.root, site, label)
+}
+
+// metaPath 返回预览元数据文件路径
+func (p *previewStore) metaPath(site, label string) string {
+	return filepath.Join(p.root, site, label+".json")
+}
+
+// get 获取未过期的预览
+func (p *previewStore) get(site, label string) (Preview, bool) {
+	if p == nil {
+		return Preview{}, false
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	preview, exists := p.items[previewKey(site, label)]
+	if !exists || preview.expired() {
+		return Preview{}, false
+	}
+	return *preview, true
+}
+
+// list 列出网站的所有预览（按创建时间倒序）
+func (p *previewStore) list(site string) []Preview {
+	p.mu.RLock()
+	previews := make([]Preview, 0)
+	for _, preview := range p.items {
+		if preview.Site == site {
+			previews = append(previews, *preview)
+		}
+	}
+	p.mu.RUnlock()
+
+	sort.Slice(previews, func(i, j int) bool {
+		return previews[i].CreatedAt.After(previews[j].CreatedAt)
+	})
+	return previews
+}
+
+// put 保存预览元数据
+func (p *previewStore) put(preview Preview) error {
+	data, err := json.MarshalIndent(preview, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p.metaPath(preview.Site, preview.Label), data, 0644); err != nil {
+		return fmt.Errorf("保存预览信息失败: %v", err)
+	}
+
+	p.mu.Lock()
+	p.items[previewKey(preview.Site, preview.Label)] = &preview
+	p.mu.Unlock()
+	return nil
+}
+
+// remove 删除预览内容和元数据
+func (p *previewStore) remove(site, label string) error {
+	p.mu.Lock()
+	delete(p.items, previewKey(site, label))
+	p.mu.Unlock()
+
+	os.Remove(p.metaPath(site, label))
+	if err := os.RemoveAll(p.dir(site, label)); err != nil {
+		return fmt.Errorf("删除预览失败: %v", err)
+	}
+	return nil
+}
+
+// removeSite 删除网站的所有预览
+func (p *previewStore) removeSite(site string) error {
+	p.mu.Lock()
+	for key, preview := range p.items {
+		if preview.Site == site {
+			delete(p.items, key)
+		}
+	}
+	p.mu.Unlock()
+
+	return os.RemoveAll(filepath.Join(p.root, site))
+}
+
+// expiredPreviews 返回所有已过期的预览
+func (p *previewStore) expiredPreviews() []Preview {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var expired []Preview
+	for _, preview := range p.items {
+		if preview.expired() {
+			expired = append(expired, *preview)
+		}
+	}
+	return expired
+}
+
+// validatePreviewLabel 校验预览标签：小写字母、数字和单个连字符，不能包含 "--"（用于子域名分隔）
+func validatePreviewLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("预览标签不能为空")
+	}
+	if len(label) > 40 {
+		return fmt.Errorf("预览标签不能超过 40 个字符")
+	}
+	for _, c := range label {
+		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-') {
+			return fmt.Errorf("预览标签只能包含小写字母、数字和连字符")
+		}
+	}
+	if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") || strings.Contains(label, previewHostSeparator) {
+		return fmt.Errorf("预览标签不能以连字符开头或结尾，也不能包含 '%s'", previewHostSeparator)
+	}
+	return nil
+}
+
+// validatePreviewTarget 校验网站名称和预览标签，防止路径穿越
+func validatePreviewTarget(site, label string) error {
+	if site == "" || site != filepath.Base(site) || strings.HasPrefix(site, ".") {
+		return fmt.Errorf("无效的网站名称")
+	}
+	return validatePreviewLabel(label)
+}
+
+// splitPreviewHost 拆分子域名模式下的预览名称：label--site -> (label, site)
+func splitPreviewHost(name string) (label, site string, ok bool) {
+	parts := strings.SplitN(name, previewHostSeparator, 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// splitPreviewPath 拆分路径模式下的预览路径：/_preview/label/path -> (label, /path)
+func splitPreviewPath(requestPath string) (label, rest string, ok bool) {
+	if !strings.HasPrefix(requestPath, previewPathPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(requestPath, previewPathPrefix), "/", 2)
+	if parts[0] == "" {
+		return "", "", false
+	}
+	// 缺少结尾的 / 时 rest 为空，由静态文件处理器重定向到目录地址
+	if len(parts) > 1 {
+		rest = "/" + parts[1]
+	}
+	return parts[0], rest, true
+}
+
+// previewLockName 预览在网站锁集合中使用的名称
+func previewLockName(site, label string) string {
+	return previewHostSeparator + previewKey(site, label)
+}
+
+// previewURL 生成预览访问地址
+func (s *DeployServer) previewURL(r *http.Request, site, label string) string {
+	scheme := s.publicScheme()
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	siteConfig := s.lookupSite(site)
+	if subdomain, _ := s.siteRoutings(&siteConfig); subdomain {
+		host := s.publicHost(fmt.Sprintf("%s%s%s.%s", label, previewHostSeparator, site, s.config().BaseDomain))
+		return fmt.Sprintf("%s://%s/", scheme, host)
+	}
+	return fmt.Sprintf("%s://%s/%s%s%s/", scheme, s.pathHost(r), site, previewPathPrefix, label)
+}
+
+// previewTTL 解析请求中的预览有效期（小时），未指定时使用配置或默认值
+func (s *DeployServer) previewTTL(r *http.Request) (time.Duration, error) {
+	ttl := defaultPreviewTTL
+	if s.config().PreviewTTLHours > 0 {
+		ttl = time.Duration(s.config().PreviewTTLHours) * time.Hour
+	}
+
+	if value := r.FormValue("preview_ttl_hours"); value != "" {
+		var hours int
+		if _, err := fmt.Sscanf(value, "%d", &hours); err != nil || hours <= 0 {
+			return 0, fmt.Errorf("无效的预览有效期: %s", value)
+		}
+		ttl = time.Duration(hours) * time.Hour
+	}
+	return ttl, nil
+}
+
+// publishPreview 将暂存目录发布为预览，已存在的同名预览会被替换
+func (s *DeployServer) publishPreview(preview Preview, stage string) error {
+	dir := s.previews.dir(preview.Site, preview.Label)
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("创建预览目录失败: %v", err)
+	}
+
+	oldPath := stage + ".old"
+	lock := s.locks.get(previewLockName(preview.Site, preview.Label))
+	lock.serve.Lock()
+
+	hasOld := false
+	if _, err := os.Stat(dir); err == nil {
+		if err := os.Rename(dir, oldPath); err != nil {
+			lock.serve.Unlock()
+			return fmt.Errorf("移出旧预览失败: %v", err)
+		}
+		hasOld = true
+	}
+
+	if err := os.Rename(stage, dir); err != nil {
+		if hasOld {
+			os.Rename(oldPath, dir)
+		}
+		lock.serve.Unlock()
+		return fmt.Errorf("发布预览失败: %v", err)
+	}
+
+	err := s.previews.put(preview)
+	lock.serve.Unlock()
+
+	if hasOld {
+		os.RemoveAll(oldPath)
+	}
+	return err
+}
+
+// deployPreview 将全量部署包发布为预览（由全量部署接口在指定 preview 时调用）
+func (s *DeployServer) deployPreview(w http.ResponseWriter, r *http.Request, name, label, message string, file io.Reader) {
+	ttl, err := s.previewTTL(r)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lock := s.locks.get(previewLockName(name, label))
+	lock.deploy.Lock()
+	defer lock.deploy.Unlock()
+
+	stage, err := s.newStage(name, false)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(stage)
+
+	if _, err := s.extractPackage(file, stage); err != nil {
+		s.respondError(w, fmt.Sprintf("解压失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := validateStage(stage); err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.precompressStage(stage)
+
+	var createdBy string
+	if user := userFromContext(r.Context()); user != nil {
+		createdBy = user.Name
+	}
+
+	now := time.Now()
+	preview := Preview{
+		Site:      name,
+		Label:     label,
+		Message:   message,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.publishPreview(preview, stage); err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.respondJSON(w, map[string]interface{}{
+		"message":    "预览部署成功",
+		"mode":       "preview",
+		"label":      label,
+		"url":        s.previewURL(r, name, label),
+		"expires_at": preview.ExpiresAt,
+	})
+}
+
+// cleanupPreviews 定期清理过期的预览
+func (s *DeployServer) cleanupPreviews() {
+	for {
+		for _, preview := range s.previews.expiredPreviews() {
+			lock := s.locks.get(previewLockName(preview.Site, preview.Label))
+			lock.deploy.Lock()
+			// 加锁后再次确认，避免删除刚刚重新发布的预览
+			if _, active := s.previews.get(preview.Site, preview.Label); !active {
+				if err := s.previews.remove(preview.Site, preview.Label); err != nil {
+					fmt.Printf("清理过期预览 %s/%s 失败: %v\n", preview.Site, preview.Label, err)
+				}
+			}
+			lock.deploy.Unlock()
+		}
+		time.Sleep(previewCleanupInterval)
+	}
+}
+
+// handleListPreviews 列出网站的预览部署
+func (s *DeployServer) handleListPreviews(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		s.respondError(w, "网站名称不能为空", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.checkSiteAccess(r, name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	type PreviewInfo struct {
+		Preview
+		URL     string `json:"url"`
+		Expired bool   `json:"expired"`
+	}
+
+	previews := make([]PreviewInfo, 0)
+	for _, preview := range s.previews.list(name) {
+		previews = append(previews, PreviewInfo{
+			Preview: preview,
+			URL:     s.previewURL(r, name, preview.Label),
+			Expired: preview.expired(),
+		})
+	}
+
+	s.respondJSON(w, map[string]interface{}{
+		"previews": previews,
+	})
+}
+
+// handleDeletePreview 删除预览部署
+func (s *DeployServer) handleDeletePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name  string `json:"name"`
+		Label string `json:"label"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.Label == "" {
+		s.respondError(w, "无效的请求", http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePreviewTarget(req.Name, req.Label); err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.checkSiteAccess(r, req.Name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	lock := s.locks.get(previewLockName(req.Name, req.Label))
+	lock.deploy.Lock()
+	defer lock.deploy.Unlock()
+
+	if _, err := os.Stat(s.previews.dir(req.Name, req.Label)); os.IsNotExist(err) {
+		s.respondError(w, "预览不存在", http.StatusNotFound)
+		return
+	}
+
+	lock.serve.Lock()
+	err := s.previews.remove(req.Name, req.Label)
+	lock.serve.Unlock()
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.respondJSON(w, map[string]string{
+		"message": "预览已删除",
+	})
+}
+
+// handlePromotePreview 将预览提升为线上版本
+func (s *DeployServer) handlePromotePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name    string `json:"name"`
+		Label   string `json:"label"`
+		Message string `json:"message"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.Label == "" {
+		s.respondError(w, "无效的请求", http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePreviewTarget(req.Name, req.Label); err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.checkSiteAccess(r, req.Name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, req.Name)
+	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
+		s.respondError(w, "网站不存在", http.StatusNotFound)
+		return
+	}
+
+	lock := s.locks.get(req.Name)
+	lock.deploy.Lock()
+	defer lock.deploy.Unlock()
+
+	// 复制预览内容时持有预览的读锁，保证复制到的是完整的预览版本
+	previewLock := s.locks.get(previewLockName(req.Name, req.Label))
+	previewLock.serve.RLock()
+	preview, exists := s.previews.get(req.Name, req.Label)
+	if !exists {
+		previewLock.serve.RUnlock()
+		s.respondError(w, "预览不存在或已过期", http.StatusNotFound)
+		return
+	}
+
+	stage, err := s.newStage(req.Name, false)
+	if err == nil {
+		err = copyTree(s.previews.dir(req.Name, req.Label), stage)
+	}
+	previewLock.serve.RUnlock()
+	if stage != "" {
+		defer os.RemoveAll(stage)
+	}
+	if err != nil {
+		s.respondError(w, fmt.Sprintf("复制预览失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := validateStage(stage); err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.precompressStage(stage)
+	stats, err := compareTrees(sitePath, stage, s.config().Precompress)
+	if err != nil {
+		s.respondError(w, fmt.Sprintf("统计文件变化失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.activateStage(req.Name, stage); err != nil {
+		s.respondError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 保存版本
+	if s.config().EnableVersioning {
+		message := req.Message
+		if message == "" {
+			message = preview.Message
+		}
+		message = fmt.Sprintf("提升预览 %s: %s", req.Label, message)
+		if err := s.commitChanges(req.Name, message, requestAuthor(r)); err != nil {
+			fmt.Printf("版本提交失败: %v\n", err)
+		}
+	}
+
+	s.mu.Lock()
+	if site, exists := s.sites[req.Name]; exists {
+		site.UpdatedAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	s.respondJSON(w, map[string]interface{}{
+		"message":   "预览已提升为线上版本",
+		"added":     stats.Added,
+		"replaced":  stats.Replaced,
+		"removed":   stats.Removed,
+		"unchanged": stats.Unchanged,
+	})
+}
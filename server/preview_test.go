@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreviewsRequireSiteAccess(t *testing.T) {
+	s := newTestServer(t, Config{
+		Users: map[string]User{
+			"admin": {Name: "admin", Password: "admin-secret", IsAdmin: true},
+			"alice": {Name: "alice", Password: "alice-secret"},
+			"bob":   {Name: "bob", Password: "bob-secret"},
+		},
+		Sites: map[string]Site{"demo": {Name: "demo", Owner: "alice"}},
+	})
+	writeTestFiles(t, filepath.Join(s.config().WebRoot, "demo"), map[string]string{"index.html": "live"})
+	alice := loginTestUser(t, s, "alice", "alice-secret")
+	bob := loginTestUser(t, s, "bob", "bob-secret")
+	body := map[string]string{"name": "demo", "label": "new-home"}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    interface{}
+	}{
+		{"list", s.handleListPreviews, http.MethodGet, "/api/sites/previews?name=demo", nil},
+		{"delete", s.handleDeletePreview, http.MethodPost, "/api/sites/previews/delete", body},
+		{"promote", s.handlePromotePreview, http.MethodPost, "/api/sites/promote", body},
+	}
+	for _, tt := range tests {
+		if w := serveTestRequest(t, s.authMiddleware(tt.handler), tt.method, tt.target, bob.AccessToken, tt.body); w.Code != http.StatusForbidden {
+			t.Errorf("bob %s: got %d, want 403", tt.name, w.Code)
+		}
+		// 所有者通过权限检查（预览不存在时返回 404）
+		if w := serveTestRequest(t, s.authMiddleware(tt.handler), tt.method, tt.target, alice.AccessToken, tt.body); w.Code == http.StatusForbidden {
+			t.Errorf("alice %s: got 403 (%s)", tt.name, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redirectsFileName 部署包中的重定向/重写规则文件
+const redirectsFileName = "_redirects"
+
+// RedirectRule 重定向/重写规则
+type RedirectRule struct {
+	From   string // 来源路径，支持 :name 占位符（匹配一段路径）和结尾的 *（匹配剩余路径）
+	To     string // 目标路径或 http(s) 地址，可以引用 :name 和 :splat
+	Status int    // 301/302/303/307/308 为重定向，200 为重写（目标为地址时是代理）
+	Force  bool   // 为 true 时即使请求路径存在对应文件也应用规则
+}
+
+// redirectStatuses 支持的规则状态码
+var redirectStatuses = map[int]bool{
+	http.StatusOK:                true,
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusSeeOther:          true,
+	http.StatusTemporaryRedirect: true,
+	http.StatusPermanentRedirect: true,
+}
+
+// isProxy 判断规则是否为代理到外部地址
+func (rule *RedirectRule) isProxy() bool {
+	return rule.Status == http.StatusOK && isAbsoluteURL(rule.To)
+}
+
+// isAbsoluteURL 判断目标是否为 http(s) 地址
+func isAbsoluteURL(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// parseRedirectsFile 解析 _redirects 文件，每行一条规则：
+//
+//	/old-page     /new-page              301
+//	/blog/*       /news/:splat           302
+//	/users/:id    /profile?id=:id        301
+//	/app/*        /app/index.html        200
+//	/api/*        https://api.example.com/:splat  200
+//	/docs/*       /manual/:splat         301!
+//
+// 状态码省略时为 301，状态码后加 ! 表示即使存在对应文件也强制应用；# 开头的行是注释
+// 规则按顺序匹配，使用第一条匹配的规则
+func parseRedirectsFile(data []byte) ([]RedirectRule, error) {
+	var rules []RedirectRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRedirectRule(strings.Fields(line))
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %v", lineNo, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// parseRedirectRule 解析并校验一条规则
+func parseRedirectRule(fields []string) (RedirectRule, error) {
+	if len(fields) < 2 {
+		return RedirectRule{}, fmt.Errorf("规则至少需要来源和目标")
+	}
+	if len(fields) > 3 {
+		return RedirectRule{}, fmt.Errorf("不支持的规则参数: %s", strings.Join(fields[3:], " "))
+	}
+
+	rule := RedirectRule{From: fields[0], To: fields[1], Status: http.StatusMovedPermanently}
+	if len(fields) == 3 {
+		status := fields[2]
+		if strings.HasSuffix(status, "!") {
+			rule.Force = true
+			status = strings.TrimSuffix(status, "!")
+		}
+		code, err := strconv.Atoi(status)
+		if err != nil || !redirectStatuses[code] {
+			return RedirectRule{}, fmt.Errorf("不支持的状态码: %s", fields[2])
+		}
+		rule.Status = code
+	}
+
+	if !strings.HasPrefix(rule.From, "/") {
+		return RedirectRule{}, fmt.Errorf("来源必须以 / 开头: %s", rule.From)
+	}
+	names := map[string]bool{}
+	segments := strings.Split(strings.Trim(rule.From, "/"), "/")
+	for i, segment := range segments {
+		switch {
+		case strings.Contains(segment, "*"):
+			if segment != "*" || i != len(segments)-1 {
+				return RedirectRule{}, fmt.Errorf("* 只能作为来源的最后一段: %s", rule.From)
+			}
+			names["splat"] = true
+		case strings.HasPrefix(segment, ":"):
+			name := segment[1:]
+			if name == "" || name == "splat" || names[name] {
+				return RedirectRule{}, fmt.Errorf("无效的占位符: %s", segment)
+			}
+			names[name] = true
+		}
+	}
+
+	if isAbsoluteURL(rule.To) {
+		if _, err := url.Parse(rule.To); err != nil {
+			return RedirectRule{}, fmt.Errorf("无效的目标地址: %s", rule.To)
+		}
+	} else if !strings.HasPrefix(rule.To, "/") {
+		return RedirectRule{}, fmt.Errorf("目标必须以 / 开头或是 http(s) 地址: %s", rule.To)
+	}
+	for _, name := range placeholderNames(rule.To) {
+		if !names[name] {
+			return RedirectRule{}, fmt.Errorf("目标引用了来源中不存在的占位符 :%s", name)
+		}
+	}
+	return rule, nil
+}
+
+// placeholderNames 提取目标中引用的占位符名称（:后以字母开头，端口号等不是占位符）
+func placeholderNames(target string) []string {
+	var names []string
+	for i := 0; i < len(target); i++ {
+		if target[i] != ':' || i+1 >= len(target) || !isPlaceholderStart(target[i+1]) {
+			continue
+		}
+		j := i + 1
+		for j < len(target) && isPlaceholderChar(target[j]) {
+			j++
+		}
+		names = append(names, target[i+1:j])
+		i = j - 1
+	}
+	return names
+}
+
+// isPlaceholderStart 判断是否可以作为占位符名称的首字符
+func isPlaceholderStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+// isPlaceholderChar 判断是否为占位符名称中的字符
+func isPlaceholderChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+// match 匹配请求路径，成功时返回替换占位符后的目标
+func (rule *RedirectRule) match(requestPath string) (string, bool) {
+	patternSegments := strings.Split(strings.Trim(rule.From, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(requestPath, "/"), "/")
+	if len(pathSegments) == 1 && pathSegments[0] == "" {
+		pathSegments = nil
+	}
+	if len(patternSegments) == 1 && patternSegments[0] == "" {
+		patternSegments = nil
+	}
+
+	values := map[string]string{}
+	for i, segment := range patternSegments {
+		if segment == "*" {
+			// /blog/* 同时匹配 /blog
+			if i <= len(pathSegments) {
+				values["splat"] = strings.Join(pathSegments[i:], "/")
+				return rule.expand(values), true
+			}
+			return "", false
+		}
+		if i >= len(pathSegments) {
+			return "", false
+		}
+		if strings.HasPrefix(segment, ":") {
+			values[segment[1:]] = pathSegments[i]
+		} else if segment != pathSegments[i] {
+			return "", false
+		}
+	}
+	if len(pathSegments) != len(patternSegments) {
+		return "", false
+	}
+	return rule.expand(values), true
+}
+
+// expand 替换目标中的占位符，较长的名称先替换，避免 :id 覆盖 :idx
+func (rule *RedirectRule) expand(values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+	target := rule.To
+	for _, name := range names {
+		target = strings.ReplaceAll(target, ":"+name, values[name])
+	}
+	return target
+}
+
+// siteFileExists 判断请求路径在网站目录中是否有对应的文件（目录需包含 index.html）
+func siteFileExists(sitePath, requestPath string) bool {
+	filePath := filepath.Clean(filepath.Join(sitePath, requestPath))
+	if !withinDir(sitePath, filePath) {
+		return false
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		info, err = os.Stat(filepath.Join(filePath, "index.html"))
+		return err == nil && !info.IsDir()
+	}
+	return true
+}
+
+// findRedirect 查找请求路径第一条生效的规则，未强制的规则只在请求路径没有对应文件时生效
+// fileExists 判断请求路径在网站中是否有对应的文件
+func findRedirect(rules []RedirectRule, requestPath string, fileExists func(requestPath string) bool) (*RedirectRule, string) {
+	exists := -1
+	for i := range rules {
+		target, ok := rules[i].match(requestPath)
+		if !ok {
+			continue
+		}
+		if !rules[i].Force {
+			if exists < 0 {
+				exists = 0
+				if fileExists(requestPath) {
+					exists = 1
+				}
+			}
+			if exists == 1 {
+				continue
+			}
+		}
+		return &rules[i], target
+	}
+	return nil, ""
+}
+
+// redirectLocation 生成重定向地址：站内路径加上网站的访问前缀，未指定查询参数时保留原请求的查询参数
+func redirectLocation(r *http.Request, base, target string) string {
+	if !isAbsoluteURL(target) {
+		target = base + target
+	}
+	if !strings.Contains(target, "?") && r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	return target
+}
+
+// proxyRequest 将请求代理到外部地址
+// 不转发访问凭据（Basic 认证、平台登录 Cookie），避免泄露给目标站点
+func (h *StaticFileHandler) proxyRequest(w http.ResponseWriter, r *http.Request, siteName, target string) {
+	targetURL, err := url.Parse(redirectLocation(r, "", target))
+	if err != nil {
+		http.Error(w, "Invalid proxy target", http.StatusBadGateway)
+		return
+	}
+	if h.allowProxy == nil || !h.allowProxy(targetURL.Hostname()) {
+		log.Printf("[ERROR] Proxy to %s not allowed for site %s", targetURL.Host, siteName)
+		http.Error(w, "Proxy target not allowed", http.StatusForbidden)
+		return
+	}
+
+	// 清除访问策略设置的缓存头，由目标站点决定
+	w.Header().Del("Cache-Control")
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL = targetURL
+			req.Host = targetURL.Host
+			req.Header.Del("Authorization")
+			req.Header.Del("Cookie")
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Printf("[ERROR] Proxy to %s failed: %v", targetURL.Host, err)
+			http.Error(w, "Bad gateway", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// allowProxyHost 判断重写规则是否可以代理到指定主机（配置 proxy_hosts，* 表示允许全部）
+func (s *DeployServer) allowProxyHost(host string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, allowed := range s.config().ProxyHosts {
+		if allowed == "*" || strings.EqualFold(allowed, host) {
+			return true
+		}
+		// *.example.com 匹配子域名
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(strings.ToLower(host), strings.ToLower(allowed[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// siteBasePath 计算请求中网站的访问前缀（路径模式为 /site，预览为 /site/_preview/label，子域名和自定义域名为空）
+func siteBasePath(r *http.Request, requestPath string) string {
+	if requestPath == "" {
+		return strings.TrimSuffix(r.URL.Path, "/")
+	}
+	if strings.HasSuffix(r.URL.Path, requestPath) {
+		return strings.TrimSuffix(r.URL.Path, requestPath)
+	}
+	return ""
+}
+
+// cleanRequestPath 规范化请求路径用于规则匹配
+func cleanRequestPath(requestPath string) string {
+	return path.Clean("/" + requestPath)
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stagingDirName 部署暂存目录名（位于web根目录下，隐藏目录不会被当作网站）
+const stagingDirName = ".staging"
+
+// siteLock 单个网站的锁
+type siteLock struct {
+	serve  sync.RWMutex // 静态文件解析时持读锁，版本切换时持写锁
+	deploy sync.Mutex   // 串行化同一网站的部署/回滚
+}
+
+// siteLocks 网站级锁集合
+type siteLocks struct {
+	mu    sync.Mutex
+	locks map[string]*siteLock
+}
+
+// newSiteLocks 创建网站锁集合
+func newSiteLocks() *siteLocks {
+	return &siteLocks{locks: make(map[string]*siteLock)}
+}
+
+// get 获取网站对应的锁，不存在则创建
+func (l *siteLocks) get(name string) *siteLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock, exists := l.locks[name]
+	if !exists {
+		lock = &siteLock{}
+		l.locks[name] = lock
+	}
+	return lock
+}
+
+// stagingRoot 返回暂存根目录
+func (s *DeployServer) stagingRoot() string {
+	return filepath.Join(s.config().WebRoot, stagingDirName)
+}
+
+// newStage 创建暂存目录
+// fromCurrent 为 true 时以当前线上版本为基础（硬链接复制，不包含.git）
+func (s *DeployServer) newStage(name string, fromCurrent bool) (string, error) {
+	if err := os.MkdirAll(s.stagingRoot(), 0755); err != nil {
+		return "", fmt.Errorf("创建暂存目录失败: %v", err)
+	}
+
+	stage := filepath.Join(s.stagingRoot(), fmt.Sprintf("%s-%d", name, time.Now().UnixNano()))
+	if err := os.Mkdir(stage, 0755); err != nil {
+		return "", fmt.Errorf("创建暂存目录失败: %v", err)
+	}
+
+	if fromCurrent {
+		livePath := filepath.Join(s.config().WebRoot, name)
+		if err := copyTree(livePath, stage); err != nil {
+			os.RemoveAll(stage)
+			return "", fmt.Errorf("复制当前版本失败: %v", err)
+		}
+	}
+
+	return stage, nil
+}
+
+// validateStage 校验暂存目录是一个可以上线的完整版本
+func validateStage(stage string) error {
+	hasFile := false
+	err := filepath.Walk(stage, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() {
+			hasFile = true
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("校验暂存目录失败: %v", err)
+	}
+	if !hasFile {
+		return fmt.Errorf("部署内容为空")
+	}
+	return validateRuleFiles(stage)
+}
+
+// activateStage 将暂存目录原子切换为线上版本
+// 切换在网站写锁内完成，静态文件处理器要么看到旧版本，要么看到新版本；
+// 任何一步失败都会恢复原有目录，旧版本保持不变
+func (s *DeployServer) activateStage(name, stage string) error {
+	livePath := filepath.Join(s.config().WebRoot, name)
+	oldPath := stage + ".old"
+	liveGit := filepath.Join(livePath, ".git")
+	stageGit := filepath.Join(stage, ".git")
+
+	lock := s.locks.get(name)
+	lock.serve.Lock()
+
+	// 尚未迁移的旧 .git 版本库随网站一起移交给新版本
+	hasGit := false
+	if _, err := os.Stat(liveGit); err == nil {
+		if err := os.Rename(liveGit, stageGit); err != nil {
+			lock.serve.Unlock()
+			return fmt.Errorf("移动版本库失败: %v", err)
+		}
+		hasGit = true
+	}
+
+	if err := os.Rename(livePath, oldPath); err != nil {
+		if hasGit {
+			os.Rename(stageGit, liveGit)
+		}
+		lock.serve.Unlock()
+		return fmt.Errorf("移出旧版本失败: %v", err)
+	}
+
+	if err := os.Rename(stage, livePath); err != nil {
+		os.Rename(oldPath, livePath)
+		if hasGit {
+			os.Rename(stageGit, liveGit)
+		}
+		lock.serve.Unlock()
+		return fmt.Errorf("切换新版本失败: %v", err)
+	}
+
+	lock.serve.Unlock()
+
+	// 旧版本已经下线，清理失败不影响部署
+	if err := os.RemoveAll(oldPath); err != nil {
+		fmt.Printf("清理旧版本失败: %v\n", err)
+	}
+
+	// 预先计算新版本文件的 ETag，内容未变的文件保持原有 ETag
+	go s.etags.warm(livePath)
+	return nil
+}
+
+// copyTree 复制目录树（跳过.git），优先使用硬链接
+// 暂存目录中的文件只会被删除或整体替换，不会原地修改，因此硬链接不会影响线上版本
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		target := filepath.Join(dst, relPath)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode().IsRegular():
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+			return copyFile(path, target)
+		default:
+			// 忽略符号链接等特殊文件
+			return nil
+		}
+	})
+}
+
+// copyFile 复制单个文件
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// DeployStats 部署前后的文件变化统计
+type DeployStats struct {
+	Added     int `json:"added"`     // 新增文件数
+	Replaced  int `json:"replaced"`  // 内容变化的文件数
+	Removed   int `json:"removed"`   // 被移除的文件数
+	Unchanged int `json:"unchanged"` // 内容未变化的文件数
+}
+
+// compareTrees 比较线上目录与暂存目录，统计新增、替换和移除的文件（忽略.git，precompress 为 true 时忽略生成的预压缩文件）
+func compareTrees(liveRoot, stageRoot string, precompress bool) (DeployStats, error) {
+	var stats DeployStats
+
+	liveFiles, err := listContentFiles(liveRoot, precompress)
+	if err != nil {
+		return stats, err
+	}
+	stageFiles, err := listContentFiles(stageRoot, precompress)
+	if err != nil {
+		return stats, err
+	}
+
+	for relPath, info := range stageFiles {
+		liveInfo, exists := liveFiles[relPath]
+		if !exists {
+			stats.Added++
+			continue
+		}
+		same, err := sameContent(filepath.Join(liveRoot, relPath), liveInfo, filepath.Join(stageRoot, relPath), info)
+		if err != nil {
+			return stats, err
+		}
+		if same {
+			stats.Unchanged++
+		} else {
+			stats.Replaced++
+		}
+	}
+
+	for relPath := range liveFiles {
+		if _, exists := stageFiles[relPath]; !exists {
+			stats.Removed++
+		}
+	}
+
+	return stats, nil
+}
+
+// listFiles 列出目录下的所有普通文件（相对路径 -> 文件信息），跳过.git
+func listFiles(root string) (map[string]os.FileInfo, error) {
+	files := make(map[string]os.FileInfo)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[relPath] = info
+		return nil
+	})
+	return files, err
+}
+
+// sameContent 判断两个文件内容是否相同
+func sameContent(pathA string, infoA os.FileInfo, pathB string, infoB os.FileInfo) (bool, error) {
+	if os.SameFile(infoA, infoB) {
+		return true, nil
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+
+	fileA, err := os.Open(pathA)
+	if err != nil {
+		return false, err
+	}
+	defer fileA.Close()
+
+	fileB, err := os.Open(pathB)
+	if err != nil {
+		return false, err
+	}
+	defer fileB.Close()
+
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, 32*1024)
+	for {
+		nA, errA := io.ReadFull(fileA, bufA)
+		nB, errB := io.ReadFull(fileB, bufB)
+		if !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// buildPackage 生成部署包（tar.gz）
+func buildPackage(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		content := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// uploadPackage 将部署包上传给部署处理器
+func uploadPackage(t *testing.T, handler http.Handler, site string, pkg []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", site)
+	part, err := mw.CreateFormFile("package", "site.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(pkg)
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// readTree 读取目录下全部文件的内容（相对路径 -> 内容）
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	contents := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contents[filepath.ToSlash(relPath)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+// assertTree 检查目录内容与期望完全一致
+func assertTree(t *testing.T, root string, want map[string]string) {
+	t.Helper()
+	got := readTree(t, root)
+	if len(got) != len(want) {
+		t.Errorf("site has files %v, want %v", got, want)
+		return
+	}
+	for relPath, content := range want {
+		if got[relPath] != content {
+			t.Errorf("%s = %q, want %q", relPath, got[relPath], content)
+		}
+	}
+}
+
+func TestFullDeployMirrorsPackage(t *testing.T) {
+	s := newTestServer(t, Config{Sites: map[string]Site{"demo": {Name: "demo", Owner: "admin"}}})
+	sitePath := filepath.Join(s.config().WebRoot, "demo")
+	writeTestFiles(t, sitePath, map[string]string{"index.html": "v1", "old.css": "old"})
+
+	v2 := map[string]string{"index.html": "v2", "assets/app.js": "app"}
+	w := uploadPackage(t, http.HandlerFunc(s.handleDeployFull), "demo", buildPackage(t, v2))
+	if w.Code != http.StatusOK {
+		t.Fatalf("deploy: %d %s", w.Code, w.Body.String())
+	}
+	var stats DeployStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if want := (DeployStats{Added: 1, Replaced: 1, Removed: 1}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+	assertTree(t, sitePath, v2)
+}
+
+func TestFailedDeployKeepsLiveSite(t *testing.T) {
+	valid := buildPackage(t, map[string]string{"index.html": "v2", "app.js": "console.log(2)"})
+	tests := []struct {
+		name string
+		pkg  []byte
+		full bool // 只对全量部署无效
+		want int
+	}{
+		{"truncated archive", valid[:len(valid)/2], false, http.StatusInternalServerError},
+		{"not an archive", []byte("not a tar.gz"), false, http.StatusInternalServerError},
+		{"empty package", buildPackage(t, map[string]string{}), true, http.StatusBadRequest},
+		{"invalid _redirects", buildPackage(t, map[string]string{"index.html": "v2", "_redirects": "/a"}), false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, Config{Sites: map[string]Site{"demo": {Name: "demo", Owner: "admin"}}})
+			sitePath := filepath.Join(s.config().WebRoot, "demo")
+			live := map[string]string{"index.html": "v1", "app.js": "console.log(1)"}
+			writeTestFiles(t, sitePath, live)
+
+			handlers := map[string]http.HandlerFunc{"full": s.handleDeployFull}
+			if !tt.full {
+				handlers["incremental"] = s.handleDeployIncremental
+			}
+			for mode, handler := range handlers {
+				w := uploadPackage(t, handler, "demo", tt.pkg)
+				if w.Code != tt.want {
+					t.Errorf("%s: got %d, want %d (%s)", mode, w.Code, tt.want, w.Body.String())
+				}
+				assertTree(t, sitePath, live)
+			}
+
+			// 暂存目录已清理
+			entries, _ := os.ReadDir(s.stagingRoot())
+			if len(entries) != 0 {
+				t.Errorf("staging directory has leftovers: %v", entries)
+			}
+		})
+	}
+}
+
+func TestActivateStageRestoresLiveSiteOnFailure(t *testing.T) {
+	s := newTestServer(t, Config{Sites: map[string]Site{"demo": {Name: "demo"}}})
+	sitePath := filepath.Join(s.config().WebRoot, "demo")
+	live := map[string]string{"index.html": "v1"}
+	writeTestFiles(t, sitePath, live)
+
+	// 暂存目录不存在时切换失败，线上目录恢复原样
+	missing := filepath.Join(s.stagingRoot(), "missing")
+	if err := s.activateStage("demo", missing); err == nil {
+		t.Fatal("activateStage succeeded without a stage directory")
+	}
+	assertTree(t, sitePath, live)
+	if _, err := os.Stat(missing + ".old"); !os.IsNotExist(err) {
+		t.Error("the previous version was left in the .old directory")
+	}
+}
+
+func TestRollbackRestoresPreviousVersion(t *testing.T) {
+	s := newTestServer(t, Config{EnableVersioning: true, Sites: map[string]Site{"demo": {Name: "demo", Owner: "admin"}}})
+	sitePath := filepath.Join(s.config().WebRoot, "demo")
+	writeTestFiles(t, sitePath, map[string]string{"index.html": "v0", "app.js": "a0"})
+	if err := s.commitChanges("demo", "v0", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	v1 := map[string]string{"index.html": "v1", "app.js": "a1"}
+	v2 := map[string]string{"index.html": "v2", "app.js": "a2"}
+	for _, files := range []map[string]string{v1, v2} {
+		if w := uploadPackage(t, http.HandlerFunc(s.handleDeployFull), "demo", buildPackage(t, files)); w.Code != http.StatusOK {
+			t.Fatalf("deploy: %d %s", w.Code, w.Body.String())
+		}
+	}
+	assertTree(t, sitePath, v2)
+
+	if err := s.rollbackVersion("demo", "HEAD~1", "回滚", "admin"); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	assertTree(t, sitePath, v1)
+
+	// 回滚到不存在的版本时线上内容不变
+	if err := s.rollbackVersion("demo", "deadbeef", "回滚", "admin"); err == nil {
+		t.Error("rollback to an unknown version succeeded")
+	}
+	assertTree(t, sitePath, v1)
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// configReloadInterval 检查配置文件是否变化的间隔
+const configReloadInterval = 2 * time.Second
+
+// ConfigLoader 从配置文件加载配置
+type ConfigLoader func(path string) (Config, error)
+
+// WatchConfig 启动后监视配置文件变化，收到 SIGHUP 信号时也会重新加载，需在 Start 之前调用
+// 新配置校验通过后整体替换用户、网站、部署模式和域名设置，正在处理的请求和连接不受影响；
+// 校验失败时记录错误并继续使用当前配置
+func (s *DeployServer) WatchConfig(load ConfigLoader) {
+	s.configLoader = load
+}
+
+// watchConfig 定期检查配置文件的修改时间和大小，并响应 SIGHUP 信号
+func (s *DeployServer) watchConfig() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+
+	stamp := configFileStamp(s.configPath)
+	for {
+		select {
+		case <-hup:
+			fmt.Println("收到 SIGHUP 信号，重新加载配置")
+			stamp = configFileStamp(s.configPath)
+			s.reloadConfig(true)
+		case <-ticker.C:
+			current := configFileStamp(s.configPath)
+			if current == stamp {
+				continue
+			}
+			stamp = current
+			s.reloadConfig(false)
+		}
+	}
+}
+
+// configFileStamp 返回配置文件的修改时间和大小，文件不存在时为空
+func configFileStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// reloadConfig 重新加载配置文件，force 为 false 时忽略服务器自己保存的配置
+func (s *DeployServer) reloadConfig(force bool) {
+	loadedHash := s.getConfigHash()
+	data, err := os.ReadFile(s.configPath)
+	if err != nil {
+		fmt.Printf("读取配置文件失败，继续使用当前配置: %v\n", err)
+		return
+	}
+	if !force && configContentHash(data) == loadedHash {
+		return
+	}
+
+	cfg, err := s.configLoader(s.configPath)
+	if err != nil {
+		fmt.Printf("加载配置失败，继续使用当前配置: %v\n", err)
+		return
+	}
+
+	// 校验和密码哈希（bcrypt 较慢）在加锁前完成，只在替换配置时持有 s.mu
+	migrated, err := s.prepareConfig(&cfg)
+	if err != nil {
+		fmt.Printf("配置校验失败，继续使用当前配置: %v\n", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 校验期间服务器保存过配置（如新建网站），以服务器保存的配置为准，放弃本次加载
+	if s.getConfigHash() != loadedHash {
+		fmt.Println("配置在加载期间已被服务器更新，忽略本次加载")
+		return
+	}
+
+	s.conf.Store(&cfg)
+	s.setConfigHash(data)
+	s.reloadSitesFromConfig()
+	if s.router != nil {
+		s.router = s.newStaticRouter(s.router.resolver)
+	}
+
+	// 配置中新写入的明文密码已转为哈希，写回配置文件
+	if migrated > 0 {
+		if err := s.saveConfig(); err != nil {
+			fmt.Printf("保存迁移后的密码失败: %v\n", err)
+		} else {
+			fmt.Printf("已将 %d 个用户的明文密码迁移为哈希存储\n", migrated)
+		}
+	}
+
+	fmt.Printf("配置已重新加载: 部署模式 %s, 网站 %d 个, 用户 %d 个\n", cfg.Mode, len(cfg.Sites), len(cfg.Users))
+}
+
+// prepareConfig 校验新配置并补全需要沿用的设置（只读取当前配置，不需要持有 s.mu），返回迁移的明文密码数
+// web_root、port、tls 需要重启服务器才能生效，热加载时保持原值
+func (s *DeployServer) prepareConfig(cfg *Config) (int, error) {
+	if cfg.Sites == nil {
+		cfg.Sites = make(map[string]Site)
+	}
+	if cfg.Users == nil {
+		cfg.Users = make(map[string]User)
+	}
+
+	if filepath.Clean(cfg.WebRoot) != filepath.Clean(s.config().WebRoot) {
+		fmt.Println("web_root 修改后需要重启服务器才能生效")
+	}
+	cfg.WebRoot = s.config().WebRoot
+	if cfg.Port != s.config().Port {
+		fmt.Println("port 修改后需要重启服务器才能生效")
+	}
+	cfg.Port = s.config().Port
+	if !reflect.DeepEqual(cfg.TLS, s.config().TLS) {
+		fmt.Println("tls 修改后需要重启服务器才能生效")
+	}
+	cfg.TLS = s.config().TLS
+
+	// 未配置签名密钥时沿用当前密钥，避免已签发的令牌失效
+	if cfg.TokenSecret == "" {
+		cfg.TokenSecret = s.config().TokenSecret
+	}
+
+	switch cfg.Mode {
+	case "subdomain", "hybrid":
+		if cfg.BaseDomain == "" {
+			return 0, fmt.Errorf("%s 模式需要配置 base_domain", cfg.Mode)
+		}
+	case "", "path":
+	default:
+		return 0, fmt.Errorf("无效的部署模式: %s（可选 subdomain、path、hybrid）", cfg.Mode)
+	}
+	if cfg.PreviewTTLHours < 0 {
+		return 0, fmt.Errorf("preview_ttl_hours 不能为负数")
+	}
+	if cfg.Retention != nil {
+		if err := cfg.Retention.validate(); err != nil {
+			return 0, fmt.Errorf("全局版本保留策略: %v", err)
+		}
+	}
+
+	migrated, err := prepareUsers(cfg.Users)
+	if err != nil {
+		return 0, err
+	}
+
+	names := make([]string, 0, len(cfg.Sites))
+	for name := range cfg.Sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		site := cfg.Sites[name]
+		if err := validateSiteConfig(name, &site); err != nil {
+			return 0, fmt.Errorf("网站 %s: %v", name, err)
+		}
+		cfg.Sites[name] = site
+	}
+	for _, name := range names {
+		if err := checkConfigDomainConflicts(cfg, name, cfg.Sites[name].Domains); err != nil {
+			return 0, fmt.Errorf("网站 %s: %v", name, err)
+		}
+	}
+	return migrated, nil
+}
+
+// prepareUsers 校验用户配置并将明文密码转为哈希，返回迁移的密码数
+// 与启动时一致，未配置任何用户时不做要求；配置了用户时至少需要一个管理员
+func prepareUsers(users map[string]User) (int, error) {
+	hasAdmin := false
+	migrated := 0
+	for name, user := range users {
+		if strings.TrimSpace(name) == "" {
+			return 0, fmt.Errorf("用户名不能为空")
+		}
+		if user.IsAdmin {
+			hasAdmin = true
+		}
+		if user.Password == "" || isPasswordHash(user.Password) {
+			continue
+		}
+
+		hash, err := HashPassword(user.Password)
+		if err != nil {
+			return 0, fmt.Errorf("迁移用户 %s 的密码失败: %v", name, err)
+		}
+		if user.Password == defaultAdminPassword {
+			user.MustChangePassword = true
+		}
+		user.Password = hash
+		users[name] = user
+		migrated++
+	}
+	if len(users) > 0 && !hasAdmin {
+		return 0, fmt.Errorf("至少需要一个管理员用户")
+	}
+	return migrated, nil
+}
+
+// validateSiteConfig 校验单个网站的配置，并规范化自定义域名和响应头规则
+func validateSiteConfig(name string, site *Site) error {
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_') {
+			return fmt.Errorf("网站名称格式不正确")
+		}
+	}
+	if name == "" || strings.Contains(name, previewHostSeparator) {
+		return fmt.Errorf("网站名称格式不正确")
+	}
+
+	domains, err := normalizeDomains(site.Domains)
+	if err != nil {
+		return err
+	}
+	site.Domains = domains
+
+	if err := validateNotFoundMode(site.NotFound); err != nil {
+		return err
+	}
+	if err := validatePathRewrite(site.PathRewrite); err != nil {
+		return err
+	}
+	if err := validateRouting(site.Routing); err != nil {
+		return err
+	}
+	if err := validateHeaderRules(site.Headers); err != nil {
+		return err
+	}
+	if site.Retention != nil {
+		if err := site.Retention.validate(); err != nil {
+			return err
+		}
+	}
+	if site.Access != nil {
+		switch site.Access.Mode {
+		case "", accessPublic, accessPassword, accessLink, accessUsers:
+		default:
+			return fmt.Errorf("不支持的访问策略: %s", site.Access.Mode)
+		}
+	}
+	return nil
+}
+
+// configContentHash 计算配置文件内容的哈希
+func configContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// setConfigHash 记录最近一次加载或保存的配置文件内容
+func (s *DeployServer) setConfigHash(data []byte) {
+	s.configHashMu.Lock()
+	s.configHash = configContentHash(data)
+	s.configHashMu.Unlock()
+}
+
+// setConfigHashFromFile 记录配置文件当前的内容（启动时使用）
+func (s *DeployServer) setConfigHashFromFile() {
+	if data, err := os.ReadFile(s.configPath); err == nil {
+		s.setConfigHash(data)
+	}
+}
+
+// getConfigHash 返回最近一次加载或保存的配置文件内容哈希
+func (s *DeployServer) getConfigHash() string {
+	s.configHashMu.Lock()
+	defer s.configHashMu.Unlock()
+	return s.configHash
+}
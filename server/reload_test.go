@@ -0,0 +1,261 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeTestConfig 修改当前配置后写入配置文件（模拟手动编辑配置文件）
+func writeTestConfig(t *testing.T, s *DeployServer, edit func(cfg *Config)) {
+	t.Helper()
+	cfg, err := loadTestConfig(s.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(&cfg)
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.configPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfigAppliesChanges(t *testing.T) {
+	s := newTestServer(t, Config{Sites: map[string]Site{"demo": {Name: "demo"}}})
+	s.WatchConfig(loadTestConfig)
+	s.newHandler()
+
+	writeTestConfig(t, s, func(cfg *Config) {
+		cfg.Mode = "hybrid"
+		cfg.BaseDomain = "example.test"
+		cfg.WebRoot = "/somewhere/else"
+		cfg.Sites["blog"] = Site{Name: "blog", Domains: []string{"Blog.Example.COM"}}
+		cfg.Users["alice"] = User{Name: "alice", Password: "alice-secret"}
+	})
+	s.reloadConfig(false)
+
+	cfg := s.config()
+	if cfg.Mode != "hybrid" || cfg.BaseDomain != "example.test" {
+		t.Errorf("mode = %q base_domain = %q, want hybrid example.test", cfg.Mode, cfg.BaseDomain)
+	}
+	if cfg.WebRoot == "/somewhere/else" {
+		t.Error("web_root was changed by a reload")
+	}
+	if got := cfg.Sites["blog"].Domains; len(got) != 1 || got[0] != "blog.example.com" {
+		t.Errorf("blog domains = %v, want normalized [blog.example.com]", got)
+	}
+	if s.sites["blog"] == nil {
+		t.Error("blog was not loaded into the site list")
+	}
+	if _, ok := s.currentRouter().handler.(*HybridModeHandler); !ok {
+		t.Errorf("router = %T, want *HybridModeHandler", s.currentRouter().handler)
+	}
+
+	// 新用户的明文密码已转为哈希并写回配置文件
+	if _, err := s.authenticate("alice", "alice-secret"); err != nil {
+		t.Errorf("authenticate(alice) = %v", err)
+	}
+	saved, err := loadTestConfig(s.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isPasswordHash(saved.Users["alice"].Password) {
+		t.Error("alice's password was not saved as a hash")
+	}
+}
+
+func TestReloadConfigKeepsCurrentOnInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(cfg *Config)
+	}{
+		{"invalid mode", func(cfg *Config) { cfg.Mode = "cluster" }},
+		{"subdomain without base domain", func(cfg *Config) { cfg.Mode = "subdomain"; cfg.BaseDomain = "" }},
+		{"no admin", func(cfg *Config) { cfg.Users = map[string]User{"bob": {Name: "bob", Password: "bob-secret"}} }},
+		{"bad site name", func(cfg *Config) { cfg.Sites["Bad Name"] = Site{Name: "Bad Name"} }},
+		{"domain conflict", func(cfg *Config) {
+			cfg.Sites["demo"] = Site{Name: "demo", Domains: []string{"www.example.com"}}
+			cfg.Sites["blog"] = Site{Name: "blog", Domains: []string{"www.example.com"}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, Config{Sites: map[string]Site{"demo": {Name: "demo"}}})
+			s.WatchConfig(loadTestConfig)
+			before := s.config()
+
+			writeTestConfig(t, s, tt.edit)
+			s.reloadConfig(false)
+
+			if s.config() != before {
+				t.Error("an invalid config replaced the current config")
+			}
+		})
+	}
+
+	// 无法解析的配置文件
+	s := newTestServer(t, Config{})
+	s.WatchConfig(loadTestConfig)
+	before := s.config()
+	if err := os.WriteFile(s.configPath, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.reloadConfig(false)
+	if s.config() != before {
+		t.Error("a malformed config file replaced the current config")
+	}
+}
+
+func TestReloadConfigAllowsNoUsers(t *testing.T) {
+	// 启动时允许不配置用户，热加载时保持一致
+	s := newTestServer(t, Config{})
+	s.WatchConfig(loadTestConfig)
+
+	writeTestConfig(t, s, func(cfg *Config) {
+		cfg.Users = map[string]User{}
+		cfg.BaseDomain = "example.test"
+	})
+	s.reloadConfig(false)
+
+	if got := s.config().BaseDomain; got != "example.test" {
+		t.Errorf("base_domain = %q, want example.test: a config without users was rejected", got)
+	}
+}
+
+func TestReloadConfigIgnoresOwnWrites(t *testing.T) {
+	s := newTestServer(t, Config{})
+	loads := 0
+	s.WatchConfig(func(path string) (Config, error) {
+		loads++
+		return loadTestConfig(path)
+	})
+
+	s.mu.Lock()
+	s.config().Sites["demo"] = Site{Name: "demo"}
+	err := s.saveConfig()
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 保存时先写临时文件再重命名，不留下临时文件
+	if matches, _ := filepath.Glob(s.configPath + ".*"); len(matches) != 0 {
+		t.Errorf("saveConfig left temporary files: %v", matches)
+	}
+
+	s.reloadConfig(false)
+	if loads != 0 {
+		t.Errorf("the server's own write was reloaded %d times", loads)
+	}
+
+	// SIGHUP 强制重新加载
+	s.reloadConfig(true)
+	if loads != 1 {
+		t.Errorf("forced reload loaded the config %d times, want 1", loads)
+	}
+}
+
+func TestReloadConfigConcurrentRequests(t *testing.T) {
+	hash, err := HashPassword("site-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, Config{
+		APIKey: "legacy-key",
+		Sites: map[string]Site{
+			"demo":   {Name: "demo", Owner: "admin"},
+			"secret": {Name: "secret", Owner: "admin", Access: &SiteAccess{Mode: accessPassword, Password: hash}},
+		},
+	})
+	s.WatchConfig(loadTestConfig)
+	for _, site := range []string{"demo", "secret"} {
+		writeTestFiles(t, filepath.Join(s.config().WebRoot, site), map[string]string{"index.html": "<h1>" + site + "</h1>"})
+	}
+	handler := s.newHandler()
+
+	// 登录获取访问令牌
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username":"admin","password":"admin-secret"}`)))
+	var tokens TokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("login failed: %d %v", w.Code, err)
+	}
+
+	requests := []func() *http.Request{
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/api/sites/list", nil)
+			r.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			return r
+		},
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/api/users/list", nil)
+			r.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			return r
+		},
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/api/sites/versions?name=demo", nil)
+			r.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+			return r
+		},
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"invalid"}`))
+			return r
+		},
+		func() *http.Request { return httptest.NewRequest(http.MethodGet, "/demo/", nil) },
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/secret/", nil)
+			r.SetBasicAuth("", "site-secret")
+			return r
+		},
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = "demo.example.test"
+			return r
+		},
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for _, newRequest := range requests {
+		wg.Add(1)
+		go func(newRequest func() *http.Request) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				handler.ServeHTTP(httptest.NewRecorder(), newRequest())
+			}
+		}(newRequest)
+	}
+
+	for i := 0; i < 20; i++ {
+		writeTestConfig(t, s, func(cfg *Config) {
+			if i%2 == 0 {
+				cfg.Mode, cfg.BaseDomain = "hybrid", "example.test"
+			} else {
+				cfg.Mode, cfg.BaseDomain = "path", ""
+			}
+			cfg.EnableVersioning = i%2 == 0
+			cfg.Sites[fmt.Sprintf("site%d", i)] = Site{Name: fmt.Sprintf("site%d", i)}
+		})
+		s.reloadConfig(true)
+	}
+	close(stop)
+	wg.Wait()
+
+	if s.config().Mode != "path" || len(s.config().Sites) != 22 {
+		t.Errorf("after reloads mode = %q with %d sites, want path with 22", s.config().Mode, len(s.config().Sites))
+	}
+}
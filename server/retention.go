@@ -0,0 +1,208 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// retentionInterval 定期清理过期版本并回收内容对象的间隔
+const retentionInterval = 6 * time.Hour
+
+// RetentionPolicy 版本保留策略，满足任一条件的版本都会保留，当前版本和带标签的版本始终保留
+// 两项都为 0 表示保留全部版本（可用于让个别网站不受全局策略限制）
+type RetentionPolicy struct {
+	KeepLast int `json:"keep_last,omitempty"` // 保留最近 N 个版本
+	KeepDays int `json:"keep_days,omitempty"` // 保留最近 N 天内的全部版本
+}
+
+// SitePruneResult 单个网站的版本清理结果
+type SitePruneResult struct {
+	Name    string           `json:"name"`
+	Policy  *RetentionPolicy `json:"policy"`
+	Pruned  int              `json:"pruned"` // 删除的版本数
+	Kept    int              `json:"kept"`   // 保留的版本数
+	Error   string           `json:"error,omitempty"`
+	Removed []string         `json:"removed,omitempty"` // 删除的版本哈希
+}
+
+// PruneReport 版本清理报告
+type PruneReport struct {
+	Sites  []SitePruneResult `json:"sites"`
+	Pruned int               `json:"pruned"` // 删除的版本总数
+	GC     GCStats           `json:"gc"`     // 内容对象回收结果
+}
+
+// unlimited 判断策略是否保留全部版本
+func (p *RetentionPolicy) unlimited() bool {
+	return p == nil || (p.KeepLast <= 0 && p.KeepDays <= 0)
+}
+
+// validate 校验保留策略
+func (p *RetentionPolicy) validate() error {
+	if p.KeepLast < 0 || p.KeepDays < 0 {
+		return fmt.Errorf("保留版本数和保留天数不能为负数")
+	}
+	return nil
+}
+
+// keeps 判断版本是否需要保留，index 为从最新版本开始的序号
+func (p *RetentionPolicy) keeps(index int, v Version, now time.Time) bool {
+	if p.unlimited() {
+		return true
+	}
+	if p.KeepLast > 0 && index < p.KeepLast {
+		return true
+	}
+	if p.KeepDays > 0 && v.Date.After(now.AddDate(0, 0, -p.KeepDays)) {
+		return true
+	}
+	return false
+}
+
+// retentionPolicy 获取网站生效的保留策略：网站单独设置的策略优先，否则使用全局策略
+// 调用方需持有 s.mu
+func (s *DeployServer) retentionPolicy(siteName string) *RetentionPolicy {
+	if site, exists := s.config().Sites[siteName]; exists && site.Retention != nil {
+		return site.Retention
+	}
+	return s.config().Retention
+}
+
+// pruneVersions 按保留策略清理网站的旧版本（siteName 为空表示全部网站），然后回收内容对象
+func (s *DeployServer) pruneVersions(siteName string) (*PruneReport, error) {
+	report := &PruneReport{Sites: []SitePruneResult{}}
+	if !s.config().EnableVersioning {
+		return report, nil
+	}
+
+	s.mu.RLock()
+	policies := make(map[string]*RetentionPolicy)
+	for name := range s.config().Sites {
+		if siteName == "" || name == siteName {
+			policies[name] = s.retentionPolicy(name)
+		}
+	}
+	s.mu.RUnlock()
+
+	if siteName != "" && len(policies) == 0 {
+		return nil, fmt.Errorf("网站不存在")
+	}
+
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	for _, name := range names {
+		policy := policies[name]
+		if policy.unlimited() {
+			continue
+		}
+		result := SitePruneResult{Name: name, Policy: policy}
+
+		// 与部署、回滚互斥，避免删除正在使用的版本
+		lock := s.locks.get(name)
+		lock.deploy.Lock()
+		pruned, kept, err := s.versions.Prune(name, func(index int, v Version) bool {
+			return policy.keeps(index, v, now)
+		})
+		lock.deploy.Unlock()
+
+		if err != nil {
+			result.Error = err.Error()
+			fmt.Printf("清理网站 %s 的旧版本失败: %v\n", name, err)
+		}
+		result.Kept = kept
+		result.Pruned = len(pruned)
+		for _, version := range pruned {
+			result.Removed = append(result.Removed, version.Hash)
+		}
+		report.Pruned += result.Pruned
+		report.Sites = append(report.Sites, result)
+	}
+
+	stats, err := s.versions.GC(versionGCGrace)
+	if err != nil {
+		return report, fmt.Errorf("回收版本内容对象失败: %v", err)
+	}
+	report.GC = stats
+	return report, nil
+}
+
+// enforceRetention 定期按保留策略清理旧版本并回收内容对象
+func (s *DeployServer) enforceRetention() {
+	for {
+		time.Sleep(retentionInterval)
+
+		report, err := s.pruneVersions("")
+		if err != nil {
+			fmt.Printf("版本清理失败: %v\n", err)
+			continue
+		}
+		if report.Pruned > 0 || report.GC.RemovedObjects > 0 {
+			fmt.Printf("版本清理完成: 删除 %d 个版本，回收 %d 个内容对象，释放 %d 字节\n",
+				report.Pruned, report.GC.RemovedObjects, report.GC.FreedBytes)
+		}
+	}
+}
+
+// handlePruneVersions 立即按保留策略清理旧版本（管理员）
+func (s *DeployServer) handlePruneVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"` // 为空表示全部网站
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, "无效的请求", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !s.config().EnableVersioning {
+		s.respondError(w, "版本控制未启用", http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.pruneVersions(strings.TrimSpace(req.Name))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if report == nil {
+			status = http.StatusNotFound
+		}
+		s.respondError(w, err.Error(), status)
+		return
+	}
+
+	s.respondJSON(w, report)
+}
+
+// retentionRequest 更新网站保留策略的请求
+type retentionRequest struct {
+	KeepLast int  `json:"keep_last"`
+	KeepDays int  `json:"keep_days"`
+	Inherit  bool `json:"inherit"` // 删除网站单独的策略，改用全局策略
+}
+
+// buildRetention 根据请求生成网站的保留策略，返回 nil 表示使用全局策略
+// 网站单独设置的策略两项都为 0 时表示该网站保留全部版本
+func buildRetention(req *retentionRequest) (*RetentionPolicy, error) {
+	if req.Inherit {
+		return nil, nil
+	}
+	policy := &RetentionPolicy{KeepLast: req.KeepLast, KeepDays: req.KeepDays}
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
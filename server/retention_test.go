@@ -0,0 +1,105 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyKeeps(t *testing.T) {
+	now := time.Now()
+	recent := Version{Date: now.Add(-time.Hour)}
+	old := Version{Date: now.AddDate(0, 0, -10)}
+	tests := []struct {
+		policy *RetentionPolicy
+		index  int
+		v      Version
+		want   bool
+	}{
+		{nil, 100, old, true},
+		{&RetentionPolicy{}, 100, old, true},
+		{&RetentionPolicy{KeepLast: 3}, 2, old, true},
+		{&RetentionPolicy{KeepLast: 3}, 3, recent, false},
+		{&RetentionPolicy{KeepDays: 7}, 50, recent, true},
+		{&RetentionPolicy{KeepDays: 7}, 1, old, false},
+		{&RetentionPolicy{KeepLast: 3, KeepDays: 7}, 50, recent, true},
+		{&RetentionPolicy{KeepLast: 3, KeepDays: 7}, 1, old, true},
+		{&RetentionPolicy{KeepLast: 3, KeepDays: 7}, 5, old, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.keeps(tt.index, tt.v, now); got != tt.want {
+			t.Errorf("%+v.keeps(%d, %s) = %v, want %v", tt.policy, tt.index, tt.v.Date.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
+
+func TestPruneVersionsKeepsCurrentAndTagged(t *testing.T) {
+	s := newTestServer(t, Config{
+		EnableVersioning: true,
+		Retention:        &RetentionPolicy{KeepLast: 2},
+		Sites: map[string]Site{
+			"demo":  {Name: "demo"},
+			"other": {Name: "other", Retention: &RetentionPolicy{}},
+		},
+	})
+	st := s.versions.(*snapshotStore)
+
+	// demo 和 other 各提交 5 个版本，内容各不相同
+	commit := func(site, content string) *Version {
+		t.Helper()
+		dir := filepath.Join(s.config().WebRoot, site)
+		writeTestFiles(t, dir, map[string]string{"index.html": content})
+		version, err := st.Commit(site, dir, content, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return version
+	}
+	var demo []*Version
+	for _, content := range []string{"v1", "v2", "v3", "v4", "v5"} {
+		demo = append(demo, commit("demo", "demo "+content))
+		commit("other", "other "+content)
+	}
+	if err := st.Tag("demo", "release", demo[0].Hash); err != nil {
+		t.Fatal(err)
+	}
+	ageObjects(t, st, 2*versionGCGrace)
+
+	report, err := s.pruneVersions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Pruned != 2 || len(report.Sites) != 1 || report.Sites[0].Name != "demo" || report.Sites[0].Kept != 3 {
+		t.Fatalf("report = %+v, want demo pruned to 3 versions and other unlimited", report)
+	}
+
+	versions, total, err := st.List("demo", versionQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(versions) != 3 || versions[0].Hash != demo[4].Hash || versions[1].Hash != demo[3].Hash || versions[2].Hash != demo[0].Hash {
+		t.Errorf("demo versions = %+v, want v5, v4 and the tagged v1", versions)
+	}
+	if _, total, _ := st.List("other", versionQuery{Limit: 10}); total != 5 {
+		t.Errorf("other has %d versions, want all 5 kept by its own policy", total)
+	}
+
+	// 被删除版本独占的对象已回收，保留版本的内容仍可检出
+	if report.GC.RemovedObjects != 2 {
+		t.Errorf("GC removed %d objects, want 2", report.GC.RemovedObjects)
+	}
+	for _, version := range []*Version{demo[0], demo[3], demo[4]} {
+		dest := filepath.Join(t.TempDir(), "checkout")
+		if err := st.Checkout("demo", version.Hash, dest); err != nil {
+			t.Fatalf("checkout %s: %v", version.Message, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dest, "index.html"))
+		if err != nil || string(data) != version.Message {
+			t.Errorf("checkout %s: got %q, %v", version.Message, data, err)
+		}
+	}
+	if _, err := st.Resolve("demo", demo[1].Hash); err == nil {
+		t.Error("a pruned version can still be resolved")
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ruleFileCache 缓存各网站目录中解析后的规则文件（_headers、_redirects），文件变化时重新解析
+type ruleFileCache struct {
+	name    string                                 // 规则文件名
+	parse   func(data []byte) (interface{}, error) // 解析函数
+	mu      sync.Mutex
+	entries map[string]ruleFileEntry
+}
+
+// ruleFileEntry 规则文件缓存条目
+type ruleFileEntry struct {
+	size    int64
+	modTime time.Time
+	rules   interface{}
+}
+
+// newRuleFileCache 创建规则文件缓存
+func newRuleFileCache(name string, parse func(data []byte) (interface{}, error)) *ruleFileCache {
+	return &ruleFileCache{name: name, parse: parse, entries: make(map[string]ruleFileEntry)}
+}
+
+// load 返回网站目录中规则文件解析后的规则，文件不存在或无效时返回 nil
+func (c *ruleFileCache) load(sitePath string) interface{} {
+	filePath := filepath.Join(sitePath, c.name)
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+
+	c.mu.Lock()
+	entry, exists := c.entries[sitePath]
+	c.mu.Unlock()
+	if exists && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.rules
+	}
+
+	var rules interface{}
+	data, err := os.ReadFile(filePath)
+	if err == nil {
+		rules, err = c.parse(data)
+	}
+	if err != nil {
+		// 部署时已经校验过，这里只可能是旧版本遗留的文件
+		log.Printf("[ERROR] Ignoring invalid %s: %v", filePath, err)
+		rules = nil
+	}
+
+	c.mu.Lock()
+	c.entries[sitePath] = ruleFileEntry{size: info.Size(), modTime: info.ModTime(), rules: rules}
+	c.mu.Unlock()
+	return rules
+}
+
+// loadVersion 返回历史版本中规则文件解析后的规则，文件不存在或无效时返回 nil
+// 版本内容不会变化，按内容对象缓存
+func (c *ruleFileCache) loadVersion(store VersionStore, site string, files map[string]VersionFile) interface{} {
+	file, exists := files[c.name]
+	if !exists {
+		return nil
+	}
+
+	key := versionPathPrefix + file.Object
+	c.mu.Lock()
+	entry, exists := c.entries[key]
+	c.mu.Unlock()
+	if exists {
+		return entry.rules
+	}
+
+	data, err := readVersionObject(store, site, file)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read %s of site %s: %v", c.name, site, err)
+		return nil
+	}
+	rules, err := c.parse(data)
+	if err != nil {
+		log.Printf("[ERROR] Ignoring invalid %s in a version of site %s: %v", c.name, site, err)
+		rules = nil
+	}
+
+	c.mu.Lock()
+	c.entries[key] = ruleFileEntry{size: file.Size, rules: rules}
+	c.mu.Unlock()
+	return rules
+}
+
+// validateRuleFiles 校验部署内容中的规则文件（不存在时忽略）
+func validateRuleFiles(dir string) error {
+	if err := validateRuleFile(dir, headersFileName, func(data []byte) error {
+		_, err := parseHeadersFile(data)
+		return err
+	}); err != nil {
+		return err
+	}
+	return validateRuleFile(dir, redirectsFileName, func(data []byte) error {
+		_, err := parseRedirectsFile(data)
+		return err
+	})
+}
+
+// validateRuleFile 校验单个规则文件
+func validateRuleFile(dir, name string, validate func(data []byte) error) error {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := validate(data); err != nil {
+		return fmt.Errorf("%s 文件无效: %v", name, err)
+	}
+	return nil
+}
+
+// isRuleFile 判断网站中的相对路径是否为规则文件（规则文件不对外提供）
+func isRuleFile(relPath string) bool {
+	return relPath == headersFileName || relPath == redirectsFileName
+}
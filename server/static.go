@@ -1,8 +1,10 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -16,6 +18,17 @@ type StaticFileHandler struct {
 	mode     string
 	baseDomain string
 	singleDomain string
+	locks    *siteLocks // 与部署共享的网站锁，保证只读取完整版本
+	domains  *domainIndex // 自定义域名索引
+	previews *previewStore // 预览部署索引
+	versions VersionStore // 网站版本存储，用于访问历史版本
+	compression *compressionCache // 实时压缩结果缓存
+	etags *etagCache // 文件内容哈希 ETag 缓存
+	headerFiles *ruleFileCache // 网站目录中的 _headers 规则缓存
+	redirectFiles *ruleFileCache // 网站目录中的 _redirects 规则缓存
+	siteSettings func(siteName string) siteServeConfig // 网站设置（响应头规则、404 处理方式）
+	allowProxy func(host string) bool // 重写规则是否允许代理到指定主机
+	authorize func(w http.ResponseWriter, r *http.Request, siteName string) bool // 网站访问策略检查，未通过时已写入响应
 }
 
 // NewStaticFileHandler 创建静态文件处理器
@@ -25,6 +38,10 @@ func NewStaticFileHandler(webRoot, mode, baseDomain, singleDomain string) *Stati
 		mode:     mode,
 		baseDomain: baseDomain,
 		singleDomain: singleDomain,
+		compression: newCompressionCache(compressionCacheSize),
+		etags: newETagCache(),
+		headerFiles: newRuleFileCache(headersFileName, func(data []byte) (interface{}, error) { return parseHeadersFile(data) }),
+		redirectFiles: newRuleFileCache(redirectsFileName, func(data []byte) (interface{}, error) { return parseRedirectsFile(data) }),
 	}
 }
 
@@ -38,105 +55,377 @@ func (h *StaticFileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 构建网站路径
-	sitePath := filepath.Join(h.webRoot, siteName)
+	// 预览地址：label--site.base_domain，标签为版本哈希时是历史版本地址 hash--site.base_domain
+	if label, site, ok := splitPreviewHost(siteName); ok {
+		if !h.servesRouting(site) {
+			http.Error(w, errWebsiteNotFound.message, errWebsiteNotFound.status)
+			return
+		}
+		if isVersionRef(label) && validatePreviewTarget(site, label) == nil {
+			if _, exists := h.previews.get(site, label); !exists {
+				h.serveVersion(w, r, site, label, r.URL.Path)
+				return
+			}
+		}
+		h.servePreview(w, r, site, label, r.URL.Path)
+		return
+	}
 
-	// 检查网站是否存在
-	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
-		log.Printf("[ERROR] Site directory not found: %s", sitePath)
-		http.Error(w, "Website not found", http.StatusNotFound)
+	// 混合模式下网站可能限制为只能按路径访问（自定义域名不受限制）
+	if _, custom := h.domains.lookup(r.Host); !custom && !h.servesRouting(siteName) {
+		http.Error(w, errWebsiteNotFound.message, errWebsiteNotFound.status)
 		return
 	}
 
-	// 处理请求路径
-	requestPath := r.URL.Path
+	// 历史版本地址：/@hash/path
+	if ref, rest, ok := splitVersionPath(r.URL.Path); ok {
+		h.serveVersion(w, r, siteName, ref, rest)
+		return
+	}
+
+	h.serveSite(w, r, siteName, r.URL.Path)
+}
+
+// serveError 静态文件解析错误
+type serveError struct {
+	status  int
+	message string
+}
+
+func (e *serveError) Error() string {
+	return e.message
+}
 
-	// 如果是根路径，尝试 index.html
-	if requestPath == "/" {
-		requestPath = "/index.html"
+var (
+	errWebsiteNotFound = &serveError{http.StatusNotFound, "Website not found"}
+	errFileNotFound    = &serveError{http.StatusNotFound, "File not found"}
+	errAccessDenied    = &serveError{http.StatusForbidden, "Access denied"}
+	errDirListing      = &serveError{http.StatusForbidden, "Directory listing not allowed"}
+	errDirRedirect     = &serveError{http.StatusMovedPermanently, "Moved Permanently"} // 目录地址缺少结尾的 /
+	errHiddenFile      = &serveError{http.StatusNotFound, "File not found"}             // 版本库、规则文件等不对外提供的文件
+)
+
+// serveSite 服务指定网站中的请求路径
+func (h *StaticFileHandler) serveSite(w http.ResponseWriter, r *http.Request, siteName, requestPath string) {
+	// 隐藏目录（如部署暂存目录）不是网站
+	if siteName == "" || strings.HasPrefix(siteName, ".") {
+		http.Error(w, errWebsiteNotFound.message, errWebsiteNotFound.status)
+		return
 	}
 
-	// 构建完整文件路径
-	filePath := filepath.Join(sitePath, requestPath)
+	if h.authorize != nil && !h.authorize(w, r, siteName) {
+		return
+	}
 
-	// 清理路径，防止目录遍历攻击
-	filePath = filepath.Clean(filePath)
-	if !strings.HasPrefix(filePath, sitePath) {
-		http.Error(w, "Access denied", http.StatusForbidden)
+	h.serveFrom(w, r, siteName, siteName, filepath.Join(h.webRoot, siteName), requestPath)
+}
+
+// servePreview 服务网站的预览部署，预览不存在或已过期时返回 404
+func (h *StaticFileHandler) servePreview(w http.ResponseWriter, r *http.Request, siteName, label, requestPath string) {
+	if validatePreviewTarget(siteName, label) != nil {
+		http.Error(w, errWebsiteNotFound.message, errWebsiteNotFound.status)
+		return
+	}
+	if _, exists := h.previews.get(siteName, label); !exists {
+		http.Error(w, "Preview not found", http.StatusNotFound)
+		return
+	}
+
+	// 预览沿用网站的访问策略
+	if h.authorize != nil && !h.authorize(w, r, siteName) {
+		return
+	}
+
+	h.serveFrom(w, r, siteName, previewLockName(siteName, label), h.previews.dir(siteName, label), requestPath)
+}
+
+// serveFrom 在指定目录中解析并服务请求路径，lockName 为对应的网站锁名称
+func (h *StaticFileHandler) serveFrom(w http.ResponseWriter, r *http.Request, siteName, lockName, sitePath, requestPath string) {
+	// 在读锁内解析并打开文件，部署切换持有写锁，因此打开的文件一定属于某个完整版本；
+	// 文件打开后即可释放锁，慢速下载不会阻塞部署
+	var lock *siteLock
+	if h.locks != nil {
+		lock = h.locks.get(lockName)
+		lock.serve.RLock()
+	}
+	// _redirects 规则同样在锁内读取，保证规则与文件属于同一版本
+	base := siteBasePath(r, requestPath)
+	var redirect *RedirectRule
+	var target string
+	if redirects, ok := h.redirectFiles.load(sitePath).([]RedirectRule); ok {
+		redirect, target = findRedirect(redirects, cleanRequestPath(requestPath), func(requestPath string) bool {
+			return siteFileExists(sitePath, requestPath)
+		})
+	}
+	rewrite := redirect != nil && redirect.Status == http.StatusOK && !redirect.isProxy()
+	if rewrite {
+		// 站内重写：直接服务目标路径对应的文件，不再匹配其他规则
+		requestPath, _, _ = strings.Cut(target, "?")
+	}
+
+	var settings siteServeConfig
+	if h.siteSettings != nil {
+		settings = h.siteSettings(siteName)
+	}
+
+	var file *os.File
+	var info os.FileInfo
+	var err error
+	status := http.StatusOK
+	if redirect == nil || rewrite {
+		file, info, err = h.openSiteFile(sitePath, requestPath)
+		if err == errDirRedirect && rewrite {
+			// 重写目标是目录时直接使用其中的 index.html
+			file, info, err = h.openSiteFile(sitePath, requestPath+"/")
+		}
+		if err == errFileNotFound {
+			// 按网站的 404 处理方式返回 index.html、404.html 或直接 404
+			fallback, fallbackStatus := notFoundFallback(settings.notFound,
+				siteFileExists(sitePath, "/index.html"), siteFileExists(sitePath, "/"+notFoundPage))
+			if fallback != "" {
+				file, info, err = h.openSiteFile(sitePath, "/"+fallback)
+				status = fallbackStatus
+			}
+		}
+	}
+	var rules []HeaderRule
+	if err == nil {
+		rules, _ = h.headerFiles.load(sitePath).([]HeaderRule)
+	}
+	if lock != nil {
+		lock.serve.RUnlock()
+	}
+
+	if redirect != nil && !rewrite {
+		if redirect.isProxy() {
+			h.proxyRequest(w, r, siteName, target)
+			return
+		}
+		http.Redirect(w, r, redirectLocation(r, base, target), redirect.Status)
 		return
 	}
 
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		// 尝试返回 index.html (SPA 路由支持)
-		indexPath := filepath.Join(sitePath, "index.html")
-		if _, err := os.Stat(indexPath); err == nil {
-			h.serveFile(w, r, indexPath)
+	if err == errDirRedirect {
+		redirectToDirectory(w, r)
+		return
+	}
+	if err != nil {
+		if se, ok := err.(*serveError); ok {
+			http.Error(w, se.message, se.status)
 			return
 		}
-		http.Error(w, "File not found", http.StatusNotFound)
+		http.Error(w, "Failed to open file", http.StatusInternalServerError)
 		return
 	}
+	defer file.Close()
 
-	// 服务文件
-	h.serveFile(w, r, filePath)
+	// 网站设置中的规则在 _headers 之后应用，优先级更高
+	rules = append(rules[:len(rules):len(rules)], settings.headers...)
+	relPath, _ := filepath.Rel(sitePath, file.Name())
+	opts := serveOptions{rules: rules, relPath: "/" + filepath.ToSlash(relPath)}
+	if h.mode == "path" && base != "" {
+		opts.basePath, opts.pathRewrite = base, settings.pathRewrite
+	}
+	if status == http.StatusNotFound {
+		h.serveNotFound(w, r, file, opts)
+		return
+	}
+	h.serveFile(w, r, file, info, opts)
 }
 
-// serveFile 服务单个文件
-func (h *StaticFileHandler) serveFile(w http.ResponseWriter, r *http.Request, filePath string) {
-	// 获取文件信息
+// serveOptions 服务单个文件时的附加设置
+type serveOptions struct {
+	rules       []HeaderRule // 响应头规则
+	relPath     string       // 文件在网站中的路径，用于匹配响应头规则
+	basePath    string       // 路径模式下的网站访问前缀（如 /site），为空表示不处理
+	pathRewrite string       // 访问前缀处理方式
+}
+
+// rewritesBasePath 判断是否需要为指定类型的内容加上网站访问前缀
+func (opts *serveOptions) rewritesBasePath(contentType string) bool {
+	return opts.basePath != "" && rewritesContentType(opts.pathRewrite, contentType)
+}
+
+// serveNotFound 返回自定义 404 页面，按设置加上网站访问前缀
+func (h *StaticFileHandler) serveNotFound(w http.ResponseWriter, r *http.Request, content io.Reader, opts serveOptions) {
+	if contentType := h.getContentType(notFoundPage); opts.rewritesBasePath(contentType) {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(rewriteBasePath(opts.pathRewrite, opts.basePath, "/"+notFoundPage, contentType, data))
+	}
+	serveNotFoundPage(w, r, content, opts.rules)
+}
+
+// withinDir 判断路径是否位于目录之内（包括目录本身），按路径分隔符比较，
+// 避免 /web/demo2 被当作 /web/demo 的子路径
+func withinDir(dir, target string) bool {
+	dir = filepath.Clean(dir)
+	target = filepath.Clean(target)
+	return target == dir || strings.HasPrefix(target, dir+string(filepath.Separator))
+}
+
+// openSiteFile 在网站目录中解析请求路径并打开对应文件，目录返回其中的 index.html
+func (h *StaticFileHandler) openSiteFile(sitePath, requestPath string) (*os.File, os.FileInfo, error) {
+	// 检查网站是否存在
+	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
+		log.Printf("[ERROR] Site directory not found: %s", sitePath)
+		return nil, nil, errWebsiteNotFound
+	}
+
+	// 构建完整文件路径
+	filePath := filepath.Join(sitePath, requestPath)
+
+	// 清理路径，防止目录遍历攻击
+	filePath = filepath.Clean(filePath)
+	if !withinDir(sitePath, filePath) {
+		return nil, nil, errAccessDenied
+	}
+
+	// 不对外暴露版本库
+	relPath, _ := filepath.Rel(sitePath, filePath)
+	for _, part := range strings.Split(filepath.ToSlash(relPath), "/") {
+		if part == ".git" {
+			return nil, nil, errHiddenFile
+		}
+	}
+	// 规则文件不对外提供
+	if isRuleFile(filepath.ToSlash(relPath)) {
+		return nil, nil, errHiddenFile
+	}
+
+	// 检查文件是否存在，不存在时由调用方按网站的 404 处理方式处理
 	info, err := os.Stat(filePath)
 	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
+		return nil, nil, errFileNotFound
 	}
 
-	// 如果是目录，尝试 index.html
+	// 如果是目录，尝试 index.html；地址缺少结尾的 / 时先重定向
 	if info.IsDir() {
-		indexPath := filepath.Join(filePath, "index.html")
-		if _, err := os.Stat(indexPath); err == nil {
-			h.serveFile(w, r, indexPath)
-			return
+		if !strings.HasSuffix(requestPath, "/") {
+			return nil, nil, errDirRedirect
+		}
+		filePath = filepath.Join(filePath, "index.html")
+		info, err = os.Stat(filePath)
+		if err != nil || info.IsDir() {
+			return nil, nil, errDirListing
 		}
-		http.Error(w, "Directory listing not allowed", http.StatusForbidden)
-		return
 	}
 
 	// 打开文件
 	file, err := os.Open(filePath)
 	if err != nil {
-		http.Error(w, "Failed to open file", http.StatusInternalServerError)
-		return
+		return nil, nil, err
 	}
-	defer file.Close()
+	return file, info, nil
+}
+
+// serveFile 服务单个已打开的文件
+func (h *StaticFileHandler) serveFile(w http.ResponseWriter, r *http.Request, file *os.File, info os.FileInfo, opts serveOptions) {
+	filePath := file.Name()
 
 	// 设置 Content-Type
 	contentType := h.getContentType(filePath)
 	w.Header().Set("Content-Type", contentType)
 
-	// 设置缓存头
+	// 设置缓存头，受访问策略保护的网站只允许浏览器私有缓存
+	private := w.Header().Get("Cache-Control") == "private"
 	if h.shouldCache(filePath) {
-		w.Header().Set("Cache-Control", "public, max-age=31536000") // 1年
+		if private {
+			w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable") // 1年
+		}
+	} else if private {
+		w.Header().Set("Cache-Control", "private, no-cache")
 	} else {
 		w.Header().Set("Cache-Control", "no-cache")
 	}
 
-	// 设置 ETag
-	etag := fmt.Sprintf(`"%x"`, info.ModTime().Unix())
+	// 应用 _headers 文件和网站设置中的响应头规则
+	applyHeaderRules(w, opts.rules, opts.relPath, private, false)
+
+	// 设置 ETag：由内容哈希生成，内容不变时重新部署也保持不变
+	etag, err := h.etags.get(filePath, info, file)
+	if err != nil {
+		log.Printf("[ERROR] Failed to hash %s: %v", filePath, err)
+		etag = fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+	}
+
+	// 路径模式下按设置为 HTML/CSS 加上网站访问前缀，改写后的内容使用不同的 ETag
+	rewrite := opts.rewritesBasePath(contentType)
+	if rewrite {
+		etag = encodedETag(etag, opts.pathRewrite)
+	}
+
+	// 内容协商：优先使用预压缩文件（.br/.gz），其次对可压缩类型实时 gzip
+	var content io.ReadSeeker = file
+	encoding := ""
+	if sibling, _, siblingEncoding := openPrecompressed(r, filePath, info); sibling != nil && !rewrite {
+		defer sibling.Close()
+		content, encoding = sibling, siblingEncoding
+	} else if sibling != nil {
+		sibling.Close()
+	}
+	if encoding == "" && shouldCompress(r, contentType, info.Size()) {
+		encoding = "gzip"
+	}
+	if encoding != "" || isCompressible(contentType) || hasPrecompressed(filePath) {
+		addVary(w, "Accept-Encoding")
+	}
+
+	// 不同编码的内容使用不同的 ETag
+	etag = encodedETag(etag, encoding)
 	w.Header().Set("ETag", etag)
 
-	// 检查 If-None-Match
-	if r.Header.Get("If-None-Match") == etag {
-		w.WriteHeader(http.StatusNotModified)
+	// 检查条件请求
+	if notModified(r, etag, info.ModTime()) {
+		writeNotModified(w)
 		return
 	}
 
+	if rewrite {
+		data, err := io.ReadAll(file)
+		if err == nil {
+			data = rewriteBasePath(opts.pathRewrite, opts.basePath, opts.relPath, contentType, data)
+			if encoding == "gzip" {
+				// 改写结果与访问前缀有关，缓存键需包含前缀
+				data, err = h.compression.gzip(etag+"|"+opts.basePath, bytes.NewReader(data))
+			}
+		}
+		if err != nil {
+			log.Printf("[ERROR] Failed to rewrite %s: %v", filePath, err)
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	} else if content == file && encoding == "gzip" {
+		// 以内容哈希作为缓存键，相同内容的文件共用压缩结果
+		data, err := h.compression.gzip(etag, file)
+		if err != nil {
+			log.Printf("[ERROR] Failed to compress %s: %v", filePath, err)
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+
 	// 返回文件内容
-	http.ServeContent(w, r, filePath, info.ModTime(), file)
+	http.ServeContent(w, r, filePath, info.ModTime(), content)
 }
 
 // extractSiteName 从请求中提取网站名称
 func (h *StaticFileHandler) extractSiteName(host string) (string, error) {
+	// 自定义域名在两种模式下都直接对应网站
+	if siteName, exists := h.domains.lookup(host); exists {
+		return siteName, nil
+	}
+
 	if h.mode == "subdomain" {
 		// 移除端口号（如果存在）
 		hostParts := strings.Split(host, ":")
@@ -217,7 +506,8 @@ func (h *StaticFileHandler) getContentType(filePath string) string {
 	}
 }
 
-// shouldCache 判断文件是否应该缓存
+// shouldCache 判断文件是否应该长期缓存
+// 只有文件名带内容指纹的静态资源才长期缓存，其余文件（如 app.js）每次通过 ETag 协商，保证更新及时生效
 func (h *StaticFileHandler) shouldCache(filePath string) bool {
 	ext := strings.ToLower(filepath.Ext(filePath))
 	cacheableExts := map[string]bool{
@@ -234,7 +524,7 @@ func (h *StaticFileHandler) shouldCache(filePath string) bool {
 		".ttf": true,
 		".eot": true,
 	}
-	return cacheableExts[ext]
+	return cacheableExts[ext] && isFingerprinted(filePath)
 }
 
 // PathModeHandler 路径模式的处理器
@@ -244,6 +534,16 @@ type PathModeHandler struct {
 
 // ServeHTTP 路径模式的HTTP处理
 func (h *PathModeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 自定义域名直接访问网站根目录
+	if siteName, exists := h.domains.lookup(r.Host); exists {
+		if ref, rest, ok := splitVersionPath(r.URL.Path); ok {
+			h.serveVersion(w, r, siteName, ref, rest)
+			return
+		}
+		h.serveSite(w, r, siteName, r.URL.Path)
+		return
+	}
+
 	// 从路径中提取网站名称: /site/path -> site
 	path := strings.TrimPrefix(r.URL.Path, "/")
 	parts := strings.SplitN(path, "/", 2)
@@ -255,12 +555,15 @@ func (h *PathModeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 构建网站路径
-	sitePath := filepath.Join(h.webRoot, siteName)
+	// 网站中以 / 开头的资源地址缺少网站前缀时，根据 Referer 重定向到来源网站
+	if target, ok := h.refererRedirect(r, siteName); ok {
+		http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+		return
+	}
 
-	// 检查网站是否存在
-	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
-		http.Error(w, "Website not found", http.StatusNotFound)
+	// 混合模式下网站可能限制为只能按子域名访问
+	if !h.servesRouting(siteName) {
+		http.Error(w, errWebsiteNotFound.message, errWebsiteNotFound.status)
 		return
 	}
 
@@ -268,39 +571,21 @@ func (h *PathModeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var requestPath string
 	if len(parts) > 1 {
 		requestPath = "/" + parts[1]
-	} else {
-		requestPath = "/"
 	}
 
-	// 构建完整文件路径
-	filePath := filepath.Join(sitePath, requestPath)
-
-	// 清理路径
-	filePath = filepath.Clean(filePath)
-	if !strings.HasPrefix(filePath, sitePath) {
-		http.Error(w, "Access denied", http.StatusForbidden)
+	// 预览地址：/site/_preview/label/path
+	if label, rest, ok := splitPreviewPath(requestPath); ok {
+		h.servePreview(w, r, siteName, label, rest)
 		return
 	}
 
-	// 如果是根路径，尝试 index.html
-	if requestPath == "/" {
-		filePath = filepath.Join(sitePath, "index.html")
-	}
-
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		// 尝试返回 index.html (SPA 路由支持)
-		indexPath := filepath.Join(sitePath, "index.html")
-		if _, err := os.Stat(indexPath); err == nil {
-			h.serveFile(w, r, indexPath)
-			return
-		}
-		http.Error(w, "File not found", http.StatusNotFound)
+	// 历史版本地址：/site/@hash/path
+	if ref, rest, ok := splitVersionPath(requestPath); ok {
+		h.serveVersion(w, r, siteName, ref, rest)
 		return
 	}
 
-	// 服务文件
-	h.serveFile(w, r, filePath)
+	h.serveSite(w, r, siteName, requestPath)
 }
 
 // listSites 列出所有网站
@@ -313,7 +598,7 @@ func (h *PathModeHandler) listSites(w http.ResponseWriter, r *http.Request) {
 
 	sites := make([]string, 0)
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && h.servesRouting(entry.Name()) {
 			sites = append(sites, entry.Name())
 		}
 	}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestPathHandler 创建路径模式处理器，protected 中的网站拒绝所有访问
+func newTestPathHandler(t *testing.T, protected ...string) (*PathModeHandler, string) {
+	t.Helper()
+	webRoot := t.TempDir()
+	for _, site := range []string{"demo", "demo2"} {
+		dir := filepath.Join(webRoot, site)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>"+site+"</h1>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(webRoot, "demo2", "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fileHandler := NewStaticFileHandler(webRoot, "path", "", "")
+	fileHandler.authorize = func(w http.ResponseWriter, r *http.Request, siteName string) bool {
+		for _, name := range protected {
+			if name == siteName {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return false
+			}
+		}
+		return true
+	}
+	return &PathModeHandler{StaticFileHandler: fileHandler}, webRoot
+}
+
+func TestPathModeRejectsTraversalIntoSiblingSite(t *testing.T) {
+	handler, _ := newTestPathHandler(t, "demo2")
+
+	tests := []string{
+		"/demo/../demo2/secret.txt",
+		"/demo/..%2fdemo2/secret.txt",
+		"/demo/./../demo2/secret.txt",
+	}
+	for _, target := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code == http.StatusOK || w.Body.String() == "secret" {
+			t.Errorf("%s: got %d %q, want the protected file not to be served", target, w.Code, w.Body.String())
+		}
+	}
+
+	// 直接访问受保护网站时仍由访问策略处理
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/demo2/secret.txt", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("/demo2/secret.txt: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOpenSiteFileStaysInsideSite(t *testing.T) {
+	handler, webRoot := newTestPathHandler(t)
+	sitePath := filepath.Join(webRoot, "demo")
+
+	if _, _, err := handler.openSiteFile(sitePath, "/../demo2/secret.txt"); err != errAccessDenied {
+		t.Errorf("openSiteFile(../demo2/secret.txt) error = %v, want %v", err, errAccessDenied)
+	}
+	file, _, err := handler.openSiteFile(sitePath, "/index.html")
+	if err != nil {
+		t.Fatalf("openSiteFile(index.html) error = %v", err)
+	}
+	file.Close()
+
+	if siteFileExists(sitePath, "/../demo2/secret.txt") {
+		t.Error("siteFileExists reported a file in a sibling site")
+	}
+	if !siteFileExists(sitePath, "/index.html") {
+		t.Error("siteFileExists did not find index.html")
+	}
+}
+
+func TestWithinDir(t *testing.T) {
+	tests := []struct {
+		dir, target string
+		want        bool
+	}{
+		{"/web/demo", "/web/demo", true},
+		{"/web/demo", "/web/demo/index.html", true},
+		{"/web/demo", "/web/demo2/index.html", false},
+		{"/web/demo", "/web/demo2", false},
+		{"/web/demo", "/web", false},
+		{"/web/demo/", "/web/demo/a/b", true},
+	}
+	for _, tt := range tests {
+		if got := withinDir(filepath.FromSlash(tt.dir), filepath.FromSlash(tt.target)); got != tt.want {
+			t.Errorf("withinDir(%q, %q) = %v, want %v", tt.dir, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxTagLength 版本标签最大长度
+const maxTagLength = 64
+
+// TagInfo 版本标签信息
+type TagInfo struct {
+	Tag     string   `json:"tag"`
+	Hash    string   `json:"hash"`
+	Version *Version `json:"version,omitempty"` // 标签指向的版本
+}
+
+// validateTagName 校验版本标签名称
+// 标签只能包含字母、数字和 . _ -，不能以 HEAD 开头，也不能是 7 位以上的十六进制（避免与版本哈希混淆）；
+// 较短的十六进制名称（如 2024、beef）可以使用，解析版本时标签优先于哈希前缀
+func validateTagName(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("标签名称不能为空")
+	}
+	if len(tag) > maxTagLength {
+		return fmt.Errorf("标签名称不能超过 %d 个字符", maxTagLength)
+	}
+	for i, c := range tag {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if i == 0 && !isAlnum {
+			return fmt.Errorf("标签名称必须以字母或数字开头")
+		}
+		if !isAlnum && c != '.' && c != '_' && c != '-' {
+			return fmt.Errorf("标签名称只能包含字母、数字和 . _ -")
+		}
+	}
+	if strings.HasPrefix(tag, "HEAD") {
+		return fmt.Errorf("标签名称不能以 HEAD 开头")
+	}
+	if len(tag) >= minVersionRefLen && isHexString(tag) {
+		return fmt.Errorf("标签名称不能是 %d 位以上的十六进制（会与版本哈希混淆）", minVersionRefLen)
+	}
+	return nil
+}
+
+// isHexString 判断字符串是否只包含十六进制字符
+func isHexString(value string) bool {
+	for _, c := range strings.ToLower(value) {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTagAvailable 检查标签是否可以用于新部署（已存在时需要显式移动）
+func (s *DeployServer) checkTagAvailable(name, tag string) error {
+	if !s.config().EnableVersioning {
+		return fmt.Errorf("版本控制未启用，无法设置标签")
+	}
+	tags, err := s.versions.Tags(name)
+	if err != nil {
+		return err
+	}
+	if hash, exists := tags[tag]; exists {
+		return fmt.Errorf("标签 %s 已指向版本 %s", tag, shortVersionHash(hash))
+	}
+	return nil
+}
+
+// tagDeployment 为部署后的当前版本设置标签（内容未变化时标记已有的当前版本），调用方需持有网站部署锁
+// 标签失败不影响部署
+func (s *DeployServer) tagDeployment(name, tag string) {
+	hash, err := s.versions.Resolve(name, "HEAD")
+	if err == nil {
+		err = s.versions.Tag(name, tag, hash)
+	}
+	if err != nil {
+		fmt.Printf("设置版本标签 %s 失败: %v\n", tag, err)
+	}
+}
+
+// shortVersionHash 截取版本哈希用于提示信息
+func shortVersionHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+// handleTags 列出网站的版本标签
+func (s *DeployServer) handleTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if !s.checkTagSite(w, r, name) {
+		return
+	}
+
+	tags, err := s.versions.Tags(name)
+	if err != nil {
+		s.respondError(w, fmt.Sprintf("获取标签失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// 补充标签指向的版本信息
+	versions := make(map[string]Version)
+	all, _, err := s.versions.List(name, versionQuery{Limit: int(^uint(0) >> 1)})
+	if err == nil {
+		for _, version := range all {
+			versions[version.Hash] = version
+		}
+	}
+
+	result := []TagInfo{}
+	for tag, hash := range tags {
+		info := TagInfo{Tag: tag, Hash: hash}
+		if version, exists := versions[hash]; exists {
+			version.URL = s.versionURL(r, name, hash)
+			info.Version = &version
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Tag < result[j].Tag
+	})
+
+	s.respondJSON(w, result)
+}
+
+// handleCreateTag 为版本设置标签
+func (s *DeployServer) handleCreateTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name    string `json:"name"`
+		Tag     string `json:"tag"`
+		Version string `json:"version"` // 版本引用，为空表示当前版本
+		Force   bool   `json:"force"`   // 标签已存在时移动到新版本
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, "无效的请求", http.StatusBadRequest)
+		return
+	}
+	if err := validateTagName(req.Tag); err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Version == "" {
+		req.Version = "HEAD"
+	}
+
+	if !s.checkTagSite(w, r, req.Name) {
+		return
+	}
+
+	// 与部署、回滚和版本清理互斥
+	lock := s.locks.get(req.Name)
+	lock.deploy.Lock()
+	defer lock.deploy.Unlock()
+
+	hash, err := s.versions.Resolve(req.Name, req.Version)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !req.Force {
+		tags, err := s.versions.Tags(req.Name)
+		if err != nil {
+			s.respondError(w, fmt.Sprintf("获取标签失败: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if current, exists := tags[req.Tag]; exists && current != hash {
+			s.respondError(w, fmt.Sprintf("标签 %s 已指向版本 %s", req.Tag, shortVersionHash(current)), http.StatusConflict)
+			return
+		}
+	}
+
+	if err := s.versions.Tag(req.Name, req.Tag, hash); err != nil {
+		s.respondError(w, fmt.Sprintf("设置标签失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.respondJSON(w, map[string]interface{}{
+		"message": "标签设置成功",
+		"tag":     req.Tag,
+		"hash":    hash,
+		"url":     s.versionURL(r, req.Name, hash),
+	})
+}
+
+// handleDeleteTag 删除版本标签（版本本身不受影响，之后可能被保留策略清理）
+func (s *DeployServer) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+		Tag  string `json:"tag"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, "无效的请求", http.StatusBadRequest)
+		return
+	}
+	if req.Tag == "" {
+		s.respondError(w, "标签名称不能为空", http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkTagSite(w, r, req.Name) {
+		return
+	}
+
+	lock := s.locks.get(req.Name)
+	lock.deploy.Lock()
+	defer lock.deploy.Unlock()
+
+	if err := s.versions.Untag(req.Name, req.Tag); err != nil {
+		s.respondError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	s.respondJSON(w, map[string]interface{}{
+		"message": "标签已删除",
+	})
+}
+
+// checkTagSite 检查标签接口的网站参数、网站权限和版本控制状态，失败时直接写入错误响应
+func (s *DeployServer) checkTagSite(w http.ResponseWriter, r *http.Request, name string) bool {
+	if name == "" {
+		s.respondError(w, "网站名称不能为空", http.StatusBadRequest)
+		return false
+	}
+
+	if err := s.checkSiteAccess(r, name); err != nil {
+		s.respondError(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+
+	sitePath := filepath.Join(s.config().WebRoot, name)
+	if _, err := os.Stat(sitePath); os.IsNotExist(err) {
+		s.respondError(w, "网站不存在", http.StatusNotFound)
+		return false
+	}
+
+	if !s.config().EnableVersioning {
+		s.respondError(w, "版本控制未启用", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
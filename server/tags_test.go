@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateTagName(t *testing.T) {
+	tests := []struct {
+		tag   string
+		valid bool
+	}{
+		{"v1-client-review", true},
+		{"release_2.0", true},
+		{"2024", true},
+		{"beef", true},
+		{"abc1234", false},
+		{"DEADBEEF", false},
+		{"HEAD~1", false},
+		{"-draft", false},
+		{"with space", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := validateTagName(tt.tag); (err == nil) != tt.valid {
+			t.Errorf("validateTagName(%q) = %v, want valid %v", tt.tag, err, tt.valid)
+		}
+	}
+}
+
+func TestTagsRequireSiteAccess(t *testing.T) {
+	s := newTestServer(t, Config{
+		EnableVersioning: true,
+		Users: map[string]User{
+			"admin": {Name: "admin", Password: "admin-secret", IsAdmin: true},
+			"alice": {Name: "alice", Password: "alice-secret"},
+			"bob":   {Name: "bob", Password: "bob-secret"},
+		},
+		Sites: map[string]Site{"demo": {Name: "demo", Owner: "alice"}},
+	})
+	writeTestFiles(t, filepath.Join(s.config().WebRoot, "demo"), map[string]string{"index.html": "v1"})
+	if err := s.commitChanges("demo", "v1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	alice := loginTestUser(t, s, "alice", "alice-secret")
+	bob := loginTestUser(t, s, "bob", "bob-secret")
+	tag := map[string]string{"name": "demo", "tag": "review"}
+
+	create := s.authMiddleware(s.handleCreateTag)
+	remove := s.authMiddleware(s.handleDeleteTag)
+	if w := serveTestRequest(t, create, http.MethodPost, "/api/sites/tags/create", bob.AccessToken, tag); w.Code != http.StatusForbidden {
+		t.Errorf("bob create tag: got %d, want 403", w.Code)
+	}
+	if w := serveTestRequest(t, create, http.MethodPost, "/api/sites/tags/create", alice.AccessToken, tag); w.Code != http.StatusOK {
+		t.Fatalf("alice create tag: got %d (%s)", w.Code, w.Body.String())
+	}
+	if w := serveTestRequest(t, remove, http.MethodPost, "/api/sites/tags/delete", bob.AccessToken, tag); w.Code != http.StatusForbidden {
+		t.Errorf("bob delete tag: got %d, want 403", w.Code)
+	}
+	if tags, err := s.versions.Tags("demo"); err != nil || tags["review"] == "" {
+		t.Errorf("tags = %v, %v: the tag should still exist", tags, err)
+	}
+	if w := serveTestRequest(t, remove, http.MethodPost, "/api/sites/tags/delete", alice.AccessToken, tag); w.Code != http.StatusOK {
+		t.Errorf("alice delete tag: got %d (%s)", w.Code, w.Body.String())
+	}
+}
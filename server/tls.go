@@ -0,0 +1,193 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// TLSConfig HTTPS 配置
+type TLSConfig struct {
+	Enabled      bool                 `json:"enabled"`              // 是否启用 HTTPS
+	Port         int                  `json:"port"`                 // HTTPS 端口，默认 443
+	CertFile     string               `json:"cert_file"`            // 默认证书文件
+	KeyFile      string               `json:"key_file"`             // 默认证书私钥
+	SiteCerts    map[string]CertFiles `json:"site_certs,omitempty"` // 网站独立证书（网站名 -> 证书），按 SNI 选择
+	HTTPRedirect bool                 `json:"http_redirect"`        // HTTP 请求重定向到 HTTPS
+	ACME         *ACMEConfig          `json:"acme,omitempty"`       // 自动申请证书
+}
+
+// CertFiles 证书文件
+type CertFiles struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// tlsEnabled 是否启用了 HTTPS
+func (s *DeployServer) tlsEnabled() bool {
+	return s.config().TLS != nil && s.config().TLS.Enabled
+}
+
+// httpsPort 返回 HTTPS 端口
+func (s *DeployServer) httpsPort() int {
+	if s.config().TLS != nil && s.config().TLS.Port != 0 {
+		return s.config().TLS.Port
+	}
+	return 443
+}
+
+// publicScheme 网站对外访问使用的协议
+func (s *DeployServer) publicScheme() string {
+	if s.tlsEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// publicHost 返回对外访问的主机名，非默认端口时带上端口
+func (s *DeployServer) publicHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if s.tlsEnabled() {
+		if port := s.httpsPort(); port != 443 {
+			return fmt.Sprintf("%s:%d", host, port)
+		}
+		return host
+	}
+
+	if s.config().Port != 80 && s.config().Port != 443 {
+		return fmt.Sprintf("%s:%d", host, s.config().Port)
+	}
+	return host
+}
+
+// certManager 按 SNI 选择证书：网站独立证书 > ACME 证书 > 默认证书
+type certManager struct {
+	mu          sync.RWMutex
+	defaultCert *tls.Certificate
+	siteCerts   map[string]*tls.Certificate
+	acme        *acmeManager
+	resolveSite func(host string) string // 主机名 -> 网站名
+}
+
+// newCertManager 加载配置中的证书
+func newCertManager(cfg *TLSConfig, resolveSite func(host string) string) (*certManager, error) {
+	m := &certManager{
+		siteCerts:   make(map[string]*tls.Certificate),
+		resolveSite: resolveSite,
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载默认证书失败: %v", err)
+		}
+		m.defaultCert = &cert
+	}
+
+	for site, files := range cfg.SiteCerts {
+		cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载网站 %s 的证书失败: %v", site, err)
+		}
+		m.siteCerts[site] = &cert
+	}
+
+	return m, nil
+}
+
+// getCertificate 实现 tls.Config.GetCertificate
+func (m *certManager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if host != "" && m.resolveSite != nil {
+		if cert, exists := m.siteCerts[m.resolveSite(host)]; exists {
+			return cert, nil
+		}
+	}
+
+	if m.acme != nil && host != "" {
+		if cert := m.acme.certificateFor(host); cert != nil {
+			return cert, nil
+		}
+	}
+
+	if m.defaultCert != nil {
+		return m.defaultCert, nil
+	}
+
+	return nil, fmt.Errorf("没有可用于 %s 的证书", host)
+}
+
+// serveTLS 同时启动 HTTPS 和 HTTP 服务
+// HTTP 端口根据配置重定向到 HTTPS 或继续提供同样的服务
+func (s *DeployServer) serveTLS(handler http.Handler, resolveSite func(host string) string) error {
+	cfg := s.config().TLS
+
+	certs, err := newCertManager(cfg, resolveSite)
+	if err != nil {
+		return err
+	}
+
+	if cfg.ACME != nil {
+		manager, err := newACMEManager(cfg.ACME, s.config().BaseDomain, s.configPath)
+		if err != nil {
+			return fmt.Errorf("初始化 ACME 失败: %v", err)
+		}
+		certs.acme = manager
+		go manager.run()
+	} else if certs.defaultCert == nil && len(certs.siteCerts) == 0 {
+		return fmt.Errorf("已启用 HTTPS，但没有配置证书或 ACME")
+	}
+
+	httpsServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.httpsPort()),
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.getCertificate,
+		},
+	}
+
+	httpHandler := handler
+	if cfg.HTTPRedirect {
+		httpHandler = http.HandlerFunc(s.redirectToHTTPS)
+	}
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.config().Port),
+		Handler: httpHandler,
+	}
+
+	fmt.Printf("HTTPS 服务启动在 https://localhost:%d\n", s.httpsPort())
+	if cfg.HTTPRedirect {
+		fmt.Printf("HTTP 端口 %d 将重定向到 HTTPS\n", s.config().Port)
+	}
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- httpsServer.ListenAndServeTLS("", "")
+	}()
+	go func() {
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	// 任意一个服务退出都视为启动失败
+	err = <-errCh
+	httpsServer.Close()
+	httpServer.Close()
+	return err
+}
+
+// redirectToHTTPS 将 HTTP 请求重定向到 HTTPS（308 保留请求方法和请求体）
+func (s *DeployServer) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	target := "https://" + s.publicHost(r.Host) + r.URL.RequestURI()
+	http.Redirect(w, r, target, http.StatusPermanentRedirect)
+}
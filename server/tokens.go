@@ -0,0 +1,410 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// deployTokenPrefix 部署令牌前缀，用于和登录访问令牌区分
+const deployTokenPrefix = "adt_"
+
+const deployTokenContextKey contextKey = "deployToken"
+
+// 部署令牌可授权的操作
+const (
+	tokenActionDeploy   = "deploy"   // 部署（全量/增量/单文件）
+	tokenActionRollback = "rollback" // 回滚
+	tokenActionRead     = "read"     // 只读：网站列表、版本历史、导出
+)
+
+// tokenRouteActions 部署令牌可以访问的接口及所需操作，其余接口一律拒绝
+var tokenRouteActions = map[string]string{
+	"/api/sites/deploy":             tokenActionDeploy,
+	"/api/sites/deploy-full":        tokenActionDeploy,
+	"/api/sites/deploy-incremental": tokenActionDeploy,
+	"/api/sites/rollback":           tokenActionRollback,
+	"/api/sites/list":               tokenActionRead,
+	"/api/sites/versions":           tokenActionRead,
+	"/api/sites/diff":               tokenActionRead,
+	"/api/sites/tags":               tokenActionRead,
+	"/api/sites/tags/create":        tokenActionDeploy,
+	"/api/sites/tags/delete":        tokenActionDeploy,
+	"/api/sites/export":             tokenActionRead,
+	"/api/sites/previews":           tokenActionRead,
+	"/api/sites/previews/delete":    tokenActionDeploy,
+	"/api/sites/promote":            tokenActionDeploy,
+}
+
+// DeployToken 部署令牌（用于CI等自动化场景），配置中只保存令牌哈希
+type DeployToken struct {
+	ID        string    `json:"id"`              // 令牌ID
+	Name      string    `json:"name"`            // 令牌名称
+	Owner     string    `json:"owner"`           // 所属用户，权限不超过该用户
+	Hash      string    `json:"hash"`            // 令牌SHA-256哈希
+	Sites     []string  `json:"sites,omitempty"` // 允许的网站，为空表示所属用户可访问的全部网站
+	Actions   []string  `json:"actions"`         // 允许的操作：deploy、rollback、read
+	CreatedAt time.Time `json:"created_at"`      // 创建时间
+	ExpiresAt time.Time `json:"expires_at"`      // 过期时间，零值表示永不过期
+}
+
+// DeployTokenInfo 返回给客户端的令牌信息（不含哈希）
+type DeployTokenInfo struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Owner     string     `json:"owner"`
+	Sites     []string   `json:"sites"`
+	Actions   []string   `json:"actions"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired"`
+}
+
+// expired 令牌是否已过期
+func (t *DeployToken) expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt)
+}
+
+// allows 令牌是否允许指定操作
+func (t *DeployToken) allows(action string) bool {
+	for _, a := range t.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsSite 令牌是否允许访问指定网站
+func (t *DeployToken) allowsSite(siteName string) bool {
+	if len(t.Sites) == 0 {
+		return true
+	}
+	for _, site := range t.Sites {
+		if site == siteName {
+			return true
+		}
+	}
+	return false
+}
+
+// info 转换为返回给客户端的信息
+func (t *DeployToken) info() DeployTokenInfo {
+	info := DeployTokenInfo{
+		ID:        t.ID,
+		Name:      t.Name,
+		Owner:     t.Owner,
+		Sites:     t.Sites,
+		Actions:   t.Actions,
+		CreatedAt: t.CreatedAt,
+		Expired:   t.expired(),
+	}
+	if info.Sites == nil {
+		info.Sites = []string{}
+	}
+	if !t.ExpiresAt.IsZero() {
+		expiresAt := t.ExpiresAt
+		info.ExpiresAt = &expiresAt
+	}
+	return info
+}
+
+// hashDeployToken 计算令牌哈希
+func hashDeployToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// deployTokenFromContext 从上下文中获取部署令牌（登录用户请求返回 nil）
+func deployTokenFromContext(ctx context.Context) *DeployToken {
+	if token, ok := ctx.Value(deployTokenContextKey).(*DeployToken); ok {
+		return token
+	}
+	return nil
+}
+
+// lookupDeployToken 校验部署令牌并返回令牌及其所属用户
+// 令牌格式：adt_<id>_<secret>
+func (s *DeployServer) lookupDeployToken(raw string) (*DeployToken, *User, error) {
+	parts := strings.SplitN(strings.TrimPrefix(raw, deployTokenPrefix), "_", 2)
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("部署令牌格式错误")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, exists := s.config().DeployTokens[parts[0]]
+	if !exists || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashDeployToken(raw))) != 1 {
+		return nil, nil, fmt.Errorf("无效的部署令牌")
+	}
+	if token.expired() {
+		return nil, nil, fmt.Errorf("部署令牌已过期")
+	}
+
+	user, exists := s.config().Users[token.Owner]
+	if !exists {
+		return nil, nil, fmt.Errorf("令牌所属用户不存在")
+	}
+
+	return &token, &user, nil
+}
+
+// serveWithDeployToken 使用部署令牌认证请求，只允许访问令牌授权的接口
+func (s *DeployServer) serveWithDeployToken(w http.ResponseWriter, r *http.Request, raw string, next http.HandlerFunc) {
+	token, user, err := s.lookupDeployToken(raw)
+	if err != nil {
+		s.respondError(w, "未授权："+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	action, supported := tokenRouteActions[r.URL.Path]
+	if !supported || !token.allows(action) {
+		s.respondError(w, "部署令牌无权访问此接口", http.StatusForbidden)
+		return
+	}
+
+	ctx := contextWithUser(r.Context(), user)
+	ctx = context.WithValue(ctx, deployTokenContextKey, token)
+	next(w, r.WithContext(ctx))
+}
+
+// checkTokenSite 检查部署令牌是否可以操作指定网站（登录用户请求不受影响）
+// 令牌的权限不超过所属用户：既要在令牌网站范围内，所属用户也要有该网站的权限
+func (s *DeployServer) checkTokenSite(r *http.Request, siteName string) error {
+	token := deployTokenFromContext(r.Context())
+	if token == nil {
+		return nil
+	}
+
+	user := userFromContext(r.Context())
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !token.allowsSite(siteName) || !s.canAccessSite(siteName, user.Name, user) {
+		return fmt.Errorf("部署令牌无权操作网站 '%s'", siteName)
+	}
+	return nil
+}
+
+// checkSiteAccess 检查当前请求是否可以操作指定网站：登录用户需要是管理员、所有者或授权用户，
+// 部署令牌还要在令牌的网站范围内
+func (s *DeployServer) checkSiteAccess(r *http.Request, siteName string) error {
+	if err := s.checkTokenSite(r, siteName); err != nil {
+		return err
+	}
+
+	user := userFromContext(r.Context())
+	if user == nil {
+		return fmt.Errorf("未登录")
+	}
+	if user.IsAdmin {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.canAccessSite(siteName, user.Name, user) {
+		return fmt.Errorf("没有权限操作网站 '%s'", siteName)
+	}
+	return nil
+}
+
+// parseTokenActions 校验并规范化操作列表
+func parseTokenActions(actions []string) ([]string, error) {
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("至少需要指定一个操作")
+	}
+
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(actions))
+	for _, action := range actions {
+		action = strings.ToLower(strings.TrimSpace(action))
+		switch action {
+		case tokenActionDeploy, tokenActionRollback, tokenActionRead:
+		default:
+			return nil, fmt.Errorf("不支持的操作: %s（可选 deploy、rollback、read）", action)
+		}
+		if !seen[action] {
+			seen[action] = true
+			result = append(result, action)
+		}
+	}
+	return result, nil
+}
+
+// handleCreateToken 创建部署令牌（令牌明文只在创建时返回一次）
+func (s *DeployServer) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := userFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, "未授权", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name      string     `json:"name"`
+		Sites     []string   `json:"sites"`
+		Actions   []string   `json:"actions"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, "无效的请求", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		s.respondError(w, "令牌名称不能为空", http.StatusBadRequest)
+		return
+	}
+
+	actions, err := parseTokenActions(req.Actions)
+	if err != nil {
+		s.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			s.respondError(w, "过期时间必须晚于当前时间", http.StatusBadRequest)
+			return
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 只能为自己有权限的网站创建令牌
+	for _, site := range req.Sites {
+		if !s.canAccessSite(site, user.Name, user) {
+			s.respondError(w, fmt.Sprintf("没有网站 '%s' 的权限", site), http.StatusForbidden)
+			return
+		}
+	}
+
+	id := randomHex(8)
+	raw := deployTokenPrefix + id + "_" + randomHex(32)
+	token := DeployToken{
+		ID:        id,
+		Name:      req.Name,
+		Owner:     user.Name,
+		Hash:      hashDeployToken(raw),
+		Sites:     req.Sites,
+		Actions:   actions,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	if s.config().DeployTokens == nil {
+		s.config().DeployTokens = make(map[string]DeployToken)
+	}
+	s.config().DeployTokens[id] = token
+
+	if err := s.saveConfig(); err != nil {
+		delete(s.config().DeployTokens, id)
+		s.respondError(w, "保存配置失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.respondJSON(w, map[string]interface{}{
+		"message": "令牌创建成功，请妥善保存，令牌只显示这一次",
+		"token":   raw,
+		"info":    token.info(),
+	})
+}
+
+// handleListTokens 列出部署令牌（管理员可以看到所有用户的令牌）
+func (s *DeployServer) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := userFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, "未授权", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.RLock()
+	tokens := make([]DeployTokenInfo, 0)
+	for _, token := range s.config().DeployTokens {
+		if token.Owner == user.Name || user.IsAdmin {
+			tokens = append(tokens, token.info())
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	s.respondJSON(w, map[string]interface{}{
+		"tokens": tokens,
+	})
+}
+
+// handleRevokeToken 吊销部署令牌（所属用户或管理员）
+func (s *DeployServer) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, "方法不允许", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := userFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, "未授权", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		s.respondError(w, "无效的请求", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.config().DeployTokens[req.ID]
+	if !exists {
+		s.respondError(w, "令牌不存在", http.StatusNotFound)
+		return
+	}
+
+	if token.Owner != user.Name && !user.IsAdmin {
+		s.respondError(w, "没有权限吊销此令牌", http.StatusForbidden)
+		return
+	}
+
+	delete(s.config().DeployTokens, req.ID)
+
+	if err := s.saveConfig(); err != nil {
+		s.respondError(w, "保存配置失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.respondJSON(w, map[string]string{
+		"message": "令牌已吊销",
+	})
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createDeployToken 通过 API 创建部署令牌，返回令牌明文和ID
+func createDeployToken(t *testing.T, s *DeployServer, accessToken string, body map[string]interface{}) (string, string) {
+	t.Helper()
+	w := serveTestRequest(t, s.authMiddleware(s.handleCreateToken), http.MethodPost, "/api/tokens/create", accessToken, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create token: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token string          `json:"token"`
+		Info  DeployTokenInfo `json:"info"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Token, resp.Info.ID
+}
+
+func TestDeployTokenScope(t *testing.T) {
+	s := newTestServer(t, Config{
+		Users: map[string]User{
+			"admin": {Name: "admin", Password: "admin-secret", IsAdmin: true},
+			"alice": {Name: "alice", Password: "alice-secret"},
+		},
+		Sites: map[string]Site{
+			"demo":  {Name: "demo", Owner: "alice"},
+			"other": {Name: "other", Owner: "admin"},
+		},
+	})
+	for _, site := range []string{"demo", "other"} {
+		writeTestFiles(t, filepath.Join(s.config().WebRoot, site), map[string]string{"index.html": site})
+	}
+	alice := loginTestUser(t, s, "alice", "alice-secret")
+
+	// 不能为没有权限的网站创建令牌
+	w := serveTestRequest(t, s.authMiddleware(s.handleCreateToken), http.MethodPost, "/api/tokens/create", alice.AccessToken, map[string]interface{}{
+		"name": "ci", "sites": []string{"other"}, "actions": []string{"read"},
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("token for a site alice cannot access: got %d, want 403", w.Code)
+	}
+
+	token, _ := createDeployToken(t, s, alice.AccessToken, map[string]interface{}{
+		"name": "ci", "sites": []string{"demo"}, "actions": []string{"read"},
+	})
+	if !strings.HasPrefix(token, deployTokenPrefix) {
+		t.Fatalf("token %q does not start with %s", token, deployTokenPrefix)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    interface{}
+		want    int
+	}{
+		{"read allowed site", s.handleExport, http.MethodGet, "/api/sites/export?name=demo", nil, http.StatusOK},
+		{"read site outside scope", s.handleExport, http.MethodGet, "/api/sites/export?name=other", nil, http.StatusForbidden},
+		{"action not granted", s.handleRollback, http.MethodPost, "/api/sites/rollback", map[string]string{"name": "demo", "hash": "HEAD"}, http.StatusForbidden},
+		{"token management", s.handleListTokens, http.MethodGet, "/api/tokens/list", nil, http.StatusForbidden},
+		{"user management", s.requireAdmin(s.handleListUsers), http.MethodGet, "/api/users/list", nil, http.StatusForbidden},
+		{"site settings", s.handleUpdateSite, http.MethodPost, "/api/sites/update", map[string]string{"name": "demo"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := serveTestRequest(t, s.authMiddleware(tt.handler), tt.method, tt.target, token, tt.body); w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	// 网站列表只包含令牌范围内的网站
+	w = serveTestRequest(t, s.authMiddleware(s.handleListSites), http.MethodGet, "/api/sites/list", token, nil)
+	var list struct {
+		Sites []struct {
+			Name string `json:"name"`
+		} `json:"sites"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Sites) != 1 || list.Sites[0].Name != "demo" {
+		t.Errorf("token site list = %+v, want only demo", list.Sites)
+	}
+
+	// 配置文件只保存令牌哈希
+	data, err := os.ReadFile(s.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), token) {
+		t.Error("the plaintext deploy token was saved in the config file")
+	}
+}
+
+func TestDeployTokenExpiryAndRevocation(t *testing.T) {
+	s := newTestServer(t, Config{Users: map[string]User{
+		"admin": {Name: "admin", Password: "admin-secret", IsAdmin: true},
+		"alice": {Name: "alice", Password: "alice-secret"},
+	}})
+	list := s.authMiddleware(s.handleListSites)
+	revoke := s.authMiddleware(s.handleRevokeToken)
+	alice := loginTestUser(t, s, "alice", "alice-secret")
+	body := map[string]interface{}{"name": "ci", "actions": []string{"read"}}
+
+	expiring, expiringID := createDeployToken(t, s, alice.AccessToken, body)
+	revoked, revokedID := createDeployToken(t, s, alice.AccessToken, body)
+	for _, token := range []string{expiring, revoked} {
+		if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", token, nil); w.Code != http.StatusOK {
+			t.Fatalf("new token: got %d, want 200", w.Code)
+		}
+	}
+
+	s.mu.Lock()
+	token := s.config().DeployTokens[expiringID]
+	token.ExpiresAt = time.Now().Add(-time.Minute)
+	s.config().DeployTokens[expiringID] = token
+	s.mu.Unlock()
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", expiring, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired token: got %d, want 401", w.Code)
+	}
+
+	// 管理员可以吊销其他用户的令牌
+	if w := serveTestRequest(t, revoke, http.MethodPost, "/api/tokens/revoke", alice.AccessToken, map[string]string{"id": "missing"}); w.Code != http.StatusNotFound {
+		t.Errorf("revoke unknown token: got %d, want 404", w.Code)
+	}
+	admin := loginTestUser(t, s, "admin", "admin-secret")
+	if w := serveTestRequest(t, revoke, http.MethodPost, "/api/tokens/revoke", admin.AccessToken, map[string]string{"id": revokedID}); w.Code != http.StatusOK {
+		t.Fatalf("revoke: got %d %s", w.Code, w.Body.String())
+	}
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", revoked, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: got %d, want 401", w.Code)
+	}
+
+	// 篡改令牌密钥部分
+	forged := expiring[:len(expiring)-4] + "0000"
+	if w := serveTestRequest(t, list, http.MethodGet, "/api/sites/list", forged, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("forged token: got %d, want 401", w.Code)
+	}
+}
+
+func TestDeployTokenLimitedByOwner(t *testing.T) {
+	s := newTestServer(t, Config{
+		Users: map[string]User{
+			"admin": {Name: "admin", Password: "admin-secret", IsAdmin: true},
+			"alice": {Name: "alice", Password: "alice-secret"},
+		},
+		Sites: map[string]Site{"demo": {Name: "demo", Owner: "alice"}},
+	})
+	writeTestFiles(t, filepath.Join(s.config().WebRoot, "demo"), map[string]string{"index.html": "demo"})
+	export := s.authMiddleware(s.handleExport)
+	alice := loginTestUser(t, s, "alice", "alice-secret")
+	token, _ := createDeployToken(t, s, alice.AccessToken, map[string]interface{}{
+		"name": "ci", "actions": []string{"read"},
+	})
+	if w := serveTestRequest(t, export, http.MethodGet, "/api/sites/export?name=demo", token, nil); w.Code != http.StatusOK {
+		t.Fatalf("owner's site: got %d, want 200", w.Code)
+	}
+
+	// 所属用户失去网站权限后，令牌随之失去权限
+	s.mu.Lock()
+	site := s.config().Sites["demo"]
+	site.Owner = "admin"
+	s.config().Sites["demo"] = site
+	s.mu.Unlock()
+	if w := serveTestRequest(t, export, http.MethodGet, "/api/sites/export?name=demo", token, nil); w.Code != http.StatusForbidden {
+		t.Errorf("after alice lost access: got %d, want 403", w.Code)
+	}
+}
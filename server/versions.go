@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultVersionLimit = 20  // 版本列表默认每页数量
+	maxVersionLimit     = 100 // 版本列表每页最大数量
+)
+
+// versionQuery 版本列表的分页和筛选条件
+type versionQuery struct {
+	Limit   int       // 每页数量
+	Offset  int       // 跳过的版本数（从最新版本开始计算）
+	Author  string    // 作者（包含匹配，不区分大小写）
+	Message string    // 提交说明（包含匹配，不区分大小写）
+	Since   time.Time // 起始时间（含），零值表示不限
+	Until   time.Time // 截止时间（含），零值表示不限
+}
+
+// parseVersionQuery 解析版本列表的查询参数
+// 支持 limit、offset、author、q（提交说明）、since、until（RFC3339 或 YYYY-MM-DD）
+func parseVersionQuery(values url.Values) (versionQuery, error) {
+	query := versionQuery{
+		Limit:   defaultVersionLimit,
+		Author:  values.Get("author"),
+		Message: values.Get("q"),
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("无效的 limit: %s", v)
+		}
+		if limit > maxVersionLimit {
+			limit = maxVersionLimit
+		}
+		query.Limit = limit
+	}
+
+	if v := values.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return query, fmt.Errorf("无效的 offset: %s", v)
+		}
+		query.Offset = offset
+	}
+
+	var err error
+	if query.Since, err = parseVersionTime(values.Get("since"), false); err != nil {
+		return query, err
+	}
+	if query.Until, err = parseVersionTime(values.Get("until"), true); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// parseVersionTime 解析时间参数，只有日期时 endOfDay 为 true 取当天最后一秒
+func parseVersionTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无效的时间: %s（应为 RFC3339 或 YYYY-MM-DD）", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
+
+// matches 判断版本是否符合筛选条件
+func (q versionQuery) matches(v Version) bool {
+	if q.Author != "" && !strings.Contains(strings.ToLower(v.Author), strings.ToLower(q.Author)) {
+		return false
+	}
+	if q.Message != "" && !strings.Contains(strings.ToLower(v.Message), strings.ToLower(q.Message)) {
+		return false
+	}
+	if !q.Since.IsZero() && v.Date.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && v.Date.After(q.Until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,775 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	versionsDirName = ".versions" // 版本存储目录名（位于web根目录下，隐藏目录不会被当作网站）
+	objectsDirName  = ".objects"  // 所有网站共享的内容对象目录（位于版本存储目录下，网站名不会以"."开头）
+
+	versionGCGrace = time.Hour // 最近写入或复用的对象在该时间内不会被回收
+)
+
+// VersionFile 版本中的单个文件
+type VersionFile struct {
+	Object string `json:"object"` // 内容对象ID
+	Size   int64  `json:"size"`   // 文件大小
+}
+
+// VersionStore 网站版本存储
+type VersionStore interface {
+	// Init 为网站准备版本存储
+	Init(site string) error
+	// Commit 将目录内容保存为新版本，内容与当前版本相同时不创建版本并返回 nil
+	Commit(site, dir, message, author string) (*Version, error)
+	// List 按查询条件分页列出版本（最新的在前），同时返回符合条件的版本总数
+	List(site string, query versionQuery) ([]Version, int, error)
+	// Resolve 将版本引用（完整或缩写哈希、HEAD、HEAD~N、标签）解析为完整哈希
+	Resolve(site, ref string) (string, error)
+	// Tags 列出网站的版本标签（标签 -> 版本哈希）
+	Tags(site string) (map[string]string, error)
+	// Tag 为版本设置标签，已存在的同名标签会被移动到该版本
+	Tag(site, tag, hash string) error
+	// Untag 删除版本标签
+	Untag(site, tag string) error
+	// Files 列出版本中的文件（相对路径 -> 文件）
+	Files(site, hash string) (map[string]VersionFile, error)
+	// Open 打开版本中的文件内容
+	Open(site string, file VersionFile) (io.ReadCloser, error)
+	// Checkout 将版本内容写入目录
+	Checkout(site, hash, dest string) error
+	// Remove 删除网站的全部版本（内容对象由 GC 回收）
+	Remove(site string) error
+	// Prune 删除 keep 返回 false 的版本（index 为从最新版本开始的序号，当前版本和带标签的版本始终保留）
+	// 返回被删除的版本和保留的版本数
+	Prune(site string, keep func(index int, v Version) bool) ([]Version, int, error)
+	// GC 删除不再被任何版本引用、且超过 grace 未被使用的内容对象
+	GC(grace time.Duration) (GCStats, error)
+}
+
+// GCStats 内容对象回收结果
+type GCStats struct {
+	RemovedObjects int   `json:"removed_objects"` // 删除的对象数
+	FreedBytes     int64 `json:"freed_bytes"`     // 释放的字节数
+	Objects        int   `json:"objects"`         // 剩余对象数
+	Bytes          int64 `json:"bytes"`           // 剩余对象总字节数
+}
+
+// snapshot 一个版本的完整快照
+type snapshot struct {
+	Hash    string                 `json:"hash"`
+	Parent  string                 `json:"parent,omitempty"`
+	Message string                 `json:"message"`
+	Author  string                 `json:"author"`
+	Date    time.Time              `json:"date"`
+	Files   map[string]VersionFile `json:"files"`
+}
+
+// snapshotStore 基于内容寻址快照的版本存储（纯 Go 实现，不依赖 git）
+// 目录结构：<root>/.objects/ab/cdef... 保存所有网站共享的文件内容（SHA-256，相同内容只存一份），
+// <root>/<site>/commits/<hash>.json 保存引用内容对象的版本快照，log.jsonl 按时间顺序记录版本，tags.json 保存版本标签
+type snapshotStore struct {
+	root        string
+	mu          sync.RWMutex // 保护版本日志、快照和内容对象的读写，GC 期间独占
+	precompress func() bool  // 是否开启部署预压缩，开启时部署生成的 .gz 文件不保存到版本中
+}
+
+// newSnapshotStore 创建快照版本存储
+func newSnapshotStore(webRoot string) *snapshotStore {
+	return &snapshotStore{root: filepath.Join(webRoot, versionsDirName)}
+}
+
+// siteDir 网站的版本存储目录
+func (st *snapshotStore) siteDir(site string) string {
+	return filepath.Join(st.root, site)
+}
+
+// objectsDir 共享内容对象目录
+func (st *snapshotStore) objectsDir() string {
+	return filepath.Join(st.root, objectsDirName)
+}
+
+// objectPath 内容对象路径
+func (st *snapshotStore) objectPath(object string) string {
+	return filepath.Join(st.objectsDir(), object[:2], object[2:])
+}
+
+// commitPath 版本快照路径
+func (st *snapshotStore) commitPath(site, hash string) string {
+	return filepath.Join(st.siteDir(site), "commits", hash+".json")
+}
+
+// tagsPath 版本标签文件路径
+func (st *snapshotStore) tagsPath(site string) string {
+	return filepath.Join(st.siteDir(site), "tags.json")
+}
+
+// logPath 版本日志路径
+func (st *snapshotStore) logPath(site string) string {
+	return filepath.Join(st.siteDir(site), "log.jsonl")
+}
+
+// exists 判断网站是否已有版本存储
+func (st *snapshotStore) exists(site string) bool {
+	_, err := os.Stat(st.siteDir(site))
+	return err == nil
+}
+
+// Init 为网站准备版本存储
+func (st *snapshotStore) Init(site string) error {
+	for _, dir := range []string{st.objectsDir(), filepath.Join(st.siteDir(site), "commits")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建版本存储失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// Commit 将目录内容保存为新版本，部署时生成的预压缩文件不保存，检出后按配置重新生成
+func (st *snapshotStore) Commit(site, dir, message, author string) (*Version, error) {
+	if err := st.Init(site); err != nil {
+		return nil, err
+	}
+
+	files, err := listContentFiles(dir, st.precompress != nil && st.precompress())
+	if err != nil {
+		return nil, fmt.Errorf("读取网站文件失败: %v", err)
+	}
+
+	snap := &snapshot{
+		Message: message,
+		Author:  author,
+		Date:    time.Now(),
+		Files:   make(map[string]VersionFile, len(files)),
+	}
+	for relPath := range files {
+		object, size, err := st.putFile(filepath.Join(dir, relPath))
+		if err != nil {
+			return nil, err
+		}
+		snap.Files[filepath.ToSlash(relPath)] = VersionFile{Object: object, Size: size}
+	}
+
+	return st.addSnapshot(site, snap, "")
+}
+
+// addSnapshot 以当前最新版本为父版本记录快照，hash 为空时根据内容生成
+func (st *snapshotStore) addSnapshot(site string, snap *snapshot, hash string) (*Version, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	entries, err := st.readLog(site)
+	if err != nil {
+		return nil, err
+	}
+
+	var parent *snapshot
+	if len(entries) > 0 {
+		snap.Parent = entries[len(entries)-1].Hash
+		if parent, err = st.readSnapshot(site, snap.Parent); err != nil {
+			return nil, err
+		}
+		// 内容未变化时不创建新版本
+		if hash == "" && sameFiles(parent.Files, snap.Files) {
+			return nil, nil
+		}
+	}
+
+	if hash == "" {
+		data, err := json.Marshal(snap)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		hash = hex.EncodeToString(sum[:])[:40]
+	}
+	snap.Hash = hash
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(st.commitPath(site, hash), data); err != nil {
+		return nil, fmt.Errorf("保存版本失败: %v", err)
+	}
+
+	version := Version{
+		Hash:    hash,
+		Message: snap.Message,
+		Author:  snap.Author,
+		Date:    snap.Date,
+		Size:    totalSize(snap.Files),
+	}
+	if parent != nil {
+		version.FilesChanged = changedFiles(parent.Files, snap.Files)
+	} else {
+		version.FilesChanged = len(snap.Files)
+	}
+
+	line, err := json.Marshal(version)
+	if err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(st.logPath(site), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("写入版本日志失败: %v", err)
+	}
+	defer logFile.Close()
+	if _, err := logFile.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("写入版本日志失败: %v", err)
+	}
+
+	return &version, nil
+}
+
+// putFile 将文件内容写入对象存储，返回对象ID和大小
+func (st *snapshotStore) putFile(filePath string) (string, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, fmt.Errorf("读取文件失败: %v", err)
+	}
+	defer file.Close()
+	return st.putObject(file)
+}
+
+// putObject 将内容写入共享对象存储（已存在的对象不会重复写入）
+func (st *snapshotStore) putObject(r io.Reader) (string, int64, error) {
+	tmpDir := st.objectsDir()
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return "", 0, fmt.Errorf("创建对象目录失败: %v", err)
+	}
+	tmp, err := os.CreateTemp(tmpDir, ".tmp-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("创建临时对象失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("写入对象失败: %v", err)
+	}
+
+	// 检查和刷新对象时持有读锁，避免与 GC 删除对象交错
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	object := hex.EncodeToString(hasher.Sum(nil))
+	objectPath := st.objectPath(object)
+	if _, err := os.Stat(objectPath); err == nil {
+		// 刷新修改时间，避免版本快照写入前被 GC 当作无用对象删除
+		now := time.Now()
+		err := os.Chtimes(objectPath, now, now)
+		if err == nil {
+			return object, size, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", 0, fmt.Errorf("刷新对象失败: %v", err)
+		}
+		// 对象已被删除，重新写入
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return "", 0, fmt.Errorf("创建对象目录失败: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		return "", 0, fmt.Errorf("保存对象失败: %v", err)
+	}
+	return object, size, nil
+}
+
+// List 按查询条件分页列出版本
+func (st *snapshotStore) List(site string, query versionQuery) ([]Version, int, error) {
+	st.mu.RLock()
+	entries, err := st.readLog(site)
+	var tags map[string]string
+	if err == nil {
+		tags, err = st.readTags(site)
+	}
+	st.mu.RUnlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	versionTags := make(map[string][]string)
+	for tag, hash := range tags {
+		versionTags[hash] = append(versionTags[hash], tag)
+	}
+
+	versions := []Version{}
+	total := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !query.matches(entries[i]) {
+			continue
+		}
+		if total >= query.Offset && len(versions) < query.Limit {
+			version := entries[i]
+			// 列表只显示提交说明的第一行
+			version.Message, _, _ = strings.Cut(version.Message, "\n")
+			if tags := versionTags[version.Hash]; len(tags) > 0 {
+				sort.Strings(tags)
+				version.Tags = tags
+			}
+			versions = append(versions, version)
+		}
+		total++
+	}
+	return versions, total, nil
+}
+
+// Resolve 将版本引用解析为完整哈希
+func (st *snapshotStore) Resolve(site, ref string) (string, error) {
+	st.mu.RLock()
+	entries, err := st.readLog(site)
+	var tags map[string]string
+	if err == nil {
+		tags, err = st.readTags(site)
+	}
+	st.mu.RUnlock()
+	if err != nil {
+		return "", err
+	}
+
+	// 标签优先于哈希前缀（7 位以上的十六进制不能用作标签，较短的十六进制标签优先于同名的哈希前缀）
+	if hash, exists := tags[ref]; exists {
+		return hash, nil
+	}
+
+	// HEAD 表示当前版本，HEAD~N 表示之前第 N 个版本
+	if ref == "HEAD" || strings.HasPrefix(ref, "HEAD~") {
+		back := 0
+		if ref != "HEAD" {
+			back, err = strconv.Atoi(strings.TrimPrefix(ref, "HEAD~"))
+			if err != nil || back < 0 {
+				return "", fmt.Errorf("无效的版本: %s", ref)
+			}
+		}
+		if back >= len(entries) {
+			return "", fmt.Errorf("版本不存在: %s", ref)
+		}
+		return entries[len(entries)-1-back].Hash, nil
+	}
+
+	ref = strings.ToLower(ref)
+	if len(ref) < 4 {
+		return "", fmt.Errorf("版本哈希至少需要 4 位: %s", ref)
+	}
+	match := ""
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Hash, ref) {
+			if match != "" && match != entry.Hash {
+				return "", fmt.Errorf("版本哈希不唯一: %s", ref)
+			}
+			match = entry.Hash
+		}
+	}
+	if match == "" {
+		return "", fmt.Errorf("版本不存在: %s", ref)
+	}
+	return match, nil
+}
+
+// Tags 列出网站的版本标签
+func (st *snapshotStore) Tags(site string) (map[string]string, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.readTags(site)
+}
+
+// Tag 为版本设置标签
+func (st *snapshotStore) Tag(site, tag, hash string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, err := os.Stat(st.commitPath(site, hash)); err != nil {
+		return fmt.Errorf("版本不存在: %s", hash)
+	}
+	tags, err := st.readTags(site)
+	if err != nil {
+		return err
+	}
+	tags[tag] = hash
+	return st.writeTags(site, tags)
+}
+
+// Untag 删除版本标签
+func (st *snapshotStore) Untag(site, tag string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	tags, err := st.readTags(site)
+	if err != nil {
+		return err
+	}
+	if _, exists := tags[tag]; !exists {
+		return fmt.Errorf("标签不存在: %s", tag)
+	}
+	delete(tags, tag)
+	return st.writeTags(site, tags)
+}
+
+// Files 列出版本中的文件
+func (st *snapshotStore) Files(site, hash string) (map[string]VersionFile, error) {
+	snap, err := st.readSnapshot(site, hash)
+	if err != nil {
+		return nil, err
+	}
+	return snap.Files, nil
+}
+
+// Open 打开版本中的文件内容
+func (st *snapshotStore) Open(site string, file VersionFile) (io.ReadCloser, error) {
+	if len(file.Object) < 3 {
+		return nil, fmt.Errorf("无效的对象: %s", file.Object)
+	}
+	return os.Open(st.objectPath(file.Object))
+}
+
+// Checkout 将版本内容写入目录
+func (st *snapshotStore) Checkout(site, hash, dest string) error {
+	snap, err := st.readSnapshot(site, hash)
+	if err != nil {
+		return err
+	}
+
+	for relPath, file := range snap.Files {
+		target, err := safeJoin(dest, relPath)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		if err := st.copyObject(site, file, target); err != nil {
+			return fmt.Errorf("检出文件 %s 失败: %v", relPath, err)
+		}
+	}
+	return nil
+}
+
+// copyObject 将对象内容复制到目标文件（不使用硬链接，避免线上文件与版本对象共享）
+func (st *snapshotStore) copyObject(site string, file VersionFile, target string) error {
+	src, err := st.Open(site, file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// Remove 删除网站的全部版本
+func (st *snapshotStore) Remove(site string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return os.RemoveAll(st.siteDir(site))
+}
+
+// Prune 按保留规则删除旧版本，版本引用的内容对象由 GC 回收
+func (st *snapshotStore) Prune(site string, keep func(index int, v Version) bool) ([]Version, int, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	entries, err := st.readLog(site)
+	if err != nil {
+		return nil, 0, err
+	}
+	tags, err := st.readTags(site)
+	if err != nil {
+		return nil, 0, err
+	}
+	tagged := make(map[string]bool, len(tags))
+	for _, hash := range tags {
+		tagged[hash] = true
+	}
+
+	var kept, pruned []Version
+	for i := len(entries) - 1; i >= 0; i-- {
+		index := len(entries) - 1 - i
+		if index == 0 || tagged[entries[i].Hash] || keep(index, entries[i]) {
+			kept = append(kept, entries[i])
+		} else {
+			pruned = append(pruned, entries[i])
+		}
+	}
+	if len(pruned) == 0 {
+		return nil, len(kept), nil
+	}
+
+	// 先重写日志再删除快照，中断时只会留下未被引用的快照
+	var buf bytes.Buffer
+	for i := len(kept) - 1; i >= 0; i-- {
+		line, err := json.Marshal(kept[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(st.logPath(site), buf.Bytes()); err != nil {
+		return nil, 0, fmt.Errorf("写入版本日志失败: %v", err)
+	}
+	for _, version := range pruned {
+		if err := os.Remove(st.commitPath(site, version.Hash)); err != nil && !os.IsNotExist(err) {
+			return pruned, len(kept), fmt.Errorf("删除版本 %s 失败: %v", version.Hash, err)
+		}
+	}
+	return pruned, len(kept), nil
+}
+
+// GC 删除不再被任何版本引用的内容对象
+// 对象先于版本快照写入，最近 grace 内写入或复用过的对象即使暂未被引用也会保留
+func (st *snapshotStore) GC(grace time.Duration) (GCStats, error) {
+	var stats GCStats
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	referenced, err := st.referencedObjects()
+	if err != nil {
+		return stats, err
+	}
+
+	cutoff := time.Now().Add(-grace)
+	err = filepath.Walk(st.objectsDir(), func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		object := filepath.Base(filepath.Dir(path)) + info.Name()
+		if referenced[object] || info.ModTime().After(cutoff) {
+			stats.Objects++
+			stats.Bytes += info.Size()
+			return nil
+		}
+		// 删除前再次确认对象没有在宽限期内被复用
+		current, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.ModTime().After(cutoff) {
+			stats.Objects++
+			stats.Bytes += current.Size()
+			return nil
+		}
+		// 未被引用的对象和中断写入留下的临时文件
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		stats.RemovedObjects++
+		stats.FreedBytes += info.Size()
+		return nil
+	})
+	return stats, err
+}
+
+// referencedObjects 收集所有网站所有版本引用的内容对象，调用方需持有 st.mu
+func (st *snapshotStore) referencedObjects() (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	commitFiles, err := filepath.Glob(filepath.Join(st.root, "*", "commits", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, commitFile := range commitFiles {
+		data, err := os.ReadFile(commitFile)
+		if err != nil {
+			return nil, err
+		}
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			// 无法解析的快照会导致误删对象，直接中止
+			return nil, fmt.Errorf("解析版本快照 %s 失败: %v", commitFile, err)
+		}
+		for _, file := range snap.Files {
+			referenced[file.Object] = true
+		}
+	}
+	return referenced, nil
+}
+
+// readLog 读取版本日志（按时间从旧到新），调用方需持有 st.mu
+func (st *snapshotStore) readLog(site string) ([]Version, error) {
+	file, err := os.Open(st.logPath(site))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取版本日志失败: %v", err)
+	}
+	defer file.Close()
+
+	var entries []Version
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry Version
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// 跳过写入中断产生的不完整记录
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取版本日志失败: %v", err)
+	}
+	return entries, nil
+}
+
+// readTags 读取版本标签，调用方需持有 st.mu
+func (st *snapshotStore) readTags(site string) (map[string]string, error) {
+	tags := make(map[string]string)
+	data, err := os.ReadFile(st.tagsPath(site))
+	if os.IsNotExist(err) {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取版本标签失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("解析版本标签失败: %v", err)
+	}
+	return tags, nil
+}
+
+// writeTags 保存版本标签，调用方需持有 st.mu
+func (st *snapshotStore) writeTags(site string, tags map[string]string) error {
+	data, err := json.MarshalIndent(tags, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(st.tagsPath(site), data); err != nil {
+		return fmt.Errorf("保存版本标签失败: %v", err)
+	}
+	return nil
+}
+
+// readSnapshot 读取版本快照
+func (st *snapshotStore) readSnapshot(site, hash string) (*snapshot, error) {
+	if !isVersionRef(hash) {
+		return nil, fmt.Errorf("无效的版本: %s", hash)
+	}
+	data, err := os.ReadFile(st.commitPath(site, hash))
+	if err != nil {
+		return nil, fmt.Errorf("版本不存在: %s", hash)
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("解析版本 %s 失败: %v", hash, err)
+	}
+	return &snap, nil
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免读到写了一半的内容
+func writeFileAtomic(filePath string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	tmp := filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filePath)
+}
+
+// sameFiles 判断两个版本的文件是否完全相同
+func sameFiles(a, b map[string]VersionFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for relPath, file := range a {
+		if other, exists := b[relPath]; !exists || other.Object != file.Object {
+			return false
+		}
+	}
+	return true
+}
+
+// changedFiles 统计两个版本之间新增、修改和删除的文件数
+func changedFiles(from, to map[string]VersionFile) int {
+	changed := 0
+	for relPath, file := range to {
+		if old, exists := from[relPath]; !exists || old.Object != file.Object {
+			changed++
+		}
+	}
+	for relPath := range from {
+		if _, exists := to[relPath]; !exists {
+			changed++
+		}
+	}
+	return changed
+}
+
+// totalSize 统计版本中所有文件的总字节数
+func totalSize(files map[string]VersionFile) int64 {
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	return size
+}
+
+// sortedPaths 返回排序后的文件路径
+func sortedPaths(files ...map[string]VersionFile) []string {
+	seen := make(map[string]bool)
+	paths := []string{}
+	for _, set := range files {
+		for relPath := range set {
+			if !seen[relPath] {
+				seen[relPath] = true
+				paths = append(paths, relPath)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// collectVersionGarbage 回收不再被任何版本引用的内容对象
+func (s *DeployServer) collectVersionGarbage() {
+	stats, err := s.versions.GC(versionGCGrace)
+	if err != nil {
+		fmt.Printf("回收版本内容对象失败: %v\n", err)
+		return
+	}
+	if stats.RemovedObjects > 0 {
+		fmt.Printf("已回收 %d 个版本内容对象，释放 %d 字节，剩余 %d 个对象（%d 字节）\n",
+			stats.RemovedObjects, stats.FreedBytes, stats.Objects, stats.Bytes)
+	}
+}
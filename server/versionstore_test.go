@@ -0,0 +1,114 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ageObjects 将全部内容对象的修改时间调整到 age 之前
+func ageObjects(t *testing.T, st *snapshotStore, age time.Duration) {
+	t.Helper()
+	old := time.Now().Add(-age)
+	err := filepath.Walk(st.objectsDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// objectExists 判断内容对象是否仍在存储中
+func objectExists(st *snapshotStore, object string) bool {
+	_, err := os.Stat(st.objectPath(object))
+	return err == nil
+}
+
+func TestGCKeepsRecentAndReferencedObjects(t *testing.T) {
+	webRoot := t.TempDir()
+	st := newSnapshotStore(webRoot)
+	siteDir := filepath.Join(webRoot, "demo")
+	writeTestFiles(t, siteDir, map[string]string{"index.html": "live"})
+	version, err := st.Commit("demo", siteDir, "v1", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := st.Files("demo", version.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	referenced := files["index.html"].Object
+
+	orphan, _, err := st.putObject(strings.NewReader("orphan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ageObjects(t, st, 2*versionGCGrace)
+
+	// 刚写入、尚未被版本引用的对象（例如正在提交的部署）在宽限期内保留
+	pending, _, err := st.putObject(strings.NewReader("pending"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := st.GC(versionGCGrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RemovedObjects != 1 || stats.Objects != 2 {
+		t.Errorf("stats = %+v, want 1 removed and 2 kept", stats)
+	}
+	if !objectExists(st, referenced) {
+		t.Error("GC removed an object referenced by a version")
+	}
+	if !objectExists(st, pending) {
+		t.Error("GC removed an unreferenced object inside the grace period")
+	}
+	if objectExists(st, orphan) {
+		t.Error("GC kept an unreferenced object older than the grace period")
+	}
+
+	// 网站版本删除后，对象超过宽限期才会回收
+	if err := st.Remove("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GC(versionGCGrace); err != nil {
+		t.Fatal(err)
+	}
+	if !objectExists(st, pending) {
+		t.Error("GC removed a recent object after the site was removed")
+	}
+	ageObjects(t, st, 2*versionGCGrace)
+	stats, err = st.GC(versionGCGrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Objects != 0 || objectExists(st, referenced) || objectExists(st, pending) {
+		t.Errorf("stats = %+v, want every unreferenced object removed", stats)
+	}
+}
+
+func TestGCKeepsReusedObjects(t *testing.T) {
+	st := newSnapshotStore(t.TempDir())
+	object, _, err := st.putObject(strings.NewReader("shared"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ageObjects(t, st, 2*versionGCGrace)
+
+	// 再次写入相同内容会刷新对象的修改时间，正在提交的版本引用它之前不会被回收
+	if _, _, err := st.putObject(strings.NewReader("shared")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GC(versionGCGrace); err != nil {
+		t.Fatal(err)
+	}
+	if !objectExists(st, object) {
+		t.Error("GC removed an object that was just reused")
+	}
+}